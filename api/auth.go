@@ -0,0 +1,180 @@
+package api
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+
+	log "github.com/elleFlorio/gru/Godeps/_workspace/src/github.com/Sirupsen/logrus"
+
+	cfg "github.com/elleFlorio/gru/configuration"
+)
+
+const (
+	RoleReadOnly = "read-only"
+	RoleOperator = "operator"
+	RoleAdmin    = "admin"
+	// The agents use their role to exchange the shared data
+	RoleAgent = "agent"
+
+	c_BEARER_PREFIX = "Bearer "
+)
+
+var (
+	audit = log.New()
+
+	roleLevels = map[string]int{
+		RoleReadOnly: 1,
+		RoleOperator: 2,
+		RoleAdmin:    3,
+	}
+)
+
+// The audit log is written to the file configured in the cluster, or to
+// the standard error if it is not configured or cannot be opened.
+func InitializeAudit(path string) {
+	audit.Out = os.Stderr
+	if path == "" {
+		return
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"path": path,
+			"err":  err,
+		}).Errorln("Cannot open audit log")
+		return
+	}
+	audit.Out = file
+}
+
+// The requests are authorized only if some token is configured: a missing
+// or unknown token is rejected with 401, a token with a role that cannot
+// perform the request with 403. The write requests and the rejected ones
+// are written to the audit log.
+func Authorize(inner http.Handler, name string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tokens := cfg.GetAgentAuth().Tokens
+		if len(tokens) == 0 {
+			inner.ServeHTTP(w, r)
+			return
+		}
+
+		required := requiredRole(r)
+		token, ok := findToken(tokens, r.Header.Get("Authorization"))
+		if !ok {
+			auditRequest(r, name, "", required, http.StatusUnauthorized)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		if !allows(token.Role, required) {
+			auditRequest(r, name, token.Name, required, http.StatusForbidden)
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		if r.Method != "GET" && required != RoleAgent {
+			auditRequest(r, name, token.Name, required, http.StatusOK)
+		}
+
+		inner.ServeHTTP(w, r)
+	})
+}
+
+func findToken(tokens []cfg.AuthToken, header string) (cfg.AuthToken, bool) {
+	if !strings.HasPrefix(header, c_BEARER_PREFIX) {
+		return cfg.AuthToken{}, false
+	}
+
+	received := []byte(strings.TrimPrefix(header, c_BEARER_PREFIX))
+	for _, token := range tokens {
+		if subtle.ConstantTimeCompare(received, []byte(token.Token)) == 1 {
+			return token, true
+		}
+	}
+
+	return cfg.AuthToken{}, false
+}
+
+// The reads need the read-only role, the exchange of shared data needs the
+// agent role, starting and stopping services need the operator role while
+// all the other commands need the admin role.
+func requiredRole(r *http.Request) string {
+	if r.Method == "GET" {
+		return RoleReadOnly
+	}
+
+	switch {
+	case strings.HasPrefix(r.URL.Path, "/gru/v1/gossip"):
+		return RoleAgent
+	case strings.HasPrefix(r.URL.Path, "/gru/v1/stats/user"):
+		return RoleOperator
+	case strings.HasPrefix(r.URL.Path, "/gru/v1/commands"):
+		return commandRole(r)
+	}
+
+	return RoleAdmin
+}
+
+// The body is read to find the command and restored for the handler
+func commandRole(r *http.Request) string {
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, 1048576))
+	if err != nil {
+		return RoleAdmin
+	}
+	r.Body.Close()
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	var cmd Command
+	if err = json.Unmarshal(body, &cmd); err != nil {
+		return RoleAdmin
+	}
+
+	switch cmd.Name {
+	case "start", "stop":
+		if cmd.Target == "service" {
+			return RoleOperator
+		}
+	case "rolling-update":
+		return RoleOperator
+	}
+
+	return RoleAdmin
+}
+
+func allows(role string, required string) bool {
+	if required == RoleAgent {
+		return role == RoleAgent || role == RoleAdmin
+	}
+	if role == RoleAgent {
+		return required == RoleReadOnly
+	}
+
+	level, ok := roleLevels[role]
+	return ok && level >= roleLevels[required]
+}
+
+func auditRequest(r *http.Request, name string, token string, required string, status int) {
+	entry := audit.WithFields(log.Fields{
+		"remote":   r.RemoteAddr,
+		"method":   r.Method,
+		"uri":      r.RequestURI,
+		"route":    name,
+		"token":    token,
+		"required": required,
+		"status":   status,
+	})
+
+	if status == http.StatusOK {
+		entry.Infoln("Request authorized")
+	} else {
+		entry.Warnln("Request rejected")
+	}
+}
@@ -0,0 +1,98 @@
+package api
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/elleFlorio/gru/Godeps/_workspace/src/github.com/stretchr/testify/assert"
+
+	cfg "github.com/elleFlorio/gru/configuration"
+	"github.com/elleFlorio/gru/data"
+	"github.com/elleFlorio/gru/discovery"
+)
+
+func TestAuthorize(t *testing.T) {
+	defer func() { cfg.GetAgentAuth().Tokens = nil }()
+	audit.Out = ioutil.Discard
+	var received string
+	handler := Authorize(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		received = string(body)
+		w.WriteHeader(http.StatusOK)
+	}), "test")
+
+	request := func(method string, path string, token string, body string) int {
+		r := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	// Without tokens the API is open
+	assert.Equal(t, http.StatusOK, request("POST", "/gru/v1/commands", "", "{}"))
+
+	cfg.GetAgentAuth().Tokens = []cfg.AuthToken{
+		cfg.AuthToken{Name: "viewer", Token: "r3ad", Role: RoleReadOnly},
+		cfg.AuthToken{Name: "ops", Token: "0per", Role: RoleOperator},
+		cfg.AuthToken{Name: "root", Token: "adm1n", Role: RoleAdmin},
+		cfg.AuthToken{Name: "node", Token: "ag3nt", Role: RoleAgent},
+	}
+	startService := `{"Name":"start","Target":"service","Object":"service1"}`
+	startAgent := `{"Name":"start","Target":"agent"}`
+
+	assert.Equal(t, http.StatusUnauthorized, request("GET", "/gru/v1/stats", "", ""))
+	assert.Equal(t, http.StatusUnauthorized, request("GET", "/gru/v1/stats", "wrong", ""))
+	assert.Equal(t, http.StatusOK, request("GET", "/gru/v1/stats", "r3ad", ""))
+
+	assert.Equal(t, http.StatusForbidden, request("POST", "/gru/v1/commands", "r3ad", startService))
+	assert.Equal(t, http.StatusOK, request("POST", "/gru/v1/commands", "0per", startService))
+	assert.Equal(t, startService, received)
+	assert.Equal(t, http.StatusForbidden, request("POST", "/gru/v1/commands", "0per", startAgent))
+	assert.Equal(t, http.StatusOK, request("POST", "/gru/v1/commands", "adm1n", startAgent))
+
+	assert.Equal(t, http.StatusOK, request("POST", "/gru/v1/gossip", "ag3nt", "{}"))
+	assert.Equal(t, http.StatusForbidden, request("POST", "/gru/v1/gossip", "0per", "{}"))
+	assert.Equal(t, http.StatusForbidden, request("POST", "/gru/v1/commands", "ag3nt", startService))
+}
+
+func TestRollingUpdateImage(t *testing.T) {
+	defer func() { cfg.GetAgentAuth().Tokens = nil }()
+	defer cfg.CleanServices()
+	_, err := discovery.New("file", "")
+	assert.NoError(t, err)
+	defer discovery.New("noservice", "")
+	audit.Out = ioutil.Discard
+
+	remote := "/gru/cluster1/services/service1"
+	cfg.WriteService(remote, cfg.Service{Name: "service1", Image: "service1:2", PreviousImage: "service1:1"})
+	cfg.SetServices([]cfg.Service{cfg.Service{Name: "service1", Image: "service1:1", Remote: remote}})
+
+	var update data.RollingUpdate
+	handler := Authorize(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cmd, _ := readCommand(r)
+		update, err = readRollingUpdate(cmd)
+	}), "test")
+
+	// An operator can run the rolling update, but not choose the image
+	cfg.GetAgentAuth().Tokens = []cfg.AuthToken{cfg.AuthToken{Name: "ops", Token: "0per", Role: RoleOperator}}
+	body := `{"Name":"rolling-update","Target":"service1","Object":{"image":"attacker/image","maxsurge":2}}`
+	r := httptest.NewRequest("POST", "/gru/v1/commands", bytes.NewBufferString(body))
+	r.Header.Set("Authorization", "Bearer 0per")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NoError(t, err)
+	assert.Equal(t, "service1:2", update.Image)
+	assert.Equal(t, "service1:1", update.PreviousImage)
+	assert.Equal(t, 2, update.MaxSurge)
+
+	cfg.SetServices([]cfg.Service{cfg.Service{Name: "service1", Remote: "/gru/cluster1/services/missing"}})
+	_, err = readRollingUpdate(Command{Name: "rolling-update", Target: "service1", Object: map[string]interface{}{}})
+	assert.Equal(t, ErrUnknownImage, err)
+}
@@ -5,7 +5,9 @@ import (
 	"net/http"
 
 	log "github.com/elleFlorio/gru/Godeps/_workspace/src/github.com/Sirupsen/logrus"
+	"github.com/elleFlorio/gru/Godeps/_workspace/src/github.com/gorilla/mux"
 
+	"github.com/elleFlorio/gru/autonomic/executor"
 	"github.com/elleFlorio/gru/autonomic/executor/action"
 )
 
@@ -23,3 +25,25 @@ func GetInfoActions(w http.ResponseWriter, r *http.Request) {
 		}).Errorln("API Server")
 	}
 }
+
+// /gru/v1/actions/{id}
+func GetAction(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+	record, ok := executor.GetAction(id)
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(record); err != nil {
+		log.WithFields(log.Fields{
+			"status":  "http response",
+			"request": "GetAction",
+			"error":   err,
+		}).Errorln("API Server")
+	}
+}
@@ -0,0 +1,25 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	log "github.com/elleFlorio/gru/Godeps/_workspace/src/github.com/Sirupsen/logrus"
+
+	"github.com/elleFlorio/gru/autonomic/executor"
+)
+
+// /gru/v1/advisory
+func GetAdvisoryReport(w http.ResponseWriter, r *http.Request) {
+	report := executor.GetAdvisoryReport()
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(report); err != nil {
+		log.WithFields(log.Fields{
+			"status":  "http response",
+			"request": "GetAdvisoryReport",
+			"error":   err,
+		}).Errorln("API Server")
+	}
+}
@@ -2,6 +2,7 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
 	"io"
 	"io/ioutil"
 	"net/http"
@@ -10,9 +11,11 @@ import (
 	log "github.com/elleFlorio/gru/Godeps/_workspace/src/github.com/Sirupsen/logrus"
 
 	"github.com/elleFlorio/gru/agent"
-	ch "github.com/elleFlorio/gru/channels"
+	"github.com/elleFlorio/gru/autonomic/executor"
 	com "github.com/elleFlorio/gru/communication"
 	cfg "github.com/elleFlorio/gru/configuration"
+	"github.com/elleFlorio/gru/data"
+	"github.com/elleFlorio/gru/enum"
 	"github.com/elleFlorio/gru/service"
 )
 
@@ -24,6 +27,8 @@ type Command struct {
 	Timestamp time.Time
 }
 
+var ErrUnknownImage error = errors.New("Image of the service not found in the discovery service")
+
 const c_GRU_REMOTE = "/gru/"
 const c_CONFIG_REMOTE = "config"
 const c_SERVICES_REMOTE = "services"
@@ -37,8 +42,15 @@ func PostCommand(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
-	executeCommand(cmd)
+	cmd = executeCommand(cmd)
 	w.WriteHeader(http.StatusAccepted)
+	if err = json.NewEncoder(w).Encode(cmd); err != nil {
+		log.WithFields(log.Fields{
+			"status":  "http response",
+			"request": "PostCommand",
+			"error":   err,
+		}).Errorln("API Server")
+	}
 }
 
 func readCommand(r *http.Request) (Command, error) {
@@ -72,14 +84,18 @@ func readCommand(r *http.Request) (Command, error) {
 	return cmd, nil
 }
 
-func executeCommand(cmd Command) {
+// The result of the commands that queue actions is the ID of the actions,
+// that can be followed through /gru/v1/actions/{id}.
+func executeCommand(cmd Command) Command {
 	switch cmd.Name {
 	case "start":
-		startCommand(cmd)
+		cmd.Result = startCommand(cmd)
 	case "stop":
-		stopCommand(cmd)
+		cmd.Result = stopCommand(cmd)
 	case "update":
 		updateCommand(cmd)
+	case "rolling-update":
+		rollingUpdateCommand(cmd)
 	default:
 		log.Errorln("Unrecognized command name: ", cmd.Name)
 	}
@@ -88,19 +104,23 @@ func executeCommand(cmd Command) {
 		"cmd":    cmd.Name,
 		"target": cmd.Target,
 	}).Debugln("Executed command")
+
+	return cmd
 }
 
-func startCommand(cmd Command) {
+func startCommand(cmd Command) string {
 	switch cmd.Target {
 	case "agent":
 		startCommunication()
 		startAgent()
 	case "service":
 		name := cmd.Object.(string)
-		startService(name)
+		return startService(name)
 	default:
 		log.WithField("target", cmd.Target).Errorln("Unrecognized target for command start")
 	}
+
+	return ""
 }
 
 func startAgent() {
@@ -136,39 +156,56 @@ func startCommunication() {
 	)
 }
 
-func startService(name string) {
+func startService(name string) string {
 	log.WithField("name", name).Debugln("Starting service")
 	toStart, err := service.GetServiceByName(name)
 	if err != nil {
 		log.WithField("name", name).Debugln("Error starting service")
+		return ""
 	}
-	ch.SendActionStartMessage(toStart)
+
+	return queueActions(toStart, enum.Actions{enum.START})
 }
 
-func stopCommand(cmd Command) {
+func stopCommand(cmd Command) string {
 	switch cmd.Target {
 	case "agent":
 		//TODO
 	case "service":
 		name := cmd.Object.(string)
-		stopService(name)
+		return stopService(name)
 	default:
 		log.WithField("target", cmd.Target).Errorln("Unrecognized target for command stop")
 	}
+
+	return ""
 }
 
-func stopService(name string) {
+func stopService(name string) string {
 	log.WithField("name", name).Debugln("Stopping service")
 	toStop, err := service.GetServiceByName(name)
 	if err != nil {
 		log.WithField("name", name).Debugln("Error stopping service")
+		return ""
 	}
 	if len(toStop.Instances.All) < 1 {
 		log.WithField("service", name).Debugln("No active instance to stop")
-		return
+		return ""
 	}
 
-	ch.SendActionStopMessage(toStop)
+	return queueActions(toStop, enum.Actions{enum.STOP, enum.REMOVE})
+}
+
+func queueActions(target *cfg.Service, actions enum.Actions) string {
+	id, err := executor.QueueActions(target, actions)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"service": target.Name,
+			"err":     err,
+		}).Errorln("Cannot queue actions")
+	}
+
+	return id
 }
 
 func updateCommand(cmd Command) {
@@ -205,6 +242,26 @@ func updateCommand(cmd Command) {
 		constraints := cfg.GetNodeConstraints()
 		constraints.CpuMax = upd
 		cfg.WriteNodeConstraints(cfg.GetNodeConfig().Remote, *constraints)
+	case "node-memmin":
+		upd := cmd.Object.(float64)
+		constraints := cfg.GetNodeConstraints()
+		constraints.MemMin = upd
+		cfg.WriteNodeConstraints(cfg.GetNodeConfig().Remote, *constraints)
+	case "node-memmax":
+		upd := cmd.Object.(float64)
+		constraints := cfg.GetNodeConstraints()
+		constraints.MemMax = upd
+		cfg.WriteNodeConstraints(cfg.GetNodeConfig().Remote, *constraints)
+	case "node-mode":
+		upd, _ := cmd.Object.(string)
+		if err := cfg.SetAgentMode(upd); err != nil {
+			log.WithFields(log.Fields{
+				"mode": upd,
+				"err":  err,
+			}).Errorln("Cannot update agent mode")
+			return
+		}
+		log.WithField("mode", upd).Infoln("Agent mode updated")
 	case "service-constraints":
 		name := cmd.Object.(string)
 		srv, _ := service.GetServiceByName(name)
@@ -215,6 +272,53 @@ func updateCommand(cmd Command) {
 	}
 }
 
+func rollingUpdateCommand(cmd Command) {
+	update, err := readRollingUpdate(cmd)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"service": cmd.Target,
+			"err":     err,
+		}).Errorln("Error reading rolling update")
+		return
+	}
+
+	if err = executor.StartRollingUpdate(update); err != nil {
+		log.WithFields(log.Fields{
+			"service": update.Service,
+			"err":     err,
+		}).Errorln("Cannot start rolling update")
+	}
+}
+
+// The command only carries the options of the rolling update: the image is
+// read from the service stored in the discovery service by the manager, so
+// the roles allowed to run a rolling update cannot choose the image.
+func readRollingUpdate(cmd Command) (data.RollingUpdate, error) {
+	update := data.RollingUpdate{}
+	// The object is decoded as a generic map, so it is converted back
+	encoded, err := json.Marshal(cmd.Object)
+	if err != nil {
+		return update, err
+	}
+	if err = json.Unmarshal(encoded, &update); err != nil {
+		return update, err
+	}
+
+	srv, err := service.GetServiceByName(cmd.Target)
+	if err != nil {
+		return update, err
+	}
+	stored := cfg.ReadService(srv.Remote)
+	if stored.Image == "" {
+		return update, ErrUnknownImage
+	}
+	update.Service = srv.Name
+	update.Image = stored.Image
+	update.PreviousImage = stored.PreviousImage
+
+	return update, nil
+}
+
 func updateAll(cluster string) {
 	updateAgent(cluster)
 	updateServices(cluster)
@@ -230,9 +334,16 @@ func updateAgent(cluster string) {
 	log.WithField("agent", agentConfig).Debugln("Agent updated from remote")
 }
 
+// The services are validated as when the node joins the cluster: the
+// invalid ones are discarded, while the current services are kept if the
+// dependencies are not valid.
 func updateServices(cluster string) {
 	remote := c_GRU_REMOTE + cluster + "/" + c_SERVICES_REMOTE
-	services := cfg.ReadServices(remote)
+	services := service.ValidateServices(cfg.ReadServices(remote))
+	if err := service.CheckDependencies(services); err != nil {
+		log.WithField("err", err).Errorln("Error in services dependencies, services not updated")
+		return
+	}
 	cfg.SetServices(services)
 	log.WithField("services", services).Debugln("Services updated from remote")
 }
@@ -0,0 +1,54 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	log "github.com/elleFlorio/gru/Godeps/_workspace/src/github.com/Sirupsen/logrus"
+
+	"github.com/elleFlorio/gru/data"
+)
+
+// /gru/v1/decisions?service=<name>&since=<unix>&until=<unix>
+func GetDecisions(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	since, errSince := parseUnixTime(query.Get("since"))
+	until, errUntil := parseUnixTime(query.Get("until"))
+	if errSince != nil || errUntil != nil {
+		log.WithFields(log.Fields{
+			"status":  "http request",
+			"request": "GetDecisions",
+			"error":   "invalid time filter",
+		}).Errorln("API Server")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	decisions, _ := data.GetDecisions()
+	decisions = data.FilterDecisions(decisions, query.Get("service"), since, until)
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(decisions); err != nil {
+		log.WithFields(log.Fields{
+			"status":  "http response",
+			"request": "GetDecisions",
+			"error":   err,
+		}).Errorln("API Server")
+	}
+}
+
+func parseUnixTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	seconds, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return time.Unix(seconds, 0), nil
+}
@@ -7,11 +7,13 @@ import (
 	log "github.com/elleFlorio/gru/Godeps/_workspace/src/github.com/Sirupsen/logrus"
 
 	cfg "github.com/elleFlorio/gru/configuration"
+	"github.com/elleFlorio/gru/discovery"
 )
 
 // /gru/v1/node
 func GetInfoNode(w http.ResponseWriter, r *http.Request) {
 	info := cfg.GetNode()
+	info.Degraded = discovery.Degraded()
 
 	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
 	w.WriteHeader(http.StatusOK)
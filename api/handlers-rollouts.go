@@ -0,0 +1,33 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	log "github.com/elleFlorio/gru/Godeps/_workspace/src/github.com/Sirupsen/logrus"
+	"github.com/elleFlorio/gru/Godeps/_workspace/src/github.com/gorilla/mux"
+
+	"github.com/elleFlorio/gru/autonomic/executor"
+)
+
+// /gru/v1/rollouts/{service}
+func GetRollout(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	name := vars["service"]
+	rollout, ok := executor.GetRollout(name)
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(rollout); err != nil {
+		log.WithFields(log.Fields{
+			"status":  "http response",
+			"request": "GetRollout",
+			"error":   err,
+		}).Errorln("API Server")
+	}
+}
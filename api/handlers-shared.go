@@ -1,24 +1,88 @@
 package api
 
 import (
-	"encoding/json"
+	"io"
+	"io/ioutil"
 	"net/http"
 
 	log "github.com/elleFlorio/gru/Godeps/_workspace/src/github.com/Sirupsen/logrus"
 
+	com "github.com/elleFlorio/gru/communication"
 	"github.com/elleFlorio/gru/data"
 )
 
+const c_MAX_GOSSIP_SIZE = 16 * 1048576
+
 // /gru/v1/shared/
 func GetSharedData(w http.ResponseWriter, r *http.Request) {
 	info, _ := data.GetSharedLocal()
+	writeNegotiated(w, r, http.StatusOK, info, "GetSharedData")
+}
+
+// /gru/v1/shared/cluster
+func GetSharedCluster(w http.ResponseWriter, r *http.Request) {
+	info, err := data.GetSharedCluster()
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	writeNegotiated(w, r, http.StatusOK, info, "GetSharedCluster")
+}
 
-	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
-	w.WriteHeader(http.StatusOK)
-	if err := json.NewEncoder(w).Encode(info); err != nil {
+// /gru/v1/gossip
+func PostGossip(w http.ResponseWriter, r *http.Request) {
+	msg := data.GossipMessage{}
+	contentType, err := data.ParseContentType(r.Header.Get("Content-Type"))
+	if err != nil {
+		w.WriteHeader(http.StatusUnsupportedMediaType)
+		return
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, c_MAX_GOSSIP_SIZE))
+	if err == nil {
+		err = data.Decode(body, &msg, contentType)
+	}
+	if err != nil {
+		log.WithFields(log.Fields{
+			"status":  "http request",
+			"request": "PostGossip",
+			"error":   err,
+		}).Errorln("API Server")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	reply := com.HandleGossip(msg)
+	writeNegotiated(w, r, http.StatusOK, reply, "PostGossip")
+}
+
+// The shared data are encoded in msgpack or cbor if requested by the Accept
+// header, otherwise in JSON.
+func writeNegotiated(w http.ResponseWriter, r *http.Request, status int, value interface{}, request string) {
+	contentType := data.NegotiateContentType(r.Header.Get("Accept"))
+	encoded, err := data.Encode(value, contentType)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"status":  "http response",
+			"request": request,
+			"error":   err,
+		}).Errorln("API Server")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if contentType == data.ContentTypeJSON {
+		contentType += "; charset=UTF-8"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Vary", "Accept")
+	w.WriteHeader(status)
+	if _, err = w.Write(encoded); err != nil {
 		log.WithFields(log.Fields{
 			"status":  "http response",
-			"request": "GetInfoNode",
+			"request": request,
 			"error":   err,
 		}).Errorln("API Server")
 	}
@@ -11,6 +11,7 @@ func NewRouter() *mux.Router {
 	for _, route := range routes {
 		var handler http.Handler
 		handler = route.HandlerFunc
+		handler = Authorize(handler, route.Name)
 		handler = Logger(handler, route.Name)
 
 		router.
@@ -117,6 +117,30 @@ var routes = Routes{
 		GetInfoPolicies,
 	},
 
+	//DECISIONS
+	Route{
+		"Decisions",
+		"GET",
+		"/gru/v1/decisions",
+		GetDecisions,
+	},
+
+	//ADVISORY
+	Route{
+		"AdvisoryReport",
+		"GET",
+		"/gru/v1/advisory",
+		GetAdvisoryReport,
+	},
+
+	//ROLLOUTS
+	Route{
+		"Rollout",
+		"GET",
+		"/gru/v1/rollouts/{service}",
+		GetRollout,
+	},
+
 	//ACTION
 	Route{
 		"InfoActions",
@@ -125,6 +149,13 @@ var routes = Routes{
 		GetInfoActions,
 	},
 
+	Route{
+		"Action",
+		"GET",
+		"/gru/v1/actions/{id}",
+		GetAction,
+	},
+
 	//SHARED
 	Route{
 		"SharedData",
@@ -133,6 +164,20 @@ var routes = Routes{
 		GetSharedData,
 	},
 
+	Route{
+		"SharedCluster",
+		"GET",
+		"/gru/v1/shared/cluster",
+		GetSharedCluster,
+	},
+
+	Route{
+		"Gossip",
+		"POST",
+		"/gru/v1/gossip",
+		PostGossip,
+	},
+
 	//COMMANDS
 	Route{
 		"ExecCommands",
@@ -4,11 +4,26 @@ import (
 	"net/http"
 
 	log "github.com/elleFlorio/gru/Godeps/_workspace/src/github.com/Sirupsen/logrus"
+
+	cfg "github.com/elleFlorio/gru/configuration"
+	"github.com/elleFlorio/gru/network"
 )
 
+// If TLS is configured the clients must present a certificate signed by
+// the CA of the cluster.
 func StartServer(port string) {
 
 	router := NewRouter()
+	InitializeAudit(cfg.GetAgentAuth().AuditLog)
+
+	if network.TLSEnabled() {
+		server := &http.Server{
+			Addr:      ":" + port,
+			Handler:   router,
+			TLSConfig: network.ServerTLSConfig(),
+		}
+		log.Fatal(server.ListenAndServeTLS("", ""))
+	}
 
 	log.Fatal(http.ListenAndServe(":"+port, router))
 }
@@ -2,10 +2,13 @@ package analyzer
 
 import (
 	"errors"
+	"time"
 
 	log "github.com/elleFlorio/gru/Godeps/_workspace/src/github.com/Sirupsen/logrus"
 
 	evl "github.com/elleFlorio/gru/autonomic/analyzer/evaluator"
+	com "github.com/elleFlorio/gru/communication"
+	cfg "github.com/elleFlorio/gru/configuration"
 	"github.com/elleFlorio/gru/data"
 	srv "github.com/elleFlorio/gru/service"
 )
@@ -74,15 +77,21 @@ func computeSharedData(analytics data.GruAnalytics) data.Shared {
 
 func computeLocaShared(analytics data.GruAnalytics) data.Shared {
 	local := data.Shared{
+		Node:    cfg.GetNodeConfig().Name,
 		Service: make(map[string]data.ServiceShared),
 	}
 
+	now := time.Now()
 	srvActive := []string{}
+	instances := 0
 	for name, values := range analytics.Service {
 		srvShared := data.ServiceShared{}
 		srvShared.Data.BaseShared = values.BaseAnalytics
 		srvShared.Data.UserShared = values.UserAnalytics
 		srvShared.Active = srv.IsServiceActive(name)
+		srvShared.Instances = countRunning(name)
+		srvShared.Timestamp = now
+		instances += srvShared.Instances
 
 		local.Service[name] = srvShared
 
@@ -94,23 +103,31 @@ func computeLocaShared(analytics data.GruAnalytics) data.Shared {
 	local.System.Data.BaseShared = analytics.System.BaseAnalytics
 	local.System.Data.UserShared = analytics.System.UserAnalytics
 	local.System.ActiveServices = srvActive
+	local.System.Instances = instances
+	local.System.Timestamp = now
 
 	data.SaveSharedLocal(local)
 
 	return local
 }
 
-func computeClusterShared(local data.Shared) data.Shared {
-	storedCluster, err := data.GetSharedCluster()
+func countRunning(name string) int {
+	service, err := srv.GetServiceByName(name)
 	if err != nil {
-		log.WithField("err", err).Debugln("Cannot compute cluster data")
-		data.SaveSharedCluster(local)
-		return local
+		return 0
 	}
 
-	toMerge := []data.Shared{local, storedCluster}
-	cluster, err := data.MergeShared(toMerge)
+	return len(service.Instances.Running)
+}
+
+// The local shared data is the entry of this node in the gossip state, and
+// the cluster view is computed from the freshest entry of each node.
+func computeClusterShared(local data.Shared) data.Shared {
+	data.UpdateGossipLocal(cfg.GetNodeConfig().Name, local)
+	cluster, err := data.ComputeGossipCluster(com.MaxAge())
 	if err != nil {
+		log.WithField("err", err).Debugln("Cannot compute cluster data")
+		data.SaveSharedCluster(local)
 		return local
 	}
 
@@ -42,8 +42,9 @@ func RunLoop(loopTimeInterval int) {
 		case <-ticker.C:
 			stats := monitor.Run()
 			analytics := analyzer.Run(stats)
-			policy := planner.Run(analytics)
-			executor.Run(policy)
+			policies := planner.Run(analytics)
+			outcomes := executor.Run(policies)
+			planner.RecordOutcomes(outcomes)
 
 			log.Infoln("-------------------------")
 
@@ -4,6 +4,7 @@ import (
 	"github.com/elleFlorio/gru/Godeps/_workspace/src/github.com/samalba/dockerclient"
 
 	cfg "github.com/elleFlorio/gru/configuration"
+	"github.com/elleFlorio/gru/container"
 )
 
 type Action struct {
@@ -12,8 +13,19 @@ type Action struct {
 	Parameters      ActionParameters
 	HostConfig      *dockerclient.HostConfig
 	ContainerConfig *dockerclient.ContainerConfig
+	Healthcheck     *container.HealthConfig
+	Result          *ActionResult
+}
+
+// The result is filled by the executor, so the action can be compensated
+type ActionResult struct {
+	// The container created by a START without stopped or paused instances
+	Instance string
 }
 
 type ActionParameters struct {
 	StopTimeout int
+	PullPolicy  string
+	Ports       map[string]string
+	Drain       cfg.ServiceDrain
 }
@@ -0,0 +1,129 @@
+package action
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	log "github.com/elleFlorio/gru/Godeps/_workspace/src/github.com/Sirupsen/logrus"
+	"github.com/elleFlorio/gru/Godeps/_workspace/src/github.com/samalba/dockerclient"
+
+	"github.com/elleFlorio/gru/container"
+	"github.com/elleFlorio/gru/service"
+)
+
+const c_PRESTOP_TIMEOUT = 10 * time.Second
+
+var (
+	unregisterInstance = service.UnregisterServiceInstance
+	instanceAddress    = service.GetInstanceAddress
+	countConnections   = container.CountConnections
+	execInContainer    = execCommand
+	drainTick          = time.Second
+)
+
+// Before being stopped the instance is removed from the discovery service,
+// so the clients stop sending new requests, then the pre-stop hooks are
+// executed and the in-flight requests are given the drain period to end.
+func drain(config Action, id string) {
+	unregisterInstance(config.Service, id)
+
+	drainConfig := config.Parameters.Drain
+	if drainConfig.PreStopHTTP != "" {
+		if err := callPreStopHTTP(id, drainConfig.PreStopHTTP); err != nil {
+			log.WithFields(log.Fields{
+				"service":  config.Service,
+				"instance": id,
+				"err":      err,
+			}).Warnln("Pre-stop HTTP hook failed")
+		}
+	}
+
+	if len(drainConfig.PreStopExec) > 0 {
+		if err := execInContainer(id, drainConfig.PreStopExec); err != nil {
+			log.WithFields(log.Fields{
+				"service":  config.Service,
+				"instance": id,
+				"err":      err,
+			}).Warnln("Pre-stop exec hook failed")
+		}
+	}
+
+	if drainConfig.Period > 0 {
+		waitDrain(id, portsOf(config.Parameters.Ports), time.Duration(drainConfig.Period)*time.Second)
+	}
+}
+
+func callPreStopHTTP(id string, hook string) error {
+	url := hook
+	if !strings.HasPrefix(hook, "http://") && !strings.HasPrefix(hook, "https://") {
+		address := instanceAddress(id)
+		if address == "" {
+			return fmt.Errorf("no address for instance %s", id)
+		}
+		url = "http://" + address + "/" + strings.TrimPrefix(hook, "/")
+	}
+
+	client := &http.Client{Timeout: c_PRESTOP_TIMEOUT}
+	resp, err := client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("pre-stop hook returned status %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+func execCommand(id string, cmd []string) error {
+	execConfig := &dockerclient.ExecConfig{
+		AttachStdout: true,
+		AttachStderr: true,
+		Cmd:          cmd,
+		Container:    id,
+	}
+
+	execId, err := container.Docker().Client.ExecCreate(execConfig)
+	if err != nil {
+		return err
+	}
+
+	return container.Docker().Client.ExecStart(execId, execConfig)
+}
+
+// The drain ends when there are no more connections to the instance or
+// when the period is over. If the connections cannot be counted the whole
+// period is waited.
+func waitDrain(id string, ports []string, period time.Duration) {
+	deadline := time.After(period)
+	ticker := time.NewTicker(drainTick)
+	defer ticker.Stop()
+	for {
+		if len(ports) > 0 {
+			if n, err := countConnections(id, ports); err == nil && n == 0 {
+				log.WithField("instance", id).Debugln("Instance drained")
+				return
+			}
+		}
+
+		select {
+		case <-ticker.C:
+		case <-deadline:
+			log.WithField("instance", id).Debugln("Drain period over")
+			return
+		}
+	}
+}
+
+func portsOf(bindings map[string]string) []string {
+	ports := make([]string, 0, len(bindings))
+	for guest, _ := range bindings {
+		ports = append(ports, guest)
+	}
+
+	return ports
+}
@@ -0,0 +1,84 @@
+package action
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/elleFlorio/gru/Godeps/_workspace/src/github.com/stretchr/testify/assert"
+
+	cfg "github.com/elleFlorio/gru/configuration"
+	"github.com/elleFlorio/gru/container"
+	"github.com/elleFlorio/gru/service"
+)
+
+func TestDrain(t *testing.T) {
+	defer func() {
+		unregisterInstance = service.UnregisterServiceInstance
+		instanceAddress = service.GetInstanceAddress
+		countConnections = container.CountConnections
+		execInContainer = execCommand
+	}()
+	drainTick = time.Millisecond
+
+	events := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		events = append(events, "http "+r.URL.Path)
+	}))
+	defer server.Close()
+
+	unregisterInstance = func(name string, id string) { events = append(events, "unregister "+id) }
+	instanceAddress = func(id string) string { return strings.TrimPrefix(server.URL, "http://") }
+	execInContainer = func(id string, cmd []string) error {
+		events = append(events, "exec "+strings.Join(cmd, " "))
+		return errors.New("exec failed")
+	}
+	connections := 3
+	countConnections = func(id string, ports []string) (int, error) {
+		connections--
+		return connections, nil
+	}
+
+	config := Action{
+		Service: "service1",
+		Parameters: ActionParameters{
+			Ports: map[string]string{"50000": "50000-50004"},
+			Drain: cfg.ServiceDrain{
+				Period:      5,
+				PreStopHTTP: "/shutdown",
+				PreStopExec: []string{"nginx", "-s", "quit"},
+			},
+		},
+	}
+
+	start := time.Now()
+	drain(config, "instance1")
+	assert.Equal(t, []string{"unregister instance1", "http /shutdown", "exec nginx -s quit"}, events)
+	assert.Equal(t, 0, connections)
+	assert.True(t, time.Since(start) < time.Second)
+
+	countConnections = func(id string, ports []string) (int, error) {
+		return 0, errors.New("cannot read connections")
+	}
+	start = time.Now()
+	waitDrain("instance1", []string{"50000"}, 20*time.Millisecond)
+	assert.True(t, time.Since(start) >= 20*time.Millisecond)
+}
+
+func TestStopPrepare(t *testing.T) {
+	defer func() { unregisterInstance = service.UnregisterServiceInstance }()
+	drained := []string{}
+	unregisterInstance = func(name string, id string) { drained = append(drained, id) }
+
+	stop := &Stop{}
+	config := Action{Service: "service1", Instances: cfg.ServiceStatus{Pending: []string{"instance2"}}}
+	assert.NoError(t, stop.Prepare(config))
+	config.Instances.Running = []string{"instance1"}
+	assert.NoError(t, stop.Prepare(config))
+	assert.Equal(t, []string{"instance2", "instance1"}, drained)
+
+	assert.Equal(t, ErrNoContainerToStop, stop.Prepare(Action{Service: "service1"}))
+}
@@ -11,6 +11,13 @@ type ActionExecutor interface {
 	Run(Action) error
 }
 
+// The executors that need a long preparation (e.g. pulling an image or
+// draining an instance) do it before the action is run, so it is not bound
+// to the action timeout.
+type Preparer interface {
+	Prepare(Action) error
+}
+
 var (
 	actions         []ActionExecutor
 	ErrNotSupported = errors.New("action not supported")
@@ -2,6 +2,7 @@ package action
 
 import (
 	"errors"
+	"time"
 
 	log "github.com/elleFlorio/gru/Godeps/_workspace/src/github.com/Sirupsen/logrus"
 
@@ -10,7 +11,11 @@ import (
 	"github.com/elleFlorio/gru/enum"
 )
 
-var errNoContainerToRemove = errors.New("No stopped container to remove")
+var (
+	errNoContainerToRemove = errors.New("No stopped container to remove")
+
+	removalTimeout = 30 * time.Second
+)
 
 type Remove struct{}
 
@@ -30,9 +35,8 @@ func (p *Remove) Run(config Action) error {
 		return errNoContainerToRemove
 	}
 
-	ch.SetRemovalNotification(true)
-
 	toRemove := stopped[0]
+	ch_removed := ch.CreateRemovalChannel(toRemove)
 	// Assumption: I remove only stopped containers; containers have no volume
 	err = container.Docker().Client.RemoveContainer(toRemove, false, false)
 	if err != nil {
@@ -41,11 +45,12 @@ func (p *Remove) Run(config Action) error {
 			"instance": toRemove,
 			"err":      err,
 		}).Errorln("Cannot remove container")
+		ch.RemoveRemovalChannel(toRemove)
 
 		return err
 	}
 
-	waitForRemoval()
+	waitForRemoval(toRemove, ch_removed)
 
 	log.WithFields(log.Fields{
 		"service":  config.Service,
@@ -55,8 +60,15 @@ func (p *Remove) Run(config Action) error {
 	return nil
 }
 
-func waitForRemoval() {
+// The container has already been removed by the daemon, but the monitor
+// could miss the destroy event, so the confirmation is not waited forever.
+func waitForRemoval(id string, ch_removed chan struct{}) {
 	log.Debugln("Waiting for removal confirmation...")
-	<-ch.GetRemovalChannel()
-	log.Debugln("Remove complete")
+	select {
+	case <-ch_removed:
+		log.Debugln("Remove complete")
+	case <-time.After(removalTimeout):
+		ch.RemoveRemovalChannel(id)
+		log.WithField("instance", id).Warnln("Removal not confirmed by the monitor")
+	}
 }
@@ -0,0 +1,26 @@
+package action
+
+import (
+	"testing"
+	"time"
+
+	"github.com/elleFlorio/gru/Godeps/_workspace/src/github.com/stretchr/testify/assert"
+
+	ch "github.com/elleFlorio/gru/channels"
+)
+
+func TestWaitForRemoval(t *testing.T) {
+	defer func() { removalTimeout = 30 * time.Second }()
+	removalTimeout = 10 * time.Millisecond
+
+	ch_removed := ch.CreateRemovalChannel("instance1")
+	ch.NotifyRemoval("instance1")
+	start := time.Now()
+	waitForRemoval("instance1", ch_removed)
+	assert.True(t, time.Since(start) < removalTimeout)
+
+	// The monitor missed the destroy event
+	ch_removed = ch.CreateRemovalChannel("instance2")
+	waitForRemoval("instance2", ch_removed)
+	assert.NotPanics(t, func() { ch.NotifyRemoval("instance2") })
+}
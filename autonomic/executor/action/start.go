@@ -14,6 +14,23 @@ func (p *Start) Type() enum.Action {
 	return enum.START
 }
 
+// The image is needed only if a new container is created
+func (p *Start) Prepare(config Action) error {
+	if len(config.Instances.Paused) > 0 || len(config.Instances.Stopped) > 0 {
+		return nil
+	}
+
+	err := container.EnsureImage(config.ContainerConfig.Image, config.Parameters.PullPolicy)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"image": config.ContainerConfig.Image,
+			"err":   err,
+		}).Errorln("Cannot get the image for service ", config.Service)
+	}
+
+	return err
+}
+
 func (p *Start) Run(config Action) error {
 	var toStart string
 	var err error
@@ -59,19 +76,32 @@ func (p *Start) Run(config Action) error {
 		"service": config.Service,
 	}).Debugln("No stopped/paused container to start: creating new one")
 	toStart, err = createNewContainer(config)
+	if err != nil {
+		return err
+	}
+
 	err = container.Docker().Client.StartContainer(toStart, config.HostConfig)
 	if err != nil {
 		return err
 	}
+	if config.Result != nil {
+		config.Result.Instance = toStart
+	}
 
 	return nil
 
 }
 
 func createNewContainer(config Action) (string, error) {
+	// The image has been pulled by Prepare, outside the action timeout
+	err := container.EnsureImage(config.ContainerConfig.Image, container.PullNever)
+	if err != nil {
+		return "", err
+	}
+
 	uuid, err := utils.GenerateUUID()
 	name := config.Service + "_" + uuid
-	id, err := container.Docker().Client.CreateContainer(config.ContainerConfig, name, nil)
+	id, err := container.CreateContainer(config.ContainerConfig, config.Healthcheck, name)
 	if err != nil {
 		log.WithField("err", err).Errorln("Cannot create a new container for service ", config.Service)
 		return "", err
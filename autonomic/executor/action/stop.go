@@ -17,25 +17,22 @@ func (p *Stop) Type() enum.Action {
 	return enum.STOP
 }
 
-func (p *Stop) Run(config Action) error {
-	var err error
-	var toStop string
-	running := config.Instances.Running
-
-	if len(running) < 1 {
-		log.WithField("err", ErrNoContainerToStop).Errorln("Cannot stop running container. Trying with pending ones...")
-
-		pending := config.Instances.Pending
-		if len(pending) < 1 {
-			log.WithField("err", ErrNoContainerToStop).Errorln("Cannot stop pending container")
-			return ErrNoContainerToStop
-		}
-
-		toStop = pending[0]
+// The instance is drained before the action is run, so the drain period
+// and the pre-stop hooks do not count against the action timeout.
+func (p *Stop) Prepare(config Action) error {
+	toStop, err := instanceToStop(config)
+	if err != nil {
+		return err
+	}
 
-	} else {
+	drain(config, toStop)
+	return nil
+}
 
-		toStop = running[0]
+func (p *Stop) Run(config Action) error {
+	toStop, err := instanceToStop(config)
+	if err != nil {
+		return err
 	}
 
 	err = container.Docker().Client.StopContainer(toStop, config.Parameters.StopTimeout)
@@ -46,3 +43,19 @@ func (p *Stop) Run(config Action) error {
 
 	return nil
 }
+
+func instanceToStop(config Action) (string, error) {
+	running := config.Instances.Running
+	if len(running) > 0 {
+		return running[0], nil
+	}
+
+	log.WithField("err", ErrNoContainerToStop).Errorln("Cannot stop running container. Trying with pending ones...")
+	pending := config.Instances.Pending
+	if len(pending) < 1 {
+		log.WithField("err", ErrNoContainerToStop).Errorln("Cannot stop pending container")
+		return "", ErrNoContainerToStop
+	}
+
+	return pending[0], nil
+}
@@ -0,0 +1,124 @@
+package executor
+
+import (
+	"sync"
+	"time"
+
+	log "github.com/elleFlorio/gru/Godeps/_workspace/src/github.com/Sirupsen/logrus"
+
+	cfg "github.com/elleFlorio/gru/configuration"
+	"github.com/elleFlorio/gru/data"
+	"github.com/elleFlorio/gru/enum"
+)
+
+const c_MAX_ADVICES = 100
+
+var (
+	report    data.AdvisoryReport
+	advMutex  = sync.RWMutex{}
+	advActive bool
+)
+
+func init() {
+	resetAdvisoryReport()
+}
+
+// The report is reset every time the agent enters the advisory mode
+func isAdvisoryMode() bool {
+	advisory := cfg.GetAgentMode() == cfg.ModeAdvisory
+
+	advMutex.Lock()
+	defer advMutex.Unlock()
+	if advisory && !advActive {
+		clearReport()
+	}
+	advActive = advisory
+
+	return advisory
+}
+
+func resetAdvisoryReport() {
+	advMutex.Lock()
+	clearReport()
+	advMutex.Unlock()
+}
+
+func clearReport() {
+	report = data.AdvisoryReport{
+		Since:    time.Now(),
+		Advices:  []data.Advice{},
+		Services: make(map[string]data.AdvisoryComparison),
+	}
+}
+
+func GetAdvisoryReport() data.AdvisoryReport {
+	advMutex.RLock()
+	defer advMutex.RUnlock()
+
+	report_cpy := data.AdvisoryReport{
+		Since:    report.Since,
+		Advices:  make([]data.Advice, len(report.Advices)),
+		Services: make(map[string]data.AdvisoryComparison, len(report.Services)),
+	}
+	copy(report_cpy.Advices, report.Advices)
+	for name, comparison := range report.Services {
+		report_cpy.Services[name] = comparison
+	}
+
+	return report_cpy
+}
+
+func recordAdvice(policy string, target string, actions []enum.Action) {
+	advMutex.Lock()
+	defer advMutex.Unlock()
+
+	advice := data.Advice{
+		Timestamp: time.Now(),
+		Policy:    policy,
+		Target:    target,
+		Actions:   make([]string, 0, len(actions)),
+	}
+
+	comparison := report.Services[target]
+	for _, act := range actions {
+		advice.Actions = append(advice.Actions, act.ToString())
+		switch act {
+		case enum.START:
+			comparison.AdvisedStart += 1
+		case enum.STOP:
+			comparison.AdvisedStop += 1
+		}
+	}
+	if target != "noservice" {
+		report.Services[target] = comparison
+	}
+
+	report.Advices = append(report.Advices, advice)
+	if len(report.Advices) > c_MAX_ADVICES {
+		report.Advices = report.Advices[len(report.Advices)-c_MAX_ADVICES:]
+	}
+
+	log.WithFields(log.Fields{
+		"policy":  policy,
+		"target":  target,
+		"actions": advice.Actions,
+	}).Infoln("Advised actions")
+}
+
+// The events are the ones observed by the monitor since the previous loop,
+// i.e. what happened on the node without the intervention of the agent.
+func recordActualEvents(events data.EventStats) {
+	advMutex.Lock()
+	defer advMutex.Unlock()
+
+	for name, evt := range events.Service {
+		if len(evt.Start) == 0 && len(evt.Stop) == 0 {
+			continue
+		}
+
+		comparison := report.Services[name]
+		comparison.ActualStart += len(evt.Start)
+		comparison.ActualStop += len(evt.Stop)
+		report.Services[name] = comparison
+	}
+}
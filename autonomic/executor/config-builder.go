@@ -2,17 +2,23 @@ package executor
 
 import (
 	"os"
+	"time"
 
 	log "github.com/elleFlorio/gru/Godeps/_workspace/src/github.com/Sirupsen/logrus"
 	"github.com/elleFlorio/gru/Godeps/_workspace/src/github.com/samalba/dockerclient"
 
 	"github.com/elleFlorio/gru/autonomic/executor/action"
 	cfg "github.com/elleFlorio/gru/configuration"
+	"github.com/elleFlorio/gru/container"
 	"github.com/elleFlorio/gru/enum"
 	res "github.com/elleFlorio/gru/resources"
+	"github.com/elleFlorio/gru/service"
 	"github.com/elleFlorio/gru/utils"
 )
 
+const c_DEFAULT_PROTOCOL = "tcp"
+const c_DEFAULT_HOST_IP = "0.0.0.0"
+
 func buildConfig(srv *cfg.Service, act enum.Action) action.Action {
 	actConfig := action.Action{}
 	actConfig.HostConfig = createHostConfig(srv, act)
@@ -20,7 +26,14 @@ func buildConfig(srv *cfg.Service, act enum.Action) action.Action {
 	actConfig.Service = srv.Name
 	actConfig.Instances = srv.Instances
 	actConfig.ContainerConfig.Image = srv.Image
+	if act == enum.START {
+		actConfig.Healthcheck = createHealthcheck(srv.Docker.Healthcheck)
+	}
 	actConfig.Parameters.StopTimeout = srv.Docker.StopTimeout
+	actConfig.Parameters.PullPolicy = srv.Docker.PullPolicy
+	actConfig.Parameters.Ports = srv.Docker.Ports
+	actConfig.Parameters.Drain = srv.Drain
+	actConfig.Result = &action.ActionResult{}
 
 	return actConfig
 }
@@ -36,6 +49,22 @@ func createHostConfig(srv *cfg.Service, act enum.Action) *dockerclient.HostConfi
 		hostConfig.PortBindings = createPortBindings(srv.Name)
 		hostConfig.CpuShares = conf.CpuShares
 		hostConfig.Links = conf.Links
+		hostConfig.Binds = conf.Binds
+		hostConfig.RestartPolicy = dockerclient.RestartPolicy{
+			Name:              conf.RestartPolicy.Name,
+			MaximumRetryCount: conf.RestartPolicy.MaximumRetryCount,
+		}
+		hostConfig.NetworkMode = conf.NetworkMode
+		hostConfig.Dns = conf.Dns
+		hostConfig.DnsSearch = conf.DnsSearch
+		hostConfig.DNSOptions = conf.DnsOptions
+		hostConfig.Ulimits = createUlimits(conf.Ulimits)
+		hostConfig.CapAdd = conf.CapAdd
+		hostConfig.CapDrop = conf.CapDrop
+		hostConfig.LogConfig = dockerclient.LogConfig{
+			Type:   conf.LogConfig.Type,
+			Config: conf.LogConfig.Config,
+		}
 	}
 
 	return &hostConfig
@@ -76,14 +105,14 @@ func createPortBindings(name string) map[string][]dockerclient.PortBinding {
 		return portBindings_dckr
 	}
 	for guest, host := range assigned {
-		portTcp := guest + "/tcp"
+		port, hostIp := getPortConfig(name, guest)
 		pBindings := []dockerclient.PortBinding{}
 		pBinding := dockerclient.PortBinding{
-			HostIp:   "0.0.0.0",
+			HostIp:   hostIp,
 			HostPort: host,
 		}
 		pBindings = append(pBindings, pBinding)
-		portBindings_dckr[portTcp] = pBindings
+		portBindings_dckr[port] = pBindings
 	}
 
 	return portBindings_dckr
@@ -102,6 +131,9 @@ func createContainerConfig(srv *cfg.Service, act enum.Action) *dockerclient.Cont
 		containerConfig.Entrypoint = conf.Entrypoint
 		containerConfig.CpuShares = conf.CpuShares
 		containerConfig.Cpuset = conf.CpusetCpus
+		containerConfig.Labels = createLabels(srv.Name, conf.Labels)
+		containerConfig.User = conf.User
+		containerConfig.WorkingDir = conf.WorkingDir
 	}
 
 	return &containerConfig
@@ -126,9 +158,71 @@ func createExposedPorts(name string) map[string]struct{} {
 	exposed := make(map[string]struct{})
 	assigned := res.GetRequestedPorts(name)
 	for guest, _ := range assigned {
-		guestTcp := guest + "/tcp"
-		exposed[guestTcp] = struct{}{}
+		port, _ := getPortConfig(name, guest)
+		exposed[port] = struct{}{}
 	}
 
 	return exposed
 }
+
+// The ports are bound as tcp on all the interfaces if not configured
+// differently in the service descriptor.
+func getPortConfig(name string, guest string) (string, string) {
+	protocol := c_DEFAULT_PROTOCOL
+	hostIp := c_DEFAULT_HOST_IP
+	if srv, err := service.GetServiceByName(name); err == nil {
+		if portConfig, ok := srv.Docker.PortsConfig[guest]; ok {
+			if portConfig.Protocol != "" {
+				protocol = portConfig.Protocol
+			}
+			if portConfig.HostIp != "" {
+				hostIp = portConfig.HostIp
+			}
+		}
+	}
+
+	return guest + "/" + protocol, hostIp
+}
+
+// The labels of Gru cannot be overridden by the user ones
+func createLabels(name string, userLabels map[string]string) map[string]string {
+	labels := make(map[string]string, len(userLabels)+4)
+	for key, value := range userLabels {
+		labels[key] = value
+	}
+	for key, value := range service.CreateLabels(name) {
+		labels[key] = value
+	}
+
+	return labels
+}
+
+func createUlimits(ulimits []cfg.Ulimit) []dockerclient.Ulimit {
+	dockerUlimits := make([]dockerclient.Ulimit, 0, len(ulimits))
+	for _, ulimit := range ulimits {
+		dockerUlimits = append(dockerUlimits, dockerclient.Ulimit{
+			Name: ulimit.Name,
+			Soft: ulimit.Soft,
+			Hard: ulimit.Hard,
+		})
+	}
+
+	return dockerUlimits
+}
+
+func createHealthcheck(healthcheck cfg.Healthcheck) *container.HealthConfig {
+	if len(healthcheck.Test) == 0 {
+		return nil
+	}
+
+	// The durations are checked by the validation of the service
+	interval, _ := time.ParseDuration(healthcheck.Interval)
+	timeout, _ := time.ParseDuration(healthcheck.Timeout)
+
+	return &container.HealthConfig{
+		Test:     healthcheck.Test,
+		Interval: interval,
+		Timeout:  timeout,
+		Retries:  healthcheck.Retries,
+	}
+}
@@ -3,16 +3,19 @@ package executor
 import (
 	log "github.com/elleFlorio/gru/Godeps/_workspace/src/github.com/Sirupsen/logrus"
 
-	"github.com/elleFlorio/gru/autonomic/executor/action"
 	ch "github.com/elleFlorio/gru/channels"
 	cfg "github.com/elleFlorio/gru/configuration"
 	"github.com/elleFlorio/gru/data"
-	"github.com/elleFlorio/gru/enum"
 	"github.com/elleFlorio/gru/service"
+	"github.com/elleFlorio/gru/utils"
 )
 
+// The queued actions are executed by a bounded number of workers, so a
+// slow action does not block the others but the node is not overloaded.
 func ListenToActionMessages() {
-	go listen()
+	for i := 0; i < actionWorkers(); i++ {
+		go listen()
+	}
 }
 
 func listen() {
@@ -20,27 +23,61 @@ func listen() {
 	for {
 		select {
 		case msg := <-ch_action:
-			log.Debugln("Received action message")
-			executeActions(msg.Target, msg.Actions)
+			log.WithField("id", msg.Id).Debugln("Received action message")
+			runQueuedActions(msg)
 		}
 	}
 }
 
-func Run(chosenPolicy *data.Policy) {
+func Run(policies []data.Policy) []data.Execution {
 	log.WithField("status", "init").Debugln("Gru Executor")
 	defer log.WithField("status", "done").Debugln("Gru Executor")
 
-	if chosenPolicy == nil {
+	executions := []data.Execution{}
+	if isAdvisoryMode() {
+		advise(policies)
+		return executions
+	}
+
+	if len(policies) == 0 {
 		log.Warnln("No policy to execute")
-		return
+		return executions
+	}
+
+	for _, chosenPolicy := range policies {
+		execution := executePolicy(chosenPolicy)
+		log.WithFields(log.Fields{
+			"policy":  chosenPolicy.Name,
+			"outcome": execution.Outcome,
+		}).Infoln("Policy executed")
+		executions = append(executions, execution)
 	}
 
-	for _, target := range chosenPolicy.Targets {
-		actions := chosenPolicy.Actions[target]
+	return executions
+}
+
+func executePolicy(plc data.Policy) data.Execution {
+	operations := []operation{}
+	for _, target := range plc.Targets {
 		srv := getTargetService(target)
-		executeActions(srv, actions)
+		for _, actionType := range plc.Actions[target] {
+			operations = append(operations, operation{srv, actionType})
+		}
 	}
 
+	return executeTransaction(plc.Name, operations)
+}
+
+func advise(policies []data.Policy) {
+	if stats, err := data.GetStats(); err == nil {
+		recordActualEvents(stats.Events)
+	}
+
+	for _, chosenPolicy := range policies {
+		for _, target := range chosenPolicy.Targets {
+			recordAdvice(chosenPolicy.Name, target, chosenPolicy.Actions[target])
+		}
+	}
 }
 
 func getTargetService(name string) *cfg.Service {
@@ -53,22 +90,33 @@ func getTargetService(name string) *cfg.Service {
 	return srv
 }
 
-func executeActions(target *cfg.Service, actions []enum.Action) {
-	var err error
-	for _, actionType := range actions {
-		config := buildConfig(target, actionType)
-		actExecutor := action.Get(actionType)
-		err = actExecutor.Run(config)
-		if err != nil {
-			log.WithFields(log.Fields{
-				"err":    err,
-				"action": actionType.ToString(),
-			}).Errorln("Action not executed")
+// The status of the instances is updated asynchronously by the monitor, so
+// the instances already stopped by the same sequence of actions are excluded.
+func excludeInstances(instances cfg.ServiceStatus, excluded []string) cfg.ServiceStatus {
+	filtered := instances
+	filtered.Running = []string{}
+	filtered.Pending = []string{}
+	for _, id := range instances.Running {
+		if !utils.ContainsString(excluded, id) {
+			filtered.Running = append(filtered.Running, id)
 		}
+	}
+	for _, id := range instances.Pending {
+		if !utils.ContainsString(excluded, id) {
+			filtered.Pending = append(filtered.Pending, id)
+		}
+	}
 
-		log.WithFields(log.Fields{
-			"target": target.Name,
-			"action": actionType.ToString(),
-		}).Infoln("Action executed")
+	return filtered
+}
+
+func nextToStop(instances cfg.ServiceStatus) string {
+	if len(instances.Running) > 0 {
+		return instances.Running[0]
 	}
+	if len(instances.Pending) > 0 {
+		return instances.Pending[0]
+	}
+
+	return ""
 }
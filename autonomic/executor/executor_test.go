@@ -1,16 +1,22 @@
 package executor
 
 import (
+	"errors"
 	"os"
+	"strconv"
 	"testing"
+	"time"
 
 	"github.com/elleFlorio/gru/Godeps/_workspace/src/github.com/stretchr/testify/assert"
 
-	//"github.com/elleFlorio/gru/autonomic/executor/action"
+	"github.com/elleFlorio/gru/autonomic/executor/action"
+	ch "github.com/elleFlorio/gru/channels"
 	cfg "github.com/elleFlorio/gru/configuration"
+	"github.com/elleFlorio/gru/data"
 	"github.com/elleFlorio/gru/enum"
 	"github.com/elleFlorio/gru/resources"
 	"github.com/elleFlorio/gru/service"
+	"github.com/elleFlorio/gru/storage"
 )
 
 func TestGetTargetService(t *testing.T) {
@@ -103,6 +109,44 @@ func TestCreateHostConfig(t *testing.T) {
 	assert.Len(t, hostConfigStart.PortBindings, 1)
 }
 
+func TestCreateDockerOptions(t *testing.T) {
+	defer cfg.CleanServices()
+	services := service.CreateMockServices()
+	services[2].Docker.PortsConfig = map[string]cfg.PortConfig{
+		"50100": cfg.PortConfig{Protocol: "udp", HostIp: "127.0.0.1"},
+	}
+	services[2].Docker.Labels = map[string]string{"team": "gru", service.LabelService: "other"}
+	services[2].Docker.Ulimits = []cfg.Ulimit{cfg.Ulimit{Name: "nofile", Soft: 1024, Hard: 2048}}
+	services[2].Docker.Healthcheck = cfg.Healthcheck{Test: []string{"CMD", "true"}, Interval: "10s", Retries: 3}
+	cfg.SetServices(services)
+	resources.CreateMockResources(2, "1G", 0, "0G")
+	resources.InitializeServiceAvailablePorts("service3", map[string]string{"50100": "50100"})
+	service3, _ := service.GetServiceByName("service3")
+
+	bindings := createPortBindings("service3")
+	if assert.NotEmpty(t, bindings["50100/udp"]) {
+		assert.Equal(t, "127.0.0.1", bindings["50100/udp"][0].HostIp)
+	}
+	assert.Contains(t, createExposedPorts("service3"), "50100/udp")
+
+	hostConfig := createHostConfig(service3, enum.START)
+	if assert.Len(t, hostConfig.Ulimits, 1) {
+		assert.Equal(t, uint64(2048), hostConfig.Ulimits[0].Hard)
+	}
+
+	containerConfig := createContainerConfig(service3, enum.START)
+	assert.Equal(t, "gru", containerConfig.Labels["team"])
+	assert.Equal(t, "service3", containerConfig.Labels[service.LabelService])
+	healthcheck := buildConfig(service3, enum.START).Healthcheck
+	if assert.NotNil(t, healthcheck) {
+		assert.Equal(t, 10*time.Second, healthcheck.Interval)
+		assert.Equal(t, 3, healthcheck.Retries)
+	}
+	assert.Nil(t, buildConfig(service3, enum.STOP).Healthcheck)
+	services[2].Docker.Healthcheck = cfg.Healthcheck{}
+	assert.Nil(t, buildConfig(&services[2], enum.START).Healthcheck)
+}
+
 func TestCreateEnvVars(t *testing.T) {
 	vars := map[string]string{
 		"pippo":    "topolinia",
@@ -174,3 +218,406 @@ func TestBuildConfig(t *testing.T) {
 	config := buildConfig(service1, enum.START)
 	assert.Equal(t, "0", config.HostConfig.CpusetCpus)
 }
+
+func TestAdvisoryMode(t *testing.T) {
+	defer cfg.SetAgentMode(cfg.ModeActive)
+	defer storage.DeleteAllData(enum.STATS)
+	storage.New("internal")
+
+	assert.False(t, isAdvisoryMode())
+	assert.Equal(t, cfg.ErrInvalidMode, cfg.SetAgentMode("passive"))
+	assert.False(t, isAdvisoryMode())
+	assert.NoError(t, cfg.SetAgentMode(cfg.ModeAdvisory))
+	assert.True(t, isAdvisoryMode())
+
+	stats := data.GruStats{
+		Events: data.EventStats{
+			Service: map[string]data.EventData{
+				"service1": data.EventData{Start: []string{"instance1_6"}, Stop: []string{}},
+				"service2": data.EventData{Start: []string{}, Stop: []string{}},
+			},
+		},
+	}
+	data.SaveStats(stats)
+
+	scaleout := data.CreateMockPolicy("scaleout", 0.8, []string{"service1"},
+		map[string][]enum.Action{"service1": []enum.Action{enum.START}})
+	swap := data.CreateMockPolicy("swap", 0.6, []string{"service2", "service3"},
+		map[string][]enum.Action{
+			"service2": []enum.Action{enum.STOP, enum.REMOVE},
+			"service3": []enum.Action{enum.START},
+		})
+	Run([]data.Policy{scaleout, swap})
+
+	report := GetAdvisoryReport()
+	assert.Len(t, report.Advices, 3)
+	assert.Equal(t, []string{"STOP", "REMOVE"}, report.Advices[1].Actions)
+	assert.Equal(t, 1, report.Services["service1"].AdvisedStart)
+	assert.Equal(t, 1, report.Services["service1"].ActualStart)
+	assert.Equal(t, 1, report.Services["service2"].AdvisedStop)
+	assert.Equal(t, 0, report.Services["service2"].ActualStop)
+	assert.Equal(t, 1, report.Services["service3"].AdvisedStart)
+
+	cfg.SetAgentMode(cfg.ModeActive)
+	assert.False(t, isAdvisoryMode())
+	cfg.SetAgentMode(cfg.ModeAdvisory)
+	assert.True(t, isAdvisoryMode())
+	assert.Empty(t, GetAdvisoryReport().Advices)
+}
+
+func TestExcludeInstances(t *testing.T) {
+	instances := cfg.ServiceStatus{
+		Running: []string{"a", "b"},
+		Pending: []string{"c"},
+		Stopped: []string{"d"},
+	}
+
+	filtered := excludeInstances(instances, []string{"a"})
+	assert.Equal(t, []string{"b"}, filtered.Running)
+	assert.Equal(t, "b", nextToStop(filtered))
+
+	filtered = excludeInstances(instances, []string{"a", "b"})
+	assert.Empty(t, filtered.Running)
+	assert.Equal(t, []string{"d"}, filtered.Stopped)
+	assert.Equal(t, "c", nextToStop(filtered))
+
+	filtered = excludeInstances(instances, []string{"a", "b", "c"})
+	assert.Equal(t, "", nextToStop(filtered))
+}
+
+type mockExecutor struct {
+	actType  enum.Action
+	failures map[string]int
+	delay    time.Duration
+	executed *[]string
+}
+
+func (m *mockExecutor) Type() enum.Action {
+	return m.actType
+}
+
+func (m *mockExecutor) Run(config action.Action) error {
+	time.Sleep(m.delay)
+	key := config.Service + "_" + m.actType.ToString()
+	if m.failures[key] > 0 {
+		m.failures[key] -= 1
+		return errors.New("mock failure")
+	}
+	*m.executed = append(*m.executed, key)
+	instances := config.Instances
+	if m.actType == enum.START && len(instances.Paused)+len(instances.Stopped) == 0 && config.Result != nil {
+		config.Result.Instance = config.Service + "_new"
+	}
+
+	return nil
+}
+
+type mockPreparer struct {
+	mockExecutor
+	err error
+}
+
+func (m *mockPreparer) Prepare(config action.Action) error {
+	return m.err
+}
+
+func mockActionExecutors(failures map[string]int, executed *[]string) func(enum.Action) action.ActionExecutor {
+	return func(actType enum.Action) action.ActionExecutor {
+		return &mockExecutor{actType: actType, failures: failures, executed: executed}
+	}
+}
+
+func TestExecutePolicy(t *testing.T) {
+	defer cfg.CleanServices()
+	defer func() { getActionExecutor = action.Get }()
+	defer func() { cfg.GetAgentAutonomic().ActionRetries = 0 }()
+	cfg.SetServices(service.CreateMockServices())
+	resources.CreateMockResources(4, "4G", 0, "0G")
+	retryDelay = 0
+
+	swap := data.CreateMockPolicy("swap", 0.6, []string{"service2", "service3"},
+		map[string][]enum.Action{
+			"service2": []enum.Action{enum.STOP, enum.REMOVE},
+			"service3": []enum.Action{enum.START},
+		})
+
+	executed := []string{}
+	getActionExecutor = mockActionExecutors(map[string]int{}, &executed)
+	execution := executePolicy(swap)
+	assert.Equal(t, data.OutcomeSuccess, execution.Outcome)
+	assert.Equal(t, []string{"service2_STOP", "service2_REMOVE", "service3_START"}, executed)
+	assert.Equal(t, "instance2_1", execution.Steps[1].Instance)
+	assert.Empty(t, execution.Compensations)
+
+	executed = []string{}
+	getActionExecutor = mockActionExecutors(map[string]int{"service3_START": 1}, &executed)
+	execution = executePolicy(swap)
+	assert.Equal(t, data.OutcomeRolledBack, execution.Outcome)
+	assert.Equal(t, []string{"service2_STOP", "service2_REMOVE", "service2_START"}, executed)
+	assert.Len(t, execution.Compensations, 1)
+	assert.Equal(t, "", execution.Compensations[0].Instance)
+
+	stopOnly := data.CreateMockPolicy("scalein", 0.6, []string{"service2", "service3"},
+		map[string][]enum.Action{
+			"service2": []enum.Action{enum.STOP},
+			"service3": []enum.Action{enum.START},
+		})
+	executed = []string{}
+	getActionExecutor = mockActionExecutors(map[string]int{"service3_START": 1}, &executed)
+	execution = executePolicy(stopOnly)
+	assert.Equal(t, data.OutcomeRolledBack, execution.Outcome)
+	assert.Equal(t, "START", execution.Compensations[0].Action)
+	assert.Equal(t, "instance2_1", execution.Compensations[0].Instance)
+
+	cfg.GetAgentAutonomic().ActionRetries = 1
+	executed = []string{}
+	getActionExecutor = mockActionExecutors(map[string]int{"service3_START": 1}, &executed)
+	execution = executePolicy(swap)
+	assert.Equal(t, data.OutcomeSuccess, execution.Outcome)
+	assert.Equal(t, 2, execution.Steps[2].Attempts)
+
+	startStop := data.CreateMockPolicy("scaleout", 0.6, []string{"service3", "service2"},
+		map[string][]enum.Action{
+			"service3": []enum.Action{enum.START},
+			"service2": []enum.Action{enum.STOP},
+		})
+	executed = []string{}
+	getActionExecutor = mockActionExecutors(map[string]int{"service2_STOP": 2}, &executed)
+	execution = executePolicy(startStop)
+	assert.Equal(t, "service3_new", execution.Steps[0].Instance)
+	// The new container is stopped and removed
+	assert.Equal(t, data.OutcomeRolledBack, execution.Outcome)
+	if assert.Len(t, execution.Compensations, 2) {
+		assert.Equal(t, "STOP", execution.Compensations[0].Action)
+		assert.Equal(t, "REMOVE", execution.Compensations[1].Action)
+		assert.Equal(t, "service3_new", execution.Compensations[1].Instance)
+	}
+	assert.Equal(t, []string{"service3_START", "service3_STOP", "service3_REMOVE"}, executed)
+
+	// The instances that were not created by the START are only stopped
+	service3, _ := service.GetServiceByName("service3")
+	compensations, err := buildCompensation(step{operation{service3, enum.START}, "instance3_1", false})
+	assert.NoError(t, err)
+	assert.Len(t, compensations, 1)
+	_, err = buildCompensation(step{operation{service3, enum.START}, "", false})
+	assert.Equal(t, ErrNotCompensable, err)
+}
+
+func TestRunWithTimeout(t *testing.T) {
+	executed := []string{}
+	slow := &mockExecutor{actType: enum.STOP, delay: 50 * time.Millisecond, executed: &executed}
+	ch_late := make(chan error, 1)
+	err := runWithTimeout(slow, action.Action{Service: "service1"}, time.Millisecond, func(err error) {
+		ch_late <- err
+	})
+	assert.Equal(t, ErrActionTimeout, err)
+	// The action is still running, its result is collected later
+	select {
+	case err = <-ch_late:
+		assert.NoError(t, err)
+		assert.Len(t, executed, 1)
+	case <-time.After(time.Second):
+		t.Error("Late result not collected")
+	}
+
+	completed := []string{}
+	fast := &mockExecutor{actType: enum.STOP, executed: &completed}
+	err = runWithTimeout(fast, action.Action{Service: "service1"}, time.Second, nil)
+	assert.NoError(t, err)
+}
+
+func TestCompensateLate(t *testing.T) {
+	defer cfg.CleanServices()
+	defer func() { getActionExecutor = action.Get }()
+	cfg.SetServices(service.CreateMockServices())
+	service3, _ := service.GetServiceByName("service3")
+
+	executed := []string{}
+	getActionExecutor = mockActionExecutors(map[string]int{}, &executed)
+	config := buildConfig(service3, enum.START)
+	timedOut := step{operation{service3, enum.START}, "", false}
+
+	// A late failure has nothing to compensate
+	compensateLate("scaleout", timedOut, config)(errors.New("mock failure"))
+	assert.Empty(t, executed)
+
+	// The container created after the timeout is stopped and removed
+	config.Result.Instance = "service3_new"
+	compensateLate("scaleout", timedOut, config)(nil)
+	assert.Equal(t, []string{"service3_STOP", "service3_REMOVE"}, executed)
+}
+
+func TestRunActionPrepare(t *testing.T) {
+	defer func() { getActionExecutor = action.Get }()
+	executed := []string{}
+	preparer := &mockPreparer{mockExecutor{actType: enum.START, executed: &executed}, errors.New("pull failed")}
+	getActionExecutor = func(enum.Action) action.ActionExecutor { return preparer }
+
+	attempts, err := runAction(enum.START, action.Action{Service: "service1"}, nil)
+	assert.Equal(t, 0, attempts)
+	assert.Error(t, err)
+	assert.Empty(t, executed)
+
+	preparer.err = nil
+	attempts, err = runAction(enum.START, action.Action{Service: "service1"}, nil)
+	assert.Equal(t, 1, attempts)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"service1_START"}, executed)
+}
+
+func TestQueueActions(t *testing.T) {
+	defer cfg.CleanServices()
+	defer func() { getActionExecutor = action.Get }()
+	cfg.SetServices(service.CreateMockServices())
+	resources.CreateMockResources(4, "4G", 0, "0G")
+	service2, _ := service.GetServiceByName("service2")
+
+	_, err := QueueActions(nil, enum.Actions{enum.START})
+	assert.Equal(t, ErrNoTarget, err)
+
+	executed := []string{}
+	getActionExecutor = mockActionExecutors(map[string]int{}, &executed)
+	id, err := QueueActions(service2, enum.Actions{enum.STOP, enum.REMOVE})
+	assert.NoError(t, err)
+	record, ok := GetAction(id)
+	if assert.True(t, ok) {
+		assert.Equal(t, data.ActionQueued, record.Status)
+		assert.Equal(t, []string{"STOP", "REMOVE"}, record.Actions)
+	}
+
+	msg := <-ch.GetActionChannel()
+	assert.Equal(t, id, msg.Id)
+	runQueuedActions(msg)
+	record, _ = GetAction(id)
+	assert.Equal(t, data.ActionSucceeded, record.Status)
+	assert.Equal(t, []string{"service2_STOP", "service2_REMOVE"}, executed)
+
+	getActionExecutor = mockActionExecutors(map[string]int{"service2_STOP": 1}, &executed)
+	id, _ = QueueActions(service2, enum.Actions{enum.STOP})
+	runQueuedActions(<-ch.GetActionChannel())
+	record, _ = GetAction(id)
+	assert.Equal(t, data.ActionFailed, record.Status)
+	assert.Equal(t, "mock failure", record.Error)
+
+	_, ok = GetAction("unknown")
+	assert.False(t, ok)
+}
+
+func TestActionStatus(t *testing.T) {
+	status, _ := actionStatus(data.Execution{Outcome: data.OutcomeSuccess})
+	assert.Equal(t, data.ActionSucceeded, status)
+
+	timedOut := data.Execution{
+		Outcome: data.OutcomeRolledBack,
+		Steps:   []data.ExecutionStep{data.ExecutionStep{Error: ErrActionTimeout.Error()}},
+	}
+	status, msg := actionStatus(timedOut)
+	assert.Equal(t, data.ActionTimedOut, status)
+	assert.Equal(t, ErrActionTimeout.Error(), msg)
+}
+
+type rollingExecutor struct {
+	actType enum.Action
+	images  map[string]string
+	counter *int
+	failOn  string
+}
+
+func (m *rollingExecutor) Type() enum.Action {
+	return m.actType
+}
+
+func (m *rollingExecutor) Run(config action.Action) error {
+	srv, _ := service.GetServiceByName(config.Service)
+	switch m.actType {
+	case enum.START:
+		if m.failOn == "START" {
+			return errors.New("mock failure")
+		}
+		*m.counter++
+		id := "new_" + strconv.Itoa(*m.counter)
+		m.images[id] = config.ContainerConfig.Image
+		srv.Instances.All = append(srv.Instances.All, id)
+		srv.Instances.Running = append(srv.Instances.Running, id)
+	case enum.STOP:
+		id := config.Instances.Running[0]
+		srv.Instances.Running = removeId(srv.Instances.Running, id)
+		srv.Instances.Stopped = append(srv.Instances.Stopped, id)
+	case enum.REMOVE:
+		id := config.Instances.Stopped[0]
+		srv.Instances.Stopped = removeId(srv.Instances.Stopped, id)
+		srv.Instances.All = removeId(srv.Instances.All, id)
+	}
+
+	return nil
+}
+
+func removeId(ids []string, id string) []string {
+	filtered := []string{}
+	for _, current := range ids {
+		if current != id {
+			filtered = append(filtered, current)
+		}
+	}
+
+	return filtered
+}
+
+func TestRollingUpdate(t *testing.T) {
+	defer cfg.CleanServices()
+	defer func() { getActionExecutor = action.Get }()
+	defer func() { instanceImage = getInstanceImage }()
+	resources.CreateMockResources(4, "4G", 0, "0G")
+	pollInterval = time.Millisecond
+
+	services := service.CreateMockServices()
+	services[1].Instances = cfg.ServiceStatus{
+		All:     []string{"old_1", "old_2", "old_3", "old_4"},
+		Running: []string{"old_1", "old_2", "old_3"},
+		Stopped: []string{"old_4"},
+	}
+	cfg.SetServices(services)
+
+	images := map[string]string{"old_1": "test/jetty", "old_2": "test/jetty", "old_3": "test/jetty", "old_4": "test/jetty"}
+	instanceImage = func(id string) string { return images[id] }
+	counter := 0
+	failOn := ""
+	getActionExecutor = func(actType enum.Action) action.ActionExecutor {
+		return &rollingExecutor{actType: actType, images: images, counter: &counter, failOn: failOn}
+	}
+
+	update := data.RollingUpdate{
+		Service:        "service2",
+		Image:          "test/jetty:2",
+		PreviousImage:  "test/jetty",
+		MaxSurge:       1,
+		MaxUnavailable: 1,
+		ReadyTimeout:   1,
+	}
+	rollout := RollingUpdate(update)
+	assert.Equal(t, data.RolloutCompleted, rollout.Status)
+	assert.Equal(t, 3, rollout.Total)
+	assert.Equal(t, 3, rollout.Replaced)
+
+	srv, _ := service.GetServiceByName("service2")
+	assert.Equal(t, "test/jetty:2", srv.Image)
+	assert.Equal(t, []string{"new_1", "new_2", "new_3"}, srv.Instances.Running)
+	assert.Empty(t, srv.Instances.Stopped)
+	status, ok := GetRollout("service2")
+	assert.True(t, ok)
+	assert.Equal(t, data.RolloutCompleted, status.Status)
+
+	failOn = "START"
+	update.Image, update.PreviousImage = "test/jetty", "test/jetty:2"
+	rollout = RollingUpdate(update)
+	assert.Equal(t, data.RolloutPaused, rollout.Status)
+	assert.Equal(t, 0, rollout.Replaced)
+	assert.Len(t, srv.Instances.Running, 2)
+	// The image of the paused update is not used by the autonomic loop
+	srv, _ = service.GetServiceByName("service2")
+	assert.Equal(t, "test/jetty:2", srv.Image)
+	assert.Equal(t, ErrRolloutRunning, func() error {
+		saveRollout(data.Rollout{Service: "service2", Status: data.RolloutRunning})
+		return StartRollingUpdate(update)
+	}())
+}
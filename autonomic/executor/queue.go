@@ -0,0 +1,144 @@
+package executor
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	log "github.com/elleFlorio/gru/Godeps/_workspace/src/github.com/Sirupsen/logrus"
+
+	ch "github.com/elleFlorio/gru/channels"
+	cfg "github.com/elleFlorio/gru/configuration"
+	"github.com/elleFlorio/gru/data"
+	"github.com/elleFlorio/gru/enum"
+	"github.com/elleFlorio/gru/utils"
+)
+
+const (
+	c_DEFAULT_ACTION_WORKERS = 1
+	c_MAX_ENDED_ACTIONS      = 1000
+)
+
+var (
+	ErrNoTarget error = errors.New("No target service for the action")
+
+	actions       = make(map[string]data.ActionRecord)
+	endedActions  = []string{}
+	mutex_actions = sync.RWMutex{}
+)
+
+// The actions are queued with an ID that can be used to follow them until
+// they end. The HTTP handlers do not wait for the executor to pick them up.
+func QueueActions(target *cfg.Service, actionTypes enum.Actions) (string, error) {
+	if target == nil {
+		return "", ErrNoTarget
+	}
+
+	id, err := utils.GenerateUUID()
+	if err != nil {
+		return "", err
+	}
+
+	record := data.ActionRecord{
+		Id:      id,
+		Service: target.Name,
+		Actions: actionTypes.ToString(),
+		Status:  data.ActionQueued,
+		Created: time.Now(),
+	}
+	saveAction(record)
+
+	if err = ch.SendActionMessage(ch.ActionMessage{Id: id, Target: target, Actions: actionTypes}); err != nil {
+		record.Status = data.ActionFailed
+		record.Error = err.Error()
+		record.Ended = time.Now()
+		saveAction(record)
+		return id, err
+	}
+
+	log.WithFields(log.Fields{
+		"id":      id,
+		"service": target.Name,
+		"actions": record.Actions,
+	}).Debugln("Actions queued")
+
+	return id, nil
+}
+
+func GetAction(id string) (data.ActionRecord, bool) {
+	mutex_actions.RLock()
+	defer mutex_actions.RUnlock()
+	record, ok := actions[id]
+	return record, ok
+}
+
+func runQueuedActions(msg ch.ActionMessage) {
+	record, ok := GetAction(msg.Id)
+	if !ok {
+		record = data.ActionRecord{
+			Id:      msg.Id,
+			Service: msg.Target.Name,
+			Actions: msg.Actions.ToString(),
+			Created: time.Now(),
+		}
+	}
+	record.Status = data.ActionRunning
+	record.Started = time.Now()
+	saveAction(record)
+
+	operations := make([]operation, 0, len(msg.Actions))
+	for _, actionType := range msg.Actions {
+		operations = append(operations, operation{msg.Target, actionType})
+	}
+	execution := executeTransaction("command", operations)
+
+	record.Status, record.Error = actionStatus(execution)
+	record.Ended = time.Now()
+	record.Execution = &execution
+	saveAction(record)
+
+	log.WithFields(log.Fields{
+		"id":     record.Id,
+		"status": record.Status,
+	}).Infoln("Actions ended")
+}
+
+func actionStatus(execution data.Execution) (string, string) {
+	if execution.Outcome == data.OutcomeSuccess {
+		return data.ActionSucceeded, ""
+	}
+
+	for _, executed := range execution.Steps {
+		if executed.Error == ErrActionTimeout.Error() {
+			return data.ActionTimedOut, executed.Error
+		}
+		if executed.Error != "" {
+			return data.ActionFailed, executed.Error
+		}
+	}
+
+	return data.ActionFailed, ""
+}
+
+// Only the last ended actions are kept, to bound the memory used.
+func saveAction(record data.ActionRecord) {
+	mutex_actions.Lock()
+	defer mutex_actions.Unlock()
+	actions[record.Id] = record
+	if record.Status != data.ActionQueued && record.Status != data.ActionRunning {
+		endedActions = append(endedActions, record.Id)
+	}
+	for len(endedActions) > c_MAX_ENDED_ACTIONS {
+		delete(actions, endedActions[0])
+		endedActions = endedActions[1:]
+	}
+}
+
+func actionWorkers() int {
+	workers := cfg.GetAgentAutonomic().ActionWorkers
+	if workers <= 0 {
+		return c_DEFAULT_ACTION_WORKERS
+	}
+
+	return workers
+}
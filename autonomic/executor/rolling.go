@@ -0,0 +1,281 @@
+package executor
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	log "github.com/elleFlorio/gru/Godeps/_workspace/src/github.com/Sirupsen/logrus"
+
+	cfg "github.com/elleFlorio/gru/configuration"
+	"github.com/elleFlorio/gru/container"
+	"github.com/elleFlorio/gru/data"
+	"github.com/elleFlorio/gru/enum"
+	"github.com/elleFlorio/gru/service"
+	"github.com/elleFlorio/gru/utils"
+)
+
+const c_DEFAULT_READY_TIMEOUT = 120
+
+var (
+	ErrRolloutRunning   error = errors.New("Rolling update already running for service")
+	ErrInstanceNotReady error = errors.New("New instance not ready before timeout")
+
+	rollouts      = make(map[string]data.Rollout)
+	mutex_rollout = sync.RWMutex{}
+
+	instanceImage = getInstanceImage
+	pollInterval  = time.Second
+)
+
+// The rollout is marked as running before returning, so the status read
+// right after the command is accepted refers to this rolling update.
+func StartRollingUpdate(update data.RollingUpdate) error {
+	mutex_rollout.Lock()
+	if current, ok := rollouts[update.Service]; ok && current.Status == data.RolloutRunning {
+		mutex_rollout.Unlock()
+		return ErrRolloutRunning
+	}
+	rollouts[update.Service] = data.Rollout{
+		Service:       update.Service,
+		Image:         update.Image,
+		PreviousImage: update.PreviousImage,
+		Status:        data.RolloutRunning,
+		Started:       time.Now(),
+		Updated:       time.Now(),
+	}
+	mutex_rollout.Unlock()
+
+	go RollingUpdate(update)
+	return nil
+}
+
+func GetRollout(name string) (data.Rollout, bool) {
+	mutex_rollout.RLock()
+	defer mutex_rollout.RUnlock()
+	rollout, ok := rollouts[name]
+	return rollout, ok
+}
+
+// The instances of the service in the node are replaced in batches. Each
+// batch stops at most MaxUnavailable old instances before the new ones are
+// ready, and starts at most MaxSurge instances more than the old ones.
+// If a new instance cannot be started or is not ready, the rolling update
+// is paused leaving the remaining old instances running.
+func RollingUpdate(update data.RollingUpdate) data.Rollout {
+	rollout := data.Rollout{
+		Service:       update.Service,
+		Image:         update.Image,
+		PreviousImage: update.PreviousImage,
+		Status:        data.RolloutRunning,
+		Started:       time.Now(),
+	}
+
+	current, err := service.GetServiceByName(update.Service)
+	if err != nil {
+		return pauseRollout(rollout, err)
+	}
+	// The update works on a copy of the service. The new image is published
+	// to the configuration for the other components only when the first new
+	// instances are ready, so the autonomic loop does not scale the service
+	// with an image that cannot run.
+	updated := *current
+	srv := &updated
+	srv.Image = update.Image
+	srv.PreviousImage = update.PreviousImage
+	published := false
+
+	maxSurge, maxUnavailable := update.MaxSurge, update.MaxUnavailable
+	if maxSurge <= 0 && maxUnavailable <= 0 {
+		maxSurge = 1
+	}
+	readyTimeout := update.ReadyTimeout
+	if readyTimeout <= 0 {
+		readyTimeout = c_DEFAULT_READY_TIMEOUT
+	}
+
+	active := make([]string, 0, len(srv.Instances.Running)+len(srv.Instances.Pending))
+	active = append(active, srv.Instances.Running...)
+	active = append(active, srv.Instances.Pending...)
+	old := outdatedInstances(srv, active)
+	rollout.Total = len(old)
+	saveRollout(rollout)
+	log.WithFields(log.Fields{
+		"service":   srv.Name,
+		"image":     srv.Image,
+		"instances": rollout.Total,
+	}).Infoln("Rolling update started")
+
+	for len(old) > 0 {
+		batch := minInt(maxSurge+maxUnavailable, len(old))
+		down := minInt(maxUnavailable, batch)
+
+		for _, id := range old[:down] {
+			if err = replaceOldInstance(srv, id); err != nil {
+				return pauseRollout(rollout, err)
+			}
+		}
+
+		before := append([]string{}, currentInstances(srv.Name).All...)
+		for i := 0; i < batch; i++ {
+			if err = startNewInstance(srv); err != nil {
+				return pauseRollout(rollout, err)
+			}
+		}
+		if !waitReady(srv.Name, before, batch, time.Duration(readyTimeout)*time.Second) {
+			return pauseRollout(rollout, ErrInstanceNotReady)
+		}
+		if !published {
+			published = cfg.SetServiceImage(srv.Name, srv.Image, srv.PreviousImage)
+		}
+
+		for _, id := range old[down:batch] {
+			if err = replaceOldInstance(srv, id); err != nil {
+				return pauseRollout(rollout, err)
+			}
+		}
+
+		old = old[batch:]
+		rollout.Replaced += batch
+		saveRollout(rollout)
+	}
+
+	if !published {
+		cfg.SetServiceImage(srv.Name, srv.Image, srv.PreviousImage)
+	}
+
+	// The stopped containers with the previous image are removed, otherwise
+	// they could be started again by the autonomic loop.
+	for _, id := range outdatedInstances(srv, currentInstances(srv.Name).Stopped) {
+		if err = removeInstance(srv, id); err != nil {
+			log.WithFields(log.Fields{
+				"service":  srv.Name,
+				"instance": id,
+				"err":      err,
+			}).Warnln("Cannot remove outdated instance")
+		}
+	}
+
+	rollout.Status = data.RolloutCompleted
+	saveRollout(rollout)
+	log.WithField("service", srv.Name).Infoln("Rolling update completed")
+
+	return rollout
+}
+
+func outdatedInstances(srv *cfg.Service, instances []string) []string {
+	outdated := []string{}
+	for _, id := range instances {
+		// An instance whose image cannot be read is left untouched
+		if image := instanceImage(id); image != "" && image != srv.Image {
+			outdated = append(outdated, id)
+		}
+	}
+
+	return outdated
+}
+
+// The instances are updated by the monitor in the configuration
+func currentInstances(name string) cfg.ServiceStatus {
+	srv, err := service.GetServiceByName(name)
+	if err != nil {
+		return cfg.ServiceStatus{}
+	}
+
+	return srv.Instances
+}
+
+func startNewInstance(srv *cfg.Service) error {
+	config := buildConfig(srv, enum.START)
+	// Stopped or paused containers could have the previous image
+	config.Instances = cfg.ServiceStatus{}
+	_, err := runAction(enum.START, config, nil)
+	return err
+}
+
+func replaceOldInstance(srv *cfg.Service, id string) error {
+	config := buildConfig(srv, enum.STOP)
+	config.Instances = cfg.ServiceStatus{Running: []string{id}}
+	if _, err := runAction(enum.STOP, config, nil); err != nil {
+		return err
+	}
+
+	return removeInstance(srv, id)
+}
+
+func removeInstance(srv *cfg.Service, id string) error {
+	config := buildConfig(srv, enum.REMOVE)
+	config.Instances = cfg.ServiceStatus{Stopped: []string{id}}
+	_, err := runAction(enum.REMOVE, config, nil)
+	return err
+}
+
+// A new instance is ready when the monitor promotes it to running.
+func waitReady(name string, before []string, count int, timeout time.Duration) bool {
+	deadline := time.After(timeout)
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for {
+		srv, err := service.GetServiceByName(name)
+		if err != nil {
+			return false
+		}
+
+		ready := 0
+		for _, id := range srv.Instances.Running {
+			if !utils.ContainsString(before, id) {
+				ready++
+			}
+		}
+		if ready >= count {
+			return true
+		}
+
+		select {
+		case <-ticker.C:
+		case <-deadline:
+			return false
+		}
+	}
+}
+
+func minInt(a int, b int) int {
+	if a < b {
+		return a
+	}
+
+	return b
+}
+
+func pauseRollout(rollout data.Rollout, err error) data.Rollout {
+	log.WithFields(log.Fields{
+		"service": rollout.Service,
+		"err":     err,
+	}).Errorln("Rolling update paused")
+
+	rollout.Status = data.RolloutPaused
+	rollout.Error = err.Error()
+	saveRollout(rollout)
+
+	return rollout
+}
+
+func saveRollout(rollout data.Rollout) {
+	rollout.Updated = time.Now()
+	mutex_rollout.Lock()
+	rollouts[rollout.Service] = rollout
+	mutex_rollout.Unlock()
+}
+
+func getInstanceImage(id string) string {
+	info, err := container.Docker().Client.InspectContainer(id)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"instance": id,
+			"err":      err,
+		}).Warnln("Cannot get instance image")
+		return ""
+	}
+
+	return info.Config.Image
+}
@@ -0,0 +1,342 @@
+package executor
+
+import (
+	"errors"
+	"time"
+
+	log "github.com/elleFlorio/gru/Godeps/_workspace/src/github.com/Sirupsen/logrus"
+
+	"github.com/elleFlorio/gru/autonomic/executor/action"
+	cfg "github.com/elleFlorio/gru/configuration"
+	"github.com/elleFlorio/gru/data"
+	"github.com/elleFlorio/gru/enum"
+	"github.com/elleFlorio/gru/service"
+	"github.com/elleFlorio/gru/utils"
+)
+
+const c_DEFAULT_ACTION_TIMEOUT = 60
+
+var (
+	ErrActionTimeout       error = errors.New("Action timed out")
+	ErrMissingDependencies error = errors.New("Service dependencies not running")
+	ErrNotCompensable      error = errors.New("Action cannot be compensated")
+
+	getActionExecutor = action.Get
+	retryDelay        = time.Second
+)
+
+type operation struct {
+	target *cfg.Service
+	action enum.Action
+}
+
+type step struct {
+	operation
+	instance string
+	// The instance has been created by the step
+	created bool
+}
+
+type compensation struct {
+	step
+	config action.Action
+}
+
+// The actions of a policy are executed as a unit: if an action fails, the
+// actions already completed are compensated in reverse order. The outcome
+// is partial if some completed action cannot be compensated.
+func executeTransaction(name string, operations []operation) data.Execution {
+	execution := data.Execution{
+		Policy:        name,
+		Timestamp:     time.Now(),
+		Outcome:       data.OutcomeSuccess,
+		Steps:         []data.ExecutionStep{},
+		Compensations: []data.ExecutionStep{},
+	}
+
+	completed := []step{}
+	stopped := make(map[string][]string)
+	for _, op := range operations {
+		config := buildConfig(op.target, op.action)
+		prepareInstances(&config, op.action, stopped[op.target.Name], completed)
+		current := step{op, instanceOf(op.action, config.Instances), false}
+
+		var attempts int
+		var err error
+		if op.action == enum.START && len(service.MissingDependencies(op.target.Name)) > 0 {
+			err = ErrMissingDependencies
+		} else {
+			attempts, err = runAction(op.action, config, compensateLate(name, current, config))
+		}
+
+		current = withCreated(current, config)
+		execution.Steps = append(execution.Steps, newExecutionStep(current, attempts, err))
+		if err != nil {
+			log.WithFields(log.Fields{
+				"policy": name,
+				"target": op.target.Name,
+				"action": op.action.ToString(),
+				"err":    err,
+			}).Errorln("Action not executed, rolling back")
+			execution.Outcome = rollback(completed, &execution)
+			return execution
+		}
+
+		log.WithFields(log.Fields{
+			"target": op.target.Name,
+			"action": op.action.ToString(),
+		}).Infoln("Action executed")
+
+		completed = append(completed, current)
+		if op.action == enum.STOP {
+			stopped[op.target.Name] = append(stopped[op.target.Name], current.instance)
+		}
+	}
+
+	return execution
+}
+
+// The status of the instances is updated asynchronously by the monitor, so
+// the instances are adjusted according to the actions already executed.
+func prepareInstances(config *action.Action, act enum.Action, stopped []string, completed []step) {
+	switch act {
+	case enum.STOP:
+		config.Instances = excludeInstances(config.Instances, stopped)
+	case enum.REMOVE:
+		toRemove := []string{}
+		for _, ids := range [][]string{stopped, config.Instances.Stopped} {
+			for _, id := range ids {
+				if !utils.ContainsString(toRemove, id) && !isRemoved(id, completed) {
+					toRemove = append(toRemove, id)
+				}
+			}
+		}
+		config.Instances.Stopped = toRemove
+	}
+}
+
+func instanceOf(act enum.Action, instances cfg.ServiceStatus) string {
+	switch act {
+	case enum.STOP:
+		return nextToStop(instances)
+	case enum.REMOVE:
+		if len(instances.Stopped) > 0 {
+			return instances.Stopped[0]
+		}
+	case enum.START:
+		// An empty instance means that a new container is created
+		if len(instances.Paused) > 0 {
+			return instances.Paused[0]
+		}
+		if len(instances.Stopped) > 0 {
+			return instances.Stopped[0]
+		}
+	}
+
+	return ""
+}
+
+// A START without an instance to start creates a new container, that is
+// reported in the result of the action.
+func withCreated(s step, config action.Action) step {
+	if s.action == enum.START && s.instance == "" && config.Result != nil && config.Result.Instance != "" {
+		s.instance = config.Result.Instance
+		s.created = true
+	}
+
+	return s
+}
+
+// The late function receives the result of an action that timed out, when
+// it ends.
+func runAction(act enum.Action, config action.Action, late func(error)) (int, error) {
+	retries := cfg.GetAgentAutonomic().ActionRetries
+	timeout := cfg.GetAgentAutonomic().ActionTimeout
+	if timeout <= 0 {
+		timeout = c_DEFAULT_ACTION_TIMEOUT
+	}
+
+	actExecutor := getActionExecutor(act)
+	if preparer, ok := actExecutor.(action.Preparer); ok {
+		if err := preparer.Prepare(config); err != nil {
+			return 0, err
+		}
+	}
+
+	attempt := 1
+	for {
+		err := runWithTimeout(actExecutor, config, time.Duration(timeout)*time.Second, late)
+		// An action that timed out could still be running, so it is not retried
+		if err == nil || err == ErrActionTimeout || attempt > retries {
+			return attempt, err
+		}
+
+		log.WithFields(log.Fields{
+			"action":  act.ToString(),
+			"attempt": attempt,
+			"err":     err,
+		}).Warnln("Action failed, retrying")
+		time.Sleep(retryDelay)
+		attempt++
+	}
+}
+
+// An action cannot be interrupted once it started, so after the timeout it
+// is left running and ErrActionTimeout is returned. Its result is collected
+// in background and passed to late, if any.
+func runWithTimeout(actExecutor action.ActionExecutor, config action.Action, timeout time.Duration, late func(error)) error {
+	ch_done := make(chan error, 1)
+	go func() {
+		ch_done <- actExecutor.Run(config)
+	}()
+
+	select {
+	case err := <-ch_done:
+		return err
+	case <-time.After(timeout):
+	}
+
+	log.WithFields(log.Fields{
+		"service": config.Service,
+		"action":  actExecutor.Type().ToString(),
+	}).Warnln("Action timed out")
+	go func() {
+		err := <-ch_done
+		log.WithFields(log.Fields{
+			"service": config.Service,
+			"action":  actExecutor.Type().ToString(),
+			"err":     err,
+		}).Infoln("Action ended after the timeout")
+		if late != nil {
+			late(err)
+		}
+	}()
+
+	return ErrActionTimeout
+}
+
+// The action that timed out is compensated when it ends, if it succeeded,
+// while the actions completed before it are compensated by the rollback.
+func compensateLate(name string, timedOut step, config action.Action) func(error) {
+	return func(err error) {
+		if err != nil {
+			return
+		}
+
+		done := withCreated(timedOut, config)
+		late := data.Execution{Compensations: []data.ExecutionStep{}}
+		if compensate(done, &late) {
+			log.WithFields(log.Fields{
+				"policy": name,
+				"target": done.target.Name,
+				"action": done.action.ToString(),
+			}).Infoln("Action timed out compensated")
+		}
+	}
+}
+
+func rollback(completed []step, execution *data.Execution) string {
+	outcome := data.OutcomeRolledBack
+	for i := len(completed) - 1; i >= 0; i-- {
+		done := completed[i]
+		if done.action == enum.NOACTION {
+			continue
+		}
+		// The stopped container has been removed: the compensation of
+		// the removal starts a new instance of the service
+		if done.action == enum.STOP && isRemoved(done.instance, completed) {
+			continue
+		}
+
+		if !compensate(done, execution) {
+			outcome = data.OutcomePartial
+		}
+	}
+
+	return outcome
+}
+
+// The compensations of the step are executed in order, stopping at the
+// first one that fails.
+func compensate(done step, execution *data.Execution) bool {
+	compensations, err := buildCompensation(done)
+	for _, c := range compensations {
+		attempts := 0
+		if err == nil {
+			attempts, err = runAction(c.action, c.config, nil)
+		}
+
+		execution.Compensations = append(execution.Compensations, newExecutionStep(c.step, attempts, err))
+		if err != nil {
+			log.WithFields(log.Fields{
+				"target": done.target.Name,
+				"action": done.action.ToString(),
+				"err":    err,
+			}).Errorln("Cannot compensate action")
+			return false
+		}
+	}
+
+	return true
+}
+
+// A STOP is compensated starting the same container, a REMOVE starting a
+// new instance of the service and a START stopping the started container,
+// that is also removed if it was created by the START.
+func buildCompensation(done step) ([]compensation, error) {
+	switch done.action {
+	case enum.STOP:
+		config := buildConfig(done.target, enum.START)
+		config.Instances = cfg.ServiceStatus{Stopped: []string{done.instance}}
+		return []compensation{newCompensation(done, enum.START, config)}, nil
+	case enum.REMOVE:
+		config := buildConfig(done.target, enum.START)
+		config.Instances = cfg.ServiceStatus{}
+		started := newCompensation(done, enum.START, config)
+		started.instance = ""
+		return []compensation{started}, nil
+	case enum.START:
+		config := buildConfig(done.target, enum.STOP)
+		config.Instances = cfg.ServiceStatus{Running: []string{done.instance}}
+		stopped := newCompensation(done, enum.STOP, config)
+		if done.instance == "" {
+			return []compensation{stopped}, ErrNotCompensable
+		}
+		if !done.created {
+			return []compensation{stopped}, nil
+		}
+		config = buildConfig(done.target, enum.REMOVE)
+		config.Instances = cfg.ServiceStatus{Stopped: []string{done.instance}}
+		return []compensation{stopped, newCompensation(done, enum.REMOVE, config)}, nil
+	}
+
+	return []compensation{newCompensation(done, enum.NOACTION, action.Action{})}, ErrNotCompensable
+}
+
+func newCompensation(done step, act enum.Action, config action.Action) compensation {
+	return compensation{step{operation{done.target, act}, done.instance, false}, config}
+}
+
+func isRemoved(instance string, completed []step) bool {
+	for _, done := range completed {
+		if done.action == enum.REMOVE && done.instance == instance {
+			return true
+		}
+	}
+
+	return false
+}
+
+func newExecutionStep(s step, attempts int, err error) data.ExecutionStep {
+	executionStep := data.ExecutionStep{
+		Target:   s.target.Name,
+		Action:   s.action.ToString(),
+		Instance: s.instance,
+		Attempts: attempts,
+	}
+	if err != nil {
+		executionStep.Error = err.Error()
+	}
+
+	return executionStep
+}
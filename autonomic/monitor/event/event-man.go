@@ -53,7 +53,7 @@ func HandleStopEvent(e Event) {
 func HandleRemoveEvent(e Event) {
 	freeServiceInstanceResources(e.Service, e.Instance)
 	removeInstance(e.Service, e.Instance)
-	notifyRemoval()
+	chn.NotifyRemoval(e.Instance)
 }
 
 func GetEventsStats() data.EventStats {
@@ -151,13 +151,3 @@ func removeInstance(name string, instance string) {
 
 	srv.RemoveInstanceAddress(instance)
 }
-
-func notifyRemoval() {
-	log.Debugln("Checking removal notification...")
-	if chn.NeedsRemovalNotification() {
-		log.Debugln("Needs removal notification. Sending message...")
-		chn.GetRemovalChannel() <- struct{}{}
-		log.Debugln("Removal notified")
-		chn.SetRemovalNotification(false)
-	}
-}
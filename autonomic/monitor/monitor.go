@@ -97,12 +97,12 @@ func initiailizeMonitoring() {
 	for _, c := range containers {
 		info, _ := container.Docker().Client.InspectContainer(c.Id)
 		status := getContainerStatus(info)
-		service, err := srv.GetServiceByImage(c.Image)
+		service, err := srv.GetServiceByContainer(c.Labels, c.Image)
 		if err != nil {
 			log.WithFields(log.Fields{
 				"err":   err,
 				"image": c.Image,
-			}).Warningln("Error monitoring service")
+			}).Debugln("Container not monitored")
 		} else {
 			e := evt.Event{
 				Service:  service.Name,
@@ -167,7 +167,7 @@ func eventCallback(event *dockerclient.Event, ec chan error, args ...interface{}
 		return
 	}
 
-	service, err := srv.GetServiceByImage(event.From)
+	service, err := getEventService(event)
 	if err != nil {
 		log.WithFields(log.Fields{
 			"err":   err,
@@ -226,6 +226,22 @@ func eventCallback(event *dockerclient.Event, ec chan error, args ...interface{}
 
 }
 
+// The labels of the container are in the attributes of the event. If the
+// daemon does not send them, they are read from the container, or the
+// instance is looked up if the container has already been destroyed.
+func getEventService(event *dockerclient.Event) (*cfg.Service, error) {
+	labels := event.Actor.Attributes
+	if !srv.IsLabelled(labels) {
+		info, err := container.Docker().Client.InspectContainer(event.ID)
+		if err != nil {
+			return srv.GetServiceById(event.ID)
+		}
+		labels = info.Config.Labels
+	}
+
+	return srv.GetServiceByContainer(labels, event.From)
+}
+
 func startMonitorLog(id string) {
 	var optionsLog = dockerclient.LogOptions{Follow: true, Stdout: true, Stderr: true, Tail: 1}
 	contLog, err := container.Docker().Client.ContainerLogs(id, &optionsLog)
@@ -0,0 +1,114 @@
+package planner
+
+import (
+	"math"
+	"math/rand"
+	"time"
+
+	log "github.com/elleFlorio/gru/Godeps/_workspace/src/github.com/Sirupsen/logrus"
+
+	"github.com/elleFlorio/gru/cluster"
+	"github.com/elleFlorio/gru/data"
+)
+
+const c_QUOTA_MAX_ACTORS = 3.0
+
+var (
+	gen *rand.Rand
+
+	acquireLease  = cluster.AcquireServiceLease
+	releaseLease  = cluster.ReleaseServiceLease
+	countNodes    = countActiveNodes
+	randomUniform = func() float64 { return gen.Float64() }
+)
+
+func init() {
+	source := rand.NewSource(time.Now().UnixNano())
+	gen = rand.New(source)
+}
+
+// All the nodes see the same cluster data, so they tend to choose the same
+// policy in the same loop. The coordination limits the number of nodes that
+// actuate a policy on the same services:
+// - lease: only the node holding the lease on all the targets can act;
+// - quota: each node acts with a probability proportional to the weight.
+func coordinate(policies []data.Policy, mode string, window int) []data.Policy {
+	if mode != "lease" && mode != "quota" {
+		return policies
+	}
+
+	allowed := make([]data.Policy, 0, len(policies))
+	held := make(map[string]bool)
+	nNodes := 0
+	if mode == "quota" {
+		nNodes = countNodes()
+	}
+
+	for _, plc := range policies {
+		if plc.Name == "noaction" {
+			allowed = append(allowed, plc)
+			continue
+		}
+
+		var canAct bool
+		switch mode {
+		case "lease":
+			canAct = holdLeases(plc.Targets, window, held)
+		case "quota":
+			canAct = randomUniform() < quotaProbability(plc.Weight, nNodes)
+		}
+
+		if canAct {
+			allowed = append(allowed, plc)
+		} else {
+			log.WithFields(log.Fields{
+				"name":         plc.Name,
+				"targets":      plc.Targets,
+				"coordination": mode,
+			}).Infoln("Policy discarded by coordination")
+		}
+	}
+
+	return allowed
+}
+
+// The leases are acquired on all the targets or on none: if a target is
+// held by another node the leases already acquired are released, so the
+// other targets are not blocked until the leases expire. The leases needed
+// by the policies already allowed in the loop are kept.
+func holdLeases(targets []string, window int, held map[string]bool) bool {
+	for i, target := range targets {
+		if !acquireLease(target, window) {
+			for _, acquired := range targets[:i] {
+				if !held[acquired] {
+					releaseLease(acquired)
+				}
+			}
+			return false
+		}
+	}
+
+	for _, target := range targets {
+		held[target] = true
+	}
+
+	return true
+}
+
+func quotaProbability(weight float64, nNodes int) float64 {
+	if nNodes <= 1 {
+		return 1.0
+	}
+
+	needed := math.Max(1.0, weight*c_QUOTA_MAX_ACTORS)
+	return math.Min(1.0, needed/float64(nNodes))
+}
+
+func countActiveNodes() int {
+	myCluster, err := cluster.GetMyCluster()
+	if err != nil {
+		return 1
+	}
+
+	return len(cluster.ListNodes(myCluster.Name, true))
+}
@@ -0,0 +1,69 @@
+package planner
+
+import (
+	"testing"
+
+	"github.com/elleFlorio/gru/Godeps/_workspace/src/github.com/stretchr/testify/assert"
+
+	"github.com/elleFlorio/gru/cluster"
+	"github.com/elleFlorio/gru/data"
+	"github.com/elleFlorio/gru/enum"
+)
+
+func TestCoordinate(t *testing.T) {
+	defer func() {
+		acquireLease = cluster.AcquireServiceLease
+		releaseLease = cluster.ReleaseServiceLease
+		countNodes = countActiveNodes
+		randomUniform = func() float64 { return gen.Float64() }
+	}()
+
+	scaleout := data.CreateMockPolicy("scaleout", 0.9, []string{"service1"},
+		map[string][]enum.Action{"service1": []enum.Action{enum.START}})
+	swap := data.CreateMockPolicy("swap", 0.6, []string{"service2", "service3"},
+		map[string][]enum.Action{
+			"service2": []enum.Action{enum.STOP},
+			"service3": []enum.Action{enum.START},
+		})
+	noaction := data.CreateMockPolicy("noaction", 0.1, []string{"noservice"},
+		map[string][]enum.Action{"noservice": []enum.Action{enum.NOACTION}})
+	policies := []data.Policy{scaleout, swap, noaction}
+
+	assert.Len(t, coordinate(policies, "none", 10), 3)
+	assert.Len(t, coordinate(policies, "", 10), 3)
+
+	leases := map[string]bool{"service1": true, "service2": true}
+	released := []string{}
+	acquireLease = func(srv string, ttl int) bool { return leases[srv] }
+	releaseLease = func(srv string) { released = append(released, srv) }
+	allowed := coordinate(policies, "lease", 10)
+	assert.Len(t, allowed, 2)
+	assert.Equal(t, "scaleout", allowed[0].Name)
+	assert.Equal(t, "noaction", allowed[1].Name)
+	assert.Equal(t, []string{"service2"}, released)
+
+	// The lease of a policy already allowed is not released
+	released = []string{}
+	scaleout2 := data.CreateMockPolicy("scaleout", 0.8, []string{"service2"},
+		map[string][]enum.Action{"service2": []enum.Action{enum.START}})
+	allowed = coordinate([]data.Policy{scaleout2, swap}, "lease", 10)
+	assert.Len(t, allowed, 1)
+	assert.Empty(t, released)
+
+	countNodes = func() int { return 10 }
+	randomUniform = func() float64 { return 0.2 }
+	allowed = coordinate(policies, "quota", 10)
+	assert.Len(t, allowed, 2)
+	assert.Equal(t, "scaleout", allowed[0].Name)
+
+	countNodes = func() int { return 1 }
+	randomUniform = func() float64 { return 0.99 }
+	assert.Len(t, coordinate(policies, "quota", 10), 3)
+}
+
+func TestQuotaProbability(t *testing.T) {
+	assert.Equal(t, 1.0, quotaProbability(0.1, 1))
+	assert.Equal(t, 1.0, quotaProbability(1.0, 3))
+	assert.InDelta(t, 0.1, quotaProbability(0.1, 10), 0.0001)
+	assert.InDelta(t, 0.3, quotaProbability(1.0, 10), 0.0001)
+}
@@ -2,15 +2,25 @@ package planner
 
 import (
 	"fmt"
+	"sort"
+	"time"
 
 	log "github.com/elleFlorio/gru/Godeps/_workspace/src/github.com/Sirupsen/logrus"
 
 	"github.com/elleFlorio/gru/autonomic/planner/policy"
 	"github.com/elleFlorio/gru/autonomic/planner/strategy"
+	cfg "github.com/elleFlorio/gru/configuration"
 	"github.com/elleFlorio/gru/data"
+	"github.com/elleFlorio/gru/enum"
+	"github.com/elleFlorio/gru/resources"
+	"github.com/elleFlorio/gru/utils"
 )
 
-var currentStrategy strategy.GruStrategy
+var (
+	currentStrategy strategy.GruStrategy
+	// The decision taken in the current loop, if any
+	currentDecision string
+)
 
 func SetPlannerStrategy(strategyName string) {
 	strtg, err := strategy.New(strategyName)
@@ -25,24 +35,217 @@ func SetPlannerStrategy(strategyName string) {
 	log.WithField("strategy", strtg.Name()).Infoln("Strategy initialized")
 }
 
-func Run(clusterData data.Shared) *data.Policy {
+func Run(clusterData data.Shared) []data.Policy {
 	log.WithField("status", "init").Debugln("Gru Planner")
 	defer log.WithField("status", "done").Debugln("Gru Planner")
 
-	var chosenPolicy *data.Policy
+	chosenPolicies := []data.Policy{}
+	currentDecision = ""
 
 	if len(clusterData.Service) == 0 {
 		log.Warnln("No cluster data for policy computation")
-		return chosenPolicy
+		return chosenPolicies
 	}
 
 	srvList := getServicesListFromClusterData(clusterData)
 	policies := policy.CreatePolicies(srvList, clusterData)
-	chosenPolicy = currentStrategy.MakeDecision(policies)
-	data.SavePolicy(*chosenPolicy)
-	displayPolicy(chosenPolicy)
+	candidates := make([]data.Policy, len(policies))
+	copy(candidates, policies)
+	defer func() { saveDecision(candidates, chosenPolicies) }()
+
+	chosenPolicy := currentStrategy.MakeDecision(policies)
+	if chosenPolicy == nil {
+		log.Warnln("No policy chosen by the strategy")
+		return chosenPolicies
+	}
+
+	autoCfg := cfg.GetAgentAutonomic()
+	chosenPolicies = selectCompatiblePolicies(*chosenPolicy, policies, autoCfg.MaxActionsPerLoop)
+	// In advisory mode the node does not act, so it must not take the
+	// leases or the quota of the nodes that do
+	if cfg.GetAgentMode() != cfg.ModeAdvisory {
+		chosenPolicies = coordinate(chosenPolicies, autoCfg.Coordination, autoCfg.LoopTimeInterval)
+	}
+	if len(chosenPolicies) == 0 {
+		return chosenPolicies
+	}
+
+	data.SavePolicy(chosenPolicies[0])
+	for i := range chosenPolicies {
+		displayPolicy(&chosenPolicies[i])
+	}
+
+	return chosenPolicies
+}
+
+// The policy chosen by the strategy is always the first one. Other policies
+// are added in order of weight if they don't act on the same services of
+// the ones already selected, if they don't need the same host ports and if
+// the node has enough resources for all of them.
+func selectCompatiblePolicies(chosen data.Policy, policies []data.Policy, maxActions int) []data.Policy {
+	selected := []data.Policy{chosen}
+	if maxActions <= 1 || chosen.Name == "noaction" {
+		return selected
+	}
+
+	usedTargets := make(map[string]bool)
+	for _, target := range chosen.Targets {
+		usedTargets[target] = true
+	}
+	cpu, mem := computeRequirements(chosen)
+	claimedPorts := make(map[string]bool)
+	claimPorts(chosen, claimedPorts)
+
+	candidates := make([]data.Policy, len(policies))
+	copy(candidates, policies)
+	sort.Sort(sort.Reverse(byWeight(candidates)))
+
+	for _, candidate := range candidates {
+		if len(selected) >= maxActions {
+			break
+		}
+
+		if candidate.Weight <= 0 || candidate.Name == "noaction" {
+			continue
+		}
+
+		if hasConflicts(candidate, usedTargets) {
+			continue
+		}
+
+		candCpu, candMem := computeRequirements(candidate)
+		if !resources.CheckResourcesAvailable(cpu+candCpu, mem+candMem) {
+			log.WithFields(log.Fields{
+				"name":    candidate.Name,
+				"targets": candidate.Targets,
+			}).Debugln("Not enough resources for policy")
+			continue
+		}
+
+		if !claimPorts(candidate, claimedPorts) {
+			log.WithFields(log.Fields{
+				"name":    candidate.Name,
+				"targets": candidate.Targets,
+			}).Debugln("Host ports of policy already used")
+			continue
+		}
+
+		selected = append(selected, candidate)
+		cpu += candCpu
+		mem += candMem
+		for _, target := range candidate.Targets {
+			usedTargets[target] = true
+		}
+	}
+
+	return selected
+}
+
+func hasConflicts(plc data.Policy, usedTargets map[string]bool) bool {
+	for _, target := range plc.Targets {
+		if usedTargets[target] {
+			return true
+		}
+	}
+
+	return false
+}
 
-	return chosenPolicy
+// The ports are claimed only if all the START actions of the policy can
+// have them.
+func claimPorts(plc data.Policy, claimed map[string]bool) bool {
+	claiming := make(map[string]bool, len(claimed))
+	for port := range claimed {
+		claiming[port] = true
+	}
+
+	for _, target := range plc.Targets {
+		for _, act := range plc.Actions[target] {
+			if act == enum.START && !resources.ClaimPortsForService(target, claiming) {
+				return false
+			}
+		}
+	}
+
+	for port := range claiming {
+		claimed[port] = true
+	}
+
+	return true
+}
+
+// Resources released by the STOP actions of a policy are used by the START
+// ones of the same policy (e.g. swap), so only the positive balance is counted.
+func computeRequirements(plc data.Policy) (int64, int64) {
+	var cpu, mem int64
+	for _, target := range plc.Targets {
+		srvCpu, srvMem, err := resources.GetServiceRequirements(target)
+		if err != nil {
+			continue
+		}
+
+		for _, act := range plc.Actions[target] {
+			switch act {
+			case enum.START:
+				cpu += srvCpu
+				mem += srvMem
+			case enum.STOP:
+				cpu -= srvCpu
+				mem -= srvMem
+			}
+		}
+	}
+
+	if cpu < 0 {
+		cpu = 0
+	}
+	if mem < 0 {
+		mem = 0
+	}
+
+	return cpu, mem
+}
+
+type byWeight []data.Policy
+
+func (p byWeight) Len() int           { return len(p) }
+func (p byWeight) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
+func (p byWeight) Less(i, j int) bool { return p[i].Weight < p[j].Weight }
+
+func saveDecision(candidates []data.Policy, chosen []data.Policy) {
+	id, err := utils.GenerateUUID()
+	if err != nil {
+		id = fmt.Sprintf("%d", time.Now().UnixNano())
+	}
+
+	decision := data.Decision{
+		ID:         id,
+		Timestamp:  time.Now(),
+		Strategy:   currentStrategy.Name(),
+		Threshold:  strategy.LastThreshold(),
+		Candidates: candidates,
+		Chosen:     chosen,
+	}
+
+	data.SaveDecision(decision)
+	currentDecision = id
+}
+
+// The outcomes are attached only to the decision taken in the same loop
+func RecordOutcomes(outcomes []data.Execution) {
+	for _, outcome := range outcomes {
+		if outcome.Outcome != data.OutcomeSuccess {
+			log.WithFields(log.Fields{
+				"policy":  outcome.Policy,
+				"outcome": outcome.Outcome,
+			}).Warnln("Policy not executed")
+		}
+	}
+
+	if currentDecision == "" {
+		return
+	}
+	data.SaveDecisionOutcomes(currentDecision, outcomes)
 }
 
 func getServicesListFromClusterData(clusterData data.Shared) []string {
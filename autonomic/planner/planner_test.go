@@ -4,6 +4,11 @@ import (
 	"testing"
 
 	"github.com/elleFlorio/gru/Godeps/_workspace/src/github.com/stretchr/testify/assert"
+
+	"github.com/elleFlorio/gru/data"
+	"github.com/elleFlorio/gru/enum"
+	"github.com/elleFlorio/gru/resources"
+	"github.com/elleFlorio/gru/service"
 )
 
 func TestSetPlannerStrategy(t *testing.T) {
@@ -20,3 +25,51 @@ func TestSetPlannerStrategy(t *testing.T) {
 	SetPlannerStrategy(notSupported)
 	assert.Equal(t, "dummy", currentStrategy.Name(), "(notsupported) Current strategy should be dummy")
 }
+
+func TestSelectCompatiblePolicies(t *testing.T) {
+	defer service.ClearMockServices()
+	defer resources.CleanResources()
+	service.SetMockServices()
+	resources.CreateMockResources(4, "4G", 0, "0G")
+
+	startS1 := data.CreateMockPolicy("scaleout", 0.8, []string{"service1"},
+		map[string][]enum.Action{"service1": []enum.Action{enum.START}})
+	stopS1 := data.CreateMockPolicy("scalein", 0.7, []string{"service1"},
+		map[string][]enum.Action{"service1": []enum.Action{enum.STOP}})
+	startS2 := data.CreateMockPolicy("scaleout", 0.6, []string{"service2"},
+		map[string][]enum.Action{"service2": []enum.Action{enum.START}})
+	startS3 := data.CreateMockPolicy("scaleout", 0.5, []string{"service3"},
+		map[string][]enum.Action{"service3": []enum.Action{enum.START}})
+	zero := data.CreateMockPolicy("scalein", 0.0, []string{"service3"},
+		map[string][]enum.Action{"service3": []enum.Action{enum.STOP}})
+	noaction := data.CreateMockPolicy("noaction", 0.9, []string{"noservice"},
+		map[string][]enum.Action{"noservice": []enum.Action{enum.NOACTION}})
+	policies := []data.Policy{zero, startS3, stopS1, startS2, noaction, startS1}
+
+	selected := selectCompatiblePolicies(startS1, policies, 1)
+	assert.Len(t, selected, 1)
+	assert.Equal(t, startS1, selected[0])
+
+	selected = selectCompatiblePolicies(noaction, policies, 3)
+	assert.Len(t, selected, 1)
+	assert.Equal(t, "noaction", selected[0].Name)
+
+	selected = selectCompatiblePolicies(startS1, policies, 3)
+	assert.Len(t, selected, 3)
+	assert.Equal(t, startS1, selected[0])
+	assert.Equal(t, startS2, selected[1])
+	assert.Equal(t, startS3, selected[2])
+
+	resources.CreateMockResources(4, "4G", 2, "0G")
+	selected = selectCompatiblePolicies(startS1, policies, 3)
+	assert.Len(t, selected, 2)
+	assert.Equal(t, startS3, selected[1])
+
+	// The new instances of service1 and service2 would bind the same host port
+	resources.CreateMockResources(4, "4G", 0, "0G")
+	resources.InitializeServiceAvailablePorts("service1", map[string]string{"80": "8080"})
+	resources.InitializeServiceAvailablePorts("service2", map[string]string{"80": "8080"})
+	selected = selectCompatiblePolicies(startS1, policies, 3)
+	assert.Len(t, selected, 2)
+	assert.Equal(t, startS3, selected[1])
+}
@@ -0,0 +1,141 @@
+package policy
+
+import (
+	log "github.com/elleFlorio/gru/Godeps/_workspace/src/github.com/Sirupsen/logrus"
+
+	cfg "github.com/elleFlorio/gru/configuration"
+	"github.com/elleFlorio/gru/data"
+	"github.com/elleFlorio/gru/enum"
+)
+
+const (
+	c_REASON_CPU_MAX = "node cpu above cpumax"
+	c_REASON_MEM_MAX = "node memory above memmax"
+	c_REASON_CPU_MIN = "node cpu under cpumin"
+	c_REASON_MEM_MIN = "node memory under memmin"
+)
+
+// The usage of the node can be replaced to test the constraints
+var nodeUsage = localNodeUsage
+
+func localNodeUsage() (float64, float64, bool) {
+	local, err := data.GetSharedLocal()
+	if err != nil {
+		return 0.0, 0.0, false
+	}
+
+	cpu, okCpu := local.System.Data.BaseShared[enum.METRIC_CPU_AVG.ToString()]
+	mem, okMem := local.System.Data.BaseShared[enum.METRIC_MEM_AVG.ToString()]
+
+	return cpu, mem, okCpu || okMem
+}
+
+// A node above the max constraints cannot start new instances and should
+// scale-in (or swap) to offload; a node under the min constraints should
+// scale-in to consolidate the instances in the other nodes of the cluster.
+// The policies disabled by the schedule are left untouched, so the node
+// constraints cannot bring a service outside its scheduled range.
+func applyNodeConstraints(policies []data.Policy) {
+	cpu, mem, ok := nodeUsage()
+	if !ok {
+		return
+	}
+
+	constraints := cfg.GetNodeConstraints()
+	reason := ""
+	if constraints.CpuMax > 0.0 && cpu > constraints.CpuMax {
+		reason = c_REASON_CPU_MAX
+	} else if constraints.MemMax > 0.0 && mem > constraints.MemMax {
+		reason = c_REASON_MEM_MAX
+	}
+
+	pressure := maxFloat(
+		overUsage(cpu, constraints.CpuMax),
+		overUsage(mem, constraints.MemMax),
+		underUsage(cpu, constraints.CpuMin),
+		underUsage(mem, constraints.MemMin),
+	)
+
+	if reason == "" && pressure == 0.0 {
+		return
+	}
+
+	// The scale-in is driven by the constraint with the highest pressure
+	pressureReason := reason
+	if pressureReason == "" {
+		pressureReason = c_REASON_CPU_MIN
+		if underUsage(mem, constraints.MemMin) > underUsage(cpu, constraints.CpuMin) {
+			pressureReason = c_REASON_MEM_MIN
+		}
+	}
+
+	log.WithFields(log.Fields{
+		"cpu":      cpu,
+		"memory":   mem,
+		"pressure": pressure,
+	}).Debugln("Applying node constraints")
+
+	for i, plc := range policies {
+		switch {
+		case plc.Reason == c_REASON_SCHEDULE:
+			continue
+		case reason != "" && startsInstances(plc):
+			policies[i].Weight = 0.0
+			policies[i].Reason = reason
+		case plc.Name == "scalein" && plc.Reason != c_REASON_NO_INSTANCES && plc.Reason != c_REASON_BASE_SERVICE:
+			policies[i].Weight = plc.Weight + (1.0-plc.Weight)*pressure
+			if policies[i].Inputs == nil {
+				policies[i].Inputs = map[string]float64{}
+			}
+			policies[i].Inputs["nodeconstraints"] = pressure
+			if policies[i].Weight > 0.0 {
+				policies[i].Reason = pressureReason
+			}
+		}
+	}
+}
+
+// Swap policies release at least the resources they use, so they are not
+// considered as policies that start new instances.
+func startsInstances(plc data.Policy) bool {
+	if plc.Name == "swap" {
+		return false
+	}
+
+	for _, actions := range plc.Actions {
+		for _, act := range actions {
+			if act == enum.START {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func overUsage(value float64, max float64) float64 {
+	if max <= 0.0 || max >= 1.0 || value <= max {
+		return 0.0
+	}
+
+	return (value - max) / (1.0 - max)
+}
+
+func underUsage(value float64, min float64) float64 {
+	if min <= 0.0 || value >= min {
+		return 0.0
+	}
+
+	return (min - value) / min
+}
+
+func maxFloat(values ...float64) float64 {
+	max := 0.0
+	for _, value := range values {
+		if value > max {
+			max = value
+		}
+	}
+
+	return max
+}
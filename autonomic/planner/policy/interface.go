@@ -5,6 +5,18 @@ import (
 	"github.com/elleFlorio/gru/enum"
 )
 
+const (
+	c_REASON_NO_INSTANCES = "no running instances"
+	c_REASON_BASE_SERVICE = "base service protection"
+	c_REASON_NO_RESOURCES = "not enough resources"
+	c_REASON_NO_CORES     = "requested cores not available"
+	c_REASON_FREE_RES     = "resources available without swap"
+	c_REASON_NO_PORTS     = "ports not available"
+	c_REASON_NOT_FREED    = "removed instances do not free enough resources"
+	c_REASON_NO_THRESHOLD = "threshold not met"
+	c_REASON_DEPENDENCIES = "dependencies not running"
+)
+
 type policyCreator interface {
 	getPolicyName() string
 	createPolicies([]string, data.Shared) []data.Policy
@@ -18,6 +30,7 @@ func init() {
 		&scaleoutCreator{},
 		&scaleinCreator{},
 		&swapCreator{},
+		&scheduleCreator{},
 	}
 }
 
@@ -47,6 +60,8 @@ func CreatePolicies(srvList []string, clusterData data.Shared) []data.Policy {
 		creatorPolicies := creator.createPolicies(srvList, clusterData)
 		policies = append(policies, creatorPolicies...)
 	}
+	applySchedule(policies)
+	applyNodeConstraints(policies)
 
 	noaction := createNoActionPolicy(policies)
 	policies = append(policies, noaction)
@@ -54,6 +69,14 @@ func CreatePolicies(srvList []string, clusterData data.Shared) []data.Policy {
 	return policies
 }
 
+func zeroReason(weight float64) string {
+	if weight <= 0.0 {
+		return c_REASON_NO_THRESHOLD
+	}
+
+	return ""
+}
+
 func createNoActionPolicy(policies []data.Policy) data.Policy {
 	max := 0.0
 	for _, policy := range policies {
@@ -74,6 +97,7 @@ func createNoActionPolicy(policies []data.Policy) data.Policy {
 		Weight:  policyWeight,
 		Targets: policyTargets,
 		Actions: policyActions,
+		Inputs:  map[string]float64{"maxweight": max},
 	}
 
 	return noactionPolicy
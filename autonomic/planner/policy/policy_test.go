@@ -2,6 +2,7 @@ package policy
 
 import (
 	"testing"
+	"time"
 
 	"github.com/elleFlorio/gru/Godeps/_workspace/src/github.com/stretchr/testify/assert"
 
@@ -120,6 +121,345 @@ func TestSwap(t *testing.T) {
 	assert.Equal(t, 0.0, w25)
 }
 
+func TestSwapMultipleInstances(t *testing.T) {
+	defer cfg.SetServices(createServices())
+	defer func() { res.GetResources().CPU.Used = 0 }()
+
+	srvA := cfg.Service{Name: "a"}
+	srvA.Instances.Running = []string{"a_1", "a_2"}
+	srvA.Docker.CPUnumber = 1
+	srvB := cfg.Service{Name: "b"}
+	srvB.Instances.Running = []string{"b_1"}
+	srvB.Docker.CPUnumber = 1
+	srvC := cfg.Service{Name: "c"}
+	srvC.Docker.CPUnumber = 3
+	cfg.SetServices([]cfg.Service{srvA, srvB, srvC})
+	res.GetResources().CPU.Used = 4
+
+	low := data.ServiceShared{Data: data.SharedData{
+		BaseShared: map[string]float64{enum.METRIC_CPU_AVG.ToString(): 0.2},
+		UserShared: map[string]float64{"LOAD": 0.5},
+	}}
+	high := data.ServiceShared{Data: data.SharedData{
+		BaseShared: map[string]float64{enum.METRIC_CPU_AVG.ToString(): 0.8},
+		UserShared: map[string]float64{"LOAD": 0.9},
+	}}
+	shared := data.Shared{Service: map[string]data.ServiceShared{"a": low, "b": low, "c": high}}
+
+	creator := &swapCreator{}
+	toRemove := creator.selectInstancesToRemove("a", "c", []string{"a", "b"}, shared)
+	assert.Equal(t, map[string]int{"a": 2, "b": 1}, toRemove)
+
+	policies := creator.createPolicies([]string{"a", "b", "c"}, shared)
+	assert.Len(t, policies, 2)
+	for _, plc := range policies {
+		assert.Len(t, plc.Targets, 3)
+		assert.Equal(t, "c", plc.Targets[2])
+		assert.Equal(t, []enum.Action{enum.STOP, enum.REMOVE, enum.STOP, enum.REMOVE}, plc.Actions["a"])
+		assert.Equal(t, []enum.Action{enum.STOP, enum.REMOVE}, plc.Actions["b"])
+		assert.Equal(t, []enum.Action{enum.START}, plc.Actions["c"])
+		assert.InDelta(t, 0.83, plc.Weight, c_EPSILON)
+	}
+
+	w, _, reason := creator.explainWeight(map[string]int{"a": 2}, "c", shared)
+	assert.Equal(t, 0.0, w)
+	assert.Equal(t, c_REASON_NOT_FREED, reason)
+
+	// The host port needed by the candidate is freed by the instance of b
+	res.InitializeServiceAvailablePorts("b", map[string]string{"80": "9000"})
+	res.InitializeServiceAvailablePorts("c", map[string]string{"80": "9000"})
+	res.AssignSpecifiPortsToService("b", "b_1", map[string][]string{"80": []string{"9000"}})
+	defer res.FreePortsFromService("b", "b_1")
+	w, _, reason = creator.explainWeight(map[string]int{"a": 2}, "c", shared)
+	assert.Equal(t, c_REASON_NO_PORTS, reason)
+	w, _, reason = creator.explainWeight(map[string]int{"a": 2, "b": 1}, "c", shared)
+	assert.InDelta(t, 0.83, w, c_EPSILON)
+
+	cfg.SetNode(cfg.Node{Constraints: cfg.NodeConstraints{BaseServices: []string{"b"}}})
+	defer cfg.SetNode(createNode())
+	w, _, reason = creator.explainWeight(map[string]int{"a": 2, "b": 1}, "c", shared)
+	assert.Equal(t, 0.0, w)
+	assert.Equal(t, c_REASON_BASE_SERVICE, reason)
+}
+
+func TestSwapCores(t *testing.T) {
+	defer cfg.SetServices(createServices())
+	defer func() { res.GetResources().CPU.Used = 0 }()
+	defer func() { res.GetResources().CPU.Cores = nil }()
+
+	srvA := cfg.Service{Name: "a"}
+	srvA.Instances.Running = []string{"a_1", "a_2"}
+	srvA.Docker.CPUnumber = 1
+	srvC := cfg.Service{Name: "c"}
+	srvC.Docker.CPUnumber = 1
+	srvC.Docker.CpusetCpus = "2"
+	cfg.SetServices([]cfg.Service{srvA, srvC})
+	res.GetResources().CPU.Cores = map[int]bool{0: true, 1: true, 2: true, 3: true}
+	res.CheckAndSetSpecificCores("0", "a_1")
+	res.CheckAndSetSpecificCores("2", "a_2")
+	defer res.FreeInstanceCores("a_1")
+	defer res.FreeInstanceCores("a_2")
+
+	shared := data.Shared{Service: map[string]data.ServiceShared{}}
+	creator := &swapCreator{}
+
+	// The node has free resources, but not the core requested by c
+	w, _, reason := creator.explainWeight(map[string]int{"a": 1}, "c", shared)
+	assert.Equal(t, 0.0, w)
+	assert.Equal(t, c_REASON_NO_CORES, reason)
+
+	res.GetResources().CPU.Used = 4
+	toRemove := creator.selectInstancesToRemove("a", "c", []string{"a"}, shared)
+	assert.Equal(t, map[string]int{"a": 2}, toRemove)
+	_, _, reason = creator.explainWeight(toRemove, "c", shared)
+	assert.NotEqual(t, c_REASON_NO_CORES, reason)
+}
+
+func TestSwapSchedule(t *testing.T) {
+	defer cfg.SetServices(createServices())
+	defer cfg.SetPolicy(createMockPolicy())
+	defer func() { now = time.Now }()
+	defer func() { res.GetResources().CPU.Used = 0 }()
+
+	srvA := cfg.Service{Name: "a"}
+	srvA.Instances.Running = []string{"a_1", "a_2"}
+	srvA.Docker.CPUnumber = 1
+	srvB := cfg.Service{Name: "b"}
+	srvB.Instances.Running = []string{"b_1"}
+	srvB.Docker.CPUnumber = 1
+	srvC := cfg.Service{Name: "c"}
+	srvC.Docker.CPUnumber = 1
+	cfg.SetServices([]cfg.Service{srvA, srvB, srvC})
+	res.GetResources().CPU.Used = 4
+
+	policy := createMockPolicy()
+	policy.Schedule = cfg.ScheduleConfig{
+		Enable: true,
+		Rules: []cfg.ScheduleRule{
+			cfg.ScheduleRule{Service: "a", Days: "daily", Start: "00:00", End: "23:59", MinInstances: 2},
+		},
+	}
+	cfg.SetPolicy(policy)
+	now = func() time.Time { return time.Date(2016, time.February, 2, 12, 0, 0, 0, time.Local) }
+
+	shared := data.Shared{Service: map[string]data.ServiceShared{}}
+	creator := &swapCreator{}
+	assert.Equal(t, 0, removableInstances("a"))
+
+	toRemove := creator.selectInstancesToRemove("b", "c", []string{"a", "b"}, shared)
+	assert.Equal(t, map[string]int{"b": 1}, toRemove)
+
+	w, _, reason := creator.explainWeight(map[string]int{"a": 1}, "c", shared)
+	assert.Equal(t, 0.0, w)
+	assert.Equal(t, c_REASON_SCHEDULE, reason)
+}
+
+func TestExplainWeight(t *testing.T) {
+	shared := createSharedData()
+	scalein := &scaleinCreator{}
+	scaleout := &scaleoutCreator{}
+
+	w, inputs, reason := scalein.explainWeight("service3", shared)
+	assert.Equal(t, 0.0, w)
+	assert.Empty(t, inputs)
+	assert.Equal(t, c_REASON_NO_INSTANCES, reason)
+
+	w, inputs, reason = scalein.explainWeight("service1", shared)
+	assert.Equal(t, 0.0, w)
+	assert.Len(t, inputs, 2)
+	assert.Contains(t, inputs, "cpu_avg")
+	assert.Contains(t, inputs, "LOAD")
+	assert.Equal(t, c_REASON_NO_THRESHOLD, reason)
+
+	res.GetResources().CPU.Used = 4
+	w, _, reason = scaleout.explainWeight("service1", shared)
+	res.GetResources().CPU.Used = 0
+	assert.Equal(t, 0.0, w)
+	assert.Equal(t, c_REASON_NO_RESOURCES, reason)
+
+	w, inputs, reason = scaleout.explainWeight("service1", shared)
+	assert.InDelta(t, 0.5, w, c_EPSILON)
+	assert.InDelta(t, 1.0, inputs["LOAD"], c_EPSILON)
+	assert.Empty(t, reason)
+}
+
+func TestSchedule(t *testing.T) {
+	defer cfg.SetPolicy(createMockPolicy())
+	defer func() { now = time.Now }()
+
+	policy := createMockPolicy()
+	policy.Schedule = cfg.ScheduleConfig{
+		Enable:   true,
+		Timezone: "UTC",
+		Rules: []cfg.ScheduleRule{
+			cfg.ScheduleRule{Service: "service1", Days: "weekdays", Start: "08:00", End: "20:00", MinInstances: 3},
+			cfg.ScheduleRule{Service: "service2", Days: "daily", Start: "22:00", End: "06:00", MaxInstances: 1},
+		},
+	}
+	cfg.SetPolicy(policy)
+	shared := createSharedData()
+	srvList := []string{"service1", "service2", "service3"}
+	creator := &scheduleCreator{}
+
+	// Monday 10:00
+	now = func() time.Time { return time.Date(2016, time.February, 1, 10, 0, 0, 0, time.UTC) }
+	policies := creator.createPolicies(srvList, shared)
+	assert.Len(t, policies, 1)
+	assert.Equal(t, "service1", policies[0].Targets[0])
+	assert.Equal(t, []enum.Action{enum.START}, policies[0].Actions["service1"])
+	assert.Equal(t, c_SCHEDULE_WEIGHT, policies[0].Weight)
+
+	res.GetResources().CPU.Used = 4
+	policies = creator.createPolicies(srvList, shared)
+	res.GetResources().CPU.Used = 0
+	assert.Equal(t, 0.0, policies[0].Weight)
+	assert.Equal(t, c_REASON_NO_RESOURCES, policies[0].Reason)
+
+	// Monday 23:00
+	now = func() time.Time { return time.Date(2016, time.February, 1, 23, 0, 0, 0, time.UTC) }
+	policies = creator.createPolicies(srvList, shared)
+	assert.Len(t, policies, 1)
+	assert.Equal(t, "service2", policies[0].Targets[0])
+	assert.Equal(t, []enum.Action{enum.STOP, enum.REMOVE}, policies[0].Actions["service2"])
+
+	// Saturday 10:00
+	now = func() time.Time { return time.Date(2016, time.February, 6, 10, 0, 0, 0, time.UTC) }
+	policies = creator.createPolicies(srvList, shared)
+	assert.Len(t, policies, 0)
+}
+
+func TestIsRuleActive(t *testing.T) {
+	night := cfg.ScheduleRule{Service: "service1", Days: "mon", Start: "22:00", End: "06:00"}
+	day := cfg.ScheduleRule{Service: "service1", Days: "mon", Start: "08:00", End: "20:00"}
+	// 1 February 2016 is a Monday
+	at := func(date int, hour int) time.Time {
+		return time.Date(2016, time.February, date, hour, 0, 0, 0, time.UTC)
+	}
+
+	assert.False(t, isRuleActive(night, at(1, 3)))
+	assert.True(t, isRuleActive(night, at(1, 23)))
+	assert.True(t, isRuleActive(night, at(2, 3)))
+	assert.False(t, isRuleActive(night, at(2, 7)))
+	assert.False(t, isRuleActive(night, at(2, 23)))
+
+	assert.True(t, isRuleActive(day, at(1, 10)))
+	assert.False(t, isRuleActive(day, at(1, 21)))
+	assert.False(t, isRuleActive(day, at(2, 10)))
+}
+
+func TestScheduleLocation(t *testing.T) {
+	defer cfg.SetPolicy(createMockPolicy())
+
+	policy := createMockPolicy()
+	policy.Schedule.Timezone = "UTC"
+	cfg.SetPolicy(policy)
+	assert.Equal(t, time.UTC, cfg.GetPolicy().Schedule.Location)
+
+	policy.Schedule.Timezone = ""
+	cfg.SetPolicy(policy)
+	assert.Equal(t, time.Local, cfg.GetPolicy().Schedule.Location)
+}
+
+func TestApplySchedule(t *testing.T) {
+	defer cfg.SetPolicy(createMockPolicy())
+	defer func() { now = time.Now }()
+
+	policy := createMockPolicy()
+	policy.Schedule = cfg.ScheduleConfig{
+		Enable: true,
+		Rules: []cfg.ScheduleRule{
+			cfg.ScheduleRule{Service: "service1", Days: "mon,tue", Start: "00:00", End: "23:59", MinInstances: 1, MaxInstances: 1},
+		},
+	}
+	cfg.SetPolicy(policy)
+	now = func() time.Time { return time.Date(2016, time.February, 2, 12, 0, 0, 0, time.Local) }
+
+	policies := []data.Policy{
+		data.CreateMockPolicy("scalein", 0.5, []string{"service1"}, nil),
+		data.CreateMockPolicy("scaleout", 0.5, []string{"service1"}, nil),
+		data.CreateMockPolicy("scaleout", 0.5, []string{"service2"}, nil),
+		data.CreateMockPolicy("scaleout", 0.5, []string{"service2", "service1"}, nil),
+	}
+	// The scale-out of service2 starts service1 as a dependency
+	policies[3].Primary = "service2"
+	applySchedule(policies)
+	assert.Equal(t, 0.0, policies[0].Weight)
+	assert.Equal(t, c_REASON_SCHEDULE, policies[0].Reason)
+	assert.Equal(t, 0.0, policies[1].Weight)
+	assert.Equal(t, 0.5, policies[2].Weight)
+	assert.Equal(t, 0.5, policies[3].Weight)
+}
+
+func TestApplyNodeConstraints(t *testing.T) {
+	defer cfg.SetNode(createNode())
+	defer func() { nodeUsage = localNodeUsage }()
+
+	node := createNode()
+	node.Constraints.CpuMin = 0.2
+	node.Constraints.CpuMax = 0.8
+	node.Constraints.MemMax = 0.9
+	cfg.SetNode(node)
+
+	createPolicies := func() []data.Policy {
+		return []data.Policy{
+			data.CreateMockPolicy("scaleout", 0.6, []string{"service1"},
+				map[string][]enum.Action{"service1": []enum.Action{enum.START}}),
+			data.CreateMockPolicy("scalein", 0.2, []string{"service1"},
+				map[string][]enum.Action{"service1": []enum.Action{enum.STOP, enum.REMOVE}}),
+			data.CreateMockPolicy("swap", 0.5, []string{"service1", "service3"},
+				map[string][]enum.Action{
+					"service1": []enum.Action{enum.STOP, enum.REMOVE},
+					"service3": []enum.Action{enum.START},
+				}),
+		}
+	}
+
+	nodeUsage = func() (float64, float64, bool) { return 0.5, 0.5, true }
+	policies := createPolicies()
+	applyNodeConstraints(policies)
+	assert.Equal(t, createPolicies(), policies)
+
+	nodeUsage = func() (float64, float64, bool) { return 0.9, 0.5, true }
+	policies = createPolicies()
+	applyNodeConstraints(policies)
+	assert.Equal(t, 0.0, policies[0].Weight)
+	assert.Equal(t, c_REASON_CPU_MAX, policies[0].Reason)
+	assert.InDelta(t, 0.6, policies[1].Weight, 0.001)
+	assert.InDelta(t, 0.5, policies[1].Inputs["nodeconstraints"], 0.001)
+	assert.Equal(t, c_REASON_CPU_MAX, policies[1].Reason)
+	assert.Equal(t, 0.5, policies[2].Weight)
+
+	nodeUsage = func() (float64, float64, bool) { return 0.5, 0.95, true }
+	policies = createPolicies()
+	applyNodeConstraints(policies)
+	assert.Equal(t, c_REASON_MEM_MAX, policies[0].Reason)
+
+	nodeUsage = func() (float64, float64, bool) { return 0.1, 0.5, true }
+	policies = createPolicies()
+	applyNodeConstraints(policies)
+	assert.Equal(t, 0.6, policies[0].Weight)
+	assert.InDelta(t, 0.6, policies[1].Weight, 0.001)
+	assert.Equal(t, c_REASON_CPU_MIN, policies[1].Reason)
+
+	// The scale-in disabled by the schedule is not boosted
+	policies = createPolicies()
+	policies[1].Weight = 0.0
+	policies[1].Reason = c_REASON_SCHEDULE
+	applyNodeConstraints(policies)
+	assert.Equal(t, 0.0, policies[1].Weight)
+	assert.Equal(t, c_REASON_SCHEDULE, policies[1].Reason)
+	assert.NotContains(t, policies[1].Inputs, "nodeconstraints")
+}
+
+func TestMatchDay(t *testing.T) {
+	assert.True(t, matchDay("daily", time.Sunday))
+	assert.True(t, matchDay("weekdays", time.Monday))
+	assert.False(t, matchDay("weekdays", time.Sunday))
+	assert.True(t, matchDay("weekends", time.Saturday))
+	assert.True(t, matchDay("mon, fri", time.Friday))
+	assert.False(t, matchDay("mon,fri", time.Tuesday))
+}
+
 func TestCreatePolicy(t *testing.T) {
 	shared := createSharedData()
 	srvList := []string{
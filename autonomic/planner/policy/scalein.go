@@ -28,7 +28,7 @@ func (p *scaleinCreator) createPolicies(srvList []string, clusterData data.Share
 
 	for _, name := range srvList {
 		policyName := p.getPolicyName()
-		policyWeight := p.computeWeight(name, clusterData)
+		policyWeight, policyInputs, policyReason := p.explainWeight(name, clusterData)
 		policyTargets := []string{name}
 		policyActions := map[string][]enum.Action{
 			name: []enum.Action{enum.STOP, enum.REMOVE},
@@ -37,8 +37,11 @@ func (p *scaleinCreator) createPolicies(srvList []string, clusterData data.Share
 		scaleinPolicy := data.Policy{
 			Name:    policyName,
 			Weight:  policyWeight,
+			Primary: name,
 			Targets: policyTargets,
 			Actions: policyActions,
+			Inputs:  policyInputs,
+			Reason:  policyReason,
 		}
 
 		scaleinPolicies = append(scaleinPolicies, scaleinPolicy)
@@ -48,17 +51,23 @@ func (p *scaleinCreator) createPolicies(srvList []string, clusterData data.Share
 }
 
 func (p *scaleinCreator) computeWeight(name string, clusterData data.Shared) float64 {
+	weight, _, _ := p.explainWeight(name, clusterData)
+	return weight
+}
+
+func (p *scaleinCreator) explainWeight(name string, clusterData data.Shared) (float64, map[string]float64, string) {
+	inputs := map[string]float64{}
 	service, _ := srv.GetServiceByName(name)
 	inst_run := len(service.Instances.Running)
 	inst_pen := len(service.Instances.Pending)
 
 	if inst_run < 1 {
-		return 0.0
+		return 0.0, inputs, c_REASON_NO_INSTANCES
 	}
 
 	baseServices := cfg.GetNodeConstraints().BaseServices
 	if (inst_pen+inst_run) <= 1 && utils.ContainsString(baseServices, name) {
-		return 0.0
+		return 0.0, inputs, c_REASON_BASE_SERVICE
 	}
 
 	policy := cfg.GetPolicy().Scalein
@@ -69,19 +78,23 @@ func (p *scaleinCreator) computeWeight(name string, clusterData data.Shared) flo
 
 	for _, metric := range metrics {
 		if value, ok := clusterData.Service[name].Data.BaseShared[metric]; ok {
-			weights = append(weights, p.computeMetricWeight(value, threshold))
+			weight := p.computeMetricWeight(value, threshold)
+			weights = append(weights, weight)
+			inputs[metric] = weight
 		}
 	}
 
 	for _, analytic := range analytics {
 		if value, ok := clusterData.Service[name].Data.UserShared[analytic]; ok {
-			weights = append(weights, p.computeMetricWeight(value, threshold))
+			weight := p.computeMetricWeight(value, threshold)
+			weights = append(weights, weight)
+			inputs[analytic] = weight
 		}
 	}
 
 	policyValue := utils.Mean(weights)
 
-	return policyValue
+	return policyValue, inputs, zeroReason(policyValue)
 }
 
 func (p *scaleinCreator) computeMetricWeight(value float64, threshold float64) float64 {
@@ -3,6 +3,8 @@ package policy
 import (
 	"math"
 
+	log "github.com/elleFlorio/gru/Godeps/_workspace/src/github.com/Sirupsen/logrus"
+
 	cfg "github.com/elleFlorio/gru/configuration"
 	"github.com/elleFlorio/gru/data"
 	"github.com/elleFlorio/gru/enum"
@@ -29,17 +31,21 @@ func (p *scaleoutCreator) createPolicies(srvList []string, clusterData data.Shar
 
 	for _, name := range srvList {
 		policyName := p.getPolicyName()
-		policyWeight := p.computeWeight(name, clusterData)
-		policyTargets := []string{name}
-		policyActions := map[string][]enum.Action{
-			name: []enum.Action{enum.START},
+		policyWeight, policyInputs, policyReason := p.explainWeight(name, clusterData)
+		policyTargets := append(p.propagateTo(name), name)
+		policyActions := map[string][]enum.Action{}
+		for _, target := range policyTargets {
+			policyActions[target] = []enum.Action{enum.START}
 		}
 
 		scaleoutPolicy := data.Policy{
 			Name:    policyName,
 			Weight:  policyWeight,
+			Primary: name,
 			Targets: policyTargets,
 			Actions: policyActions,
+			Inputs:  policyInputs,
+			Reason:  policyReason,
 		}
 
 		scaleoutPolicies = append(scaleoutPolicies, scaleoutPolicy)
@@ -49,19 +55,29 @@ func (p *scaleoutCreator) createPolicies(srvList []string, clusterData data.Shar
 }
 
 func (p *scaleoutCreator) computeWeight(name string, clusterData data.Shared) float64 {
+	weight, _, _ := p.explainWeight(name, clusterData)
+	return weight
+}
+
+func (p *scaleoutCreator) explainWeight(name string, clusterData data.Shared) (float64, map[string]float64, string) {
+	inputs := map[string]float64{}
 	service, _ := srv.GetServiceByName(name)
 
 	if res.AvailableResourcesService(name) < 1.0 {
-		return 0.0
+		return 0.0, inputs, c_REASON_NO_RESOURCES
 	}
 
 	srvCores := service.Docker.CpusetCpus
 	if srvCores != "" {
 		if !res.CheckSpecificCoresAvailable(srvCores) {
-			return 0.0
+			return 0.0, inputs, c_REASON_NO_CORES
 		}
 	}
 
+	if len(srv.MissingDependencies(name)) > 0 {
+		return 0.0, inputs, c_REASON_DEPENDENCIES
+	}
+
 	policy := cfg.GetPolicy().Scaleout
 	metrics := policy.Metrics
 	analytics := policy.Analytics
@@ -70,21 +86,62 @@ func (p *scaleoutCreator) computeWeight(name string, clusterData data.Shared) fl
 
 	for _, metric := range metrics {
 		if value, ok := clusterData.Service[name].Data.BaseShared[metric]; ok {
-			weights = append(weights, p.computeMetricWeight(value, threshold))
+			weight := p.computeMetricWeight(value, threshold)
+			weights = append(weights, weight)
+			inputs[metric] = weight
 		}
 	}
 
 	for _, analytic := range analytics {
 		if value, ok := clusterData.Service[name].Data.UserShared[analytic]; ok {
-			weights = append(weights, p.computeMetricWeight(value, threshold))
+			weight := p.computeMetricWeight(value, threshold)
+			weights = append(weights, weight)
+			inputs[analytic] = weight
 		}
 	}
 
 	policyValue := utils.Mean(weights)
 
-	return policyValue
+	return policyValue, inputs, zeroReason(policyValue)
 }
 
 func (p *scaleoutCreator) computeMetricWeight(value float64, threshold float64) float64 {
 	return (math.Max(value, threshold) - threshold) / (1 - threshold)
 }
+
+// When a service scales past PropagateAt instances, the services it depends
+// on are scaled out together with it if the node has enough resources.
+func (p *scaleoutCreator) propagateTo(name string) []string {
+	service, err := srv.GetServiceByName(name)
+	if err != nil || service.PropagateAt <= 0 || len(service.DependsOn) == 0 {
+		return []string{}
+	}
+
+	if countInstances(name)+1 <= service.PropagateAt {
+		return []string{}
+	}
+
+	cpu, mem, err := res.GetServiceRequirements(name)
+	if err != nil {
+		return []string{}
+	}
+
+	for _, dep := range service.DependsOn {
+		depCpu, depMem, err := res.GetServiceRequirements(dep)
+		if err != nil {
+			return []string{}
+		}
+		cpu += depCpu
+		mem += depMem
+	}
+
+	if !res.CheckResourcesAvailable(cpu, mem) {
+		log.WithField("service", name).Debugln("Not enough resources to propagate scale-out")
+		return []string{}
+	}
+
+	deps := make([]string, len(service.DependsOn))
+	copy(deps, service.DependsOn)
+
+	return deps
+}
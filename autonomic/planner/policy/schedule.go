@@ -0,0 +1,225 @@
+package policy
+
+import (
+	"strings"
+	"time"
+
+	log "github.com/elleFlorio/gru/Godeps/_workspace/src/github.com/Sirupsen/logrus"
+
+	cfg "github.com/elleFlorio/gru/configuration"
+	"github.com/elleFlorio/gru/data"
+	"github.com/elleFlorio/gru/enum"
+	res "github.com/elleFlorio/gru/resources"
+	srv "github.com/elleFlorio/gru/service"
+	"github.com/elleFlorio/gru/utils"
+)
+
+const c_SCHEDULE_WEIGHT = 0.9
+const c_REASON_SCHEDULE = "outside scheduled range"
+
+// The clock can be replaced to test the schedules deterministically
+var now = time.Now
+
+var weekDays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+type scheduleCreator struct{}
+
+func (p *scheduleCreator) getPolicyName() string {
+	return "schedule"
+}
+
+func (p *scheduleCreator) listActions() []string {
+	return []string{"start", "stop", "remove"}
+}
+
+func (p *scheduleCreator) createPolicies(srvList []string, clusterData data.Shared) []data.Policy {
+	schedulePolicies := []data.Policy{}
+	schedule := cfg.GetPolicy().Schedule
+	if !schedule.Enable {
+		return schedulePolicies
+	}
+
+	weight := schedule.Weight
+	if weight <= 0.0 {
+		weight = c_SCHEDULE_WEIGHT
+	}
+
+	for _, name := range srvList {
+		rule, active := activeRule(name, schedule)
+		if !active {
+			continue
+		}
+
+		var actions []enum.Action
+		count := countInstances(name)
+		switch {
+		case count < rule.MinInstances:
+			actions = []enum.Action{enum.START}
+		case rule.MaxInstances > 0 && count > rule.MaxInstances:
+			actions = []enum.Action{enum.STOP, enum.REMOVE}
+		default:
+			continue
+		}
+
+		policyWeight, policyReason := p.computeWeight(name, actions[0], weight)
+		schedulePolicy := data.Policy{
+			Name:    p.getPolicyName(),
+			Weight:  policyWeight,
+			Primary: name,
+			Targets: []string{name},
+			Actions: map[string][]enum.Action{name: actions},
+			Inputs: map[string]float64{
+				"instances":    float64(count),
+				"mininstances": float64(rule.MinInstances),
+				"maxinstances": float64(rule.MaxInstances),
+			},
+			Reason: policyReason,
+		}
+
+		schedulePolicies = append(schedulePolicies, schedulePolicy)
+	}
+
+	return schedulePolicies
+}
+
+func (p *scheduleCreator) computeWeight(name string, action enum.Action, weight float64) (float64, string) {
+	if action == enum.START {
+		if res.AvailableResourcesService(name) < 1.0 {
+			return 0.0, c_REASON_NO_RESOURCES
+		}
+
+		return weight, ""
+	}
+
+	baseServices := cfg.GetNodeConstraints().BaseServices
+	if countInstances(name) <= 1 && utils.ContainsString(baseServices, name) {
+		return 0.0, c_REASON_BASE_SERVICE
+	}
+
+	return weight, ""
+}
+
+// The reactive policies cannot bring the number of instances of a service
+// outside the range defined by the schedule active for the service.
+func applySchedule(policies []data.Policy) {
+	schedule := cfg.GetPolicy().Schedule
+	if !schedule.Enable {
+		return
+	}
+
+	for i, plc := range policies {
+		if plc.Name != "scaleout" && plc.Name != "scalein" || plc.Primary == "" {
+			continue
+		}
+
+		name := plc.Primary
+		rule, active := activeRule(name, schedule)
+		if !active {
+			continue
+		}
+
+		count := countInstances(name)
+		if plc.Name == "scalein" && count <= rule.MinInstances ||
+			plc.Name == "scaleout" && rule.MaxInstances > 0 && count >= rule.MaxInstances {
+			policies[i].Weight = 0.0
+			policies[i].Reason = c_REASON_SCHEDULE
+		}
+	}
+}
+
+// The minimum number of instances of the service required by the active
+// schedule, if any.
+func scheduledMinimum(name string) int {
+	schedule := cfg.GetPolicy().Schedule
+	if !schedule.Enable {
+		return 0
+	}
+
+	rule, active := activeRule(name, schedule)
+	if !active {
+		return 0
+	}
+
+	return rule.MinInstances
+}
+
+func activeRule(name string, schedule cfg.ScheduleConfig) (cfg.ScheduleRule, bool) {
+	location := schedule.Location
+	if location == nil {
+		location = time.Local
+	}
+
+	current := now().In(location)
+	for _, rule := range schedule.Rules {
+		if rule.Service == name && isRuleActive(rule, current) {
+			return rule, true
+		}
+	}
+
+	return cfg.ScheduleRule{}, false
+}
+
+func isRuleActive(rule cfg.ScheduleRule, current time.Time) bool {
+	start, errStart := time.Parse("15:04", rule.Start)
+	end, errEnd := time.Parse("15:04", rule.End)
+	if errStart != nil || errEnd != nil {
+		log.WithField("service", rule.Service).Warnln("Cannot parse schedule time window")
+		return false
+	}
+
+	minute := current.Hour()*60 + current.Minute()
+	startMinute := start.Hour()*60 + start.Minute()
+	endMinute := end.Hour()*60 + end.Minute()
+
+	if startMinute <= endMinute {
+		return matchDay(rule.Days, current.Weekday()) &&
+			minute >= startMinute && minute < endMinute
+	}
+
+	// The window crosses the midnight (e.g. mon 22:00-06:00): after the
+	// midnight it belongs to the day it started.
+	if minute >= startMinute {
+		return matchDay(rule.Days, current.Weekday())
+	}
+	if minute < endMinute {
+		return matchDay(rule.Days, current.AddDate(0, 0, -1).Weekday())
+	}
+
+	return false
+}
+
+func matchDay(days string, day time.Weekday) bool {
+	switch strings.ToLower(strings.TrimSpace(days)) {
+	case "", "*", "daily":
+		return true
+	case "weekdays":
+		return day != time.Saturday && day != time.Sunday
+	case "weekends":
+		return day == time.Saturday || day == time.Sunday
+	}
+
+	for _, token := range strings.Split(strings.ToLower(days), ",") {
+		if wd, ok := weekDays[strings.TrimSpace(token)]; ok && wd == day {
+			return true
+		}
+	}
+
+	return false
+}
+
+func countInstances(name string) int {
+	service, err := srv.GetServiceByName(name)
+	if err != nil {
+		return 0
+	}
+
+	return len(service.Instances.Running) + len(service.Instances.Pending)
+}
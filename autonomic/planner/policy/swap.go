@@ -2,6 +2,7 @@ package policy
 
 import (
 	"math"
+	"sort"
 
 	log "github.com/elleFlorio/gru/Godeps/_workspace/src/github.com/Sirupsen/logrus"
 
@@ -30,21 +31,38 @@ func (p *swapCreator) createPolicies(srvList []string, clusterData data.Shared)
 	}
 
 	swapPairs := p.createSwapPairs(srvList)
-	for running, inactives := range swapPairs {
+	running := make([]string, 0, len(swapPairs))
+	for name, _ := range swapPairs {
+		running = append(running, name)
+	}
+
+	for first, inactives := range swapPairs {
 		for _, inactive := range inactives {
+			toRemove := p.selectInstancesToRemove(first, inactive, running, clusterData)
 			policyName := p.getPolicyName()
-			policyWeight := p.computeWeight(running, inactive, clusterData)
-			policyTargets := []string{running, inactive}
-			policyActions := map[string][]enum.Action{
-				running:  []enum.Action{enum.STOP, enum.REMOVE},
-				inactive: []enum.Action{enum.START},
+			policyWeight, policyInputs, policyReason := p.explainWeight(toRemove, inactive, clusterData)
+			others := []string{}
+			policyActions := map[string][]enum.Action{}
+			for name, n := range toRemove {
+				if name != first {
+					others = append(others, name)
+				}
+				for i := 0; i < n; i++ {
+					policyActions[name] = append(policyActions[name], enum.STOP, enum.REMOVE)
+				}
 			}
+			sort.Strings(others)
+			policyTargets := append([]string{first}, others...)
+			policyTargets = append(policyTargets, inactive)
+			policyActions[inactive] = []enum.Action{enum.START}
 
 			swapPolicy := data.Policy{
 				Name:    policyName,
 				Weight:  policyWeight,
 				Targets: policyTargets,
 				Actions: policyActions,
+				Inputs:  policyInputs,
+				Reason:  policyReason,
 			}
 
 			swapPolicies = append(swapPolicies, swapPolicy)
@@ -76,33 +94,179 @@ func (p *swapCreator) createSwapPairs(srvList []string) map[string][]string {
 	return pairs
 }
 
+// The instances of the first service are removed first, then the ones of
+// the other running services, starting from the least loaded, until the
+// resources freed, including the cores requested by the candidate, are
+// enough to start it. Base services always keep at least one instance and
+// no service goes under the minimum of its active schedule.
+func (p *swapCreator) selectInstancesToRemove(first string, candidate string, running []string, clusterData data.Shared) map[string]int {
+	toRemove := map[string]int{}
+	candCpu, candMem, err := res.GetServiceRequirements(candidate)
+	if err != nil {
+		return toRemove
+	}
+	candService, _ := srv.GetServiceByName(candidate)
+	candCores := candService.Docker.CpusetCpus
+
+	others := make([]string, 0, len(running))
+	for _, name := range running {
+		if name != first {
+			others = append(others, name)
+		}
+	}
+	sort.Sort(byLoad{others, clusterData})
+	order := append([]string{first}, others...)
+
+	resources := res.GetResources()
+	freeCpu := resources.CPU.Total - resources.CPU.Used
+	freeMem := resources.Memory.Total - resources.Memory.Used
+	enough := func() bool {
+		if freeCpu < candCpu || freeMem < candMem {
+			return false
+		}
+		return candCores == "" ||
+			res.CheckSpecificCoresAvailableReleasing(candCores, instancesToRemove(toRemove))
+	}
+	for _, name := range order {
+		if enough() {
+			break
+		}
+
+		srvCpu, srvMem, err := res.GetServiceRequirements(name)
+		if err != nil || (srvCpu == 0 && srvMem == 0) {
+			continue
+		}
+
+		for n := 0; n < removableInstances(name); n++ {
+			if enough() {
+				break
+			}
+			toRemove[name] += 1
+			freeCpu += srvCpu
+			freeMem += srvMem
+		}
+	}
+
+	if _, ok := toRemove[first]; !ok {
+		toRemove[first] = 1
+	}
+
+	return toRemove
+}
+
+func removableInstances(name string) int {
+	service, _ := srv.GetServiceByName(name)
+	keep := 0
+	if utils.ContainsString(cfg.GetNodeConstraints().BaseServices, name) {
+		keep = 1
+	}
+	if min := scheduledMinimum(name); min > keep {
+		keep = min
+	}
+
+	nRun := len(service.Instances.Running)
+	if nRun < keep {
+		return 0
+	}
+
+	return nRun - keep
+}
+
+// The executor stops the instances in the order of the running list
+func instancesToRemove(toRemove map[string]int) []string {
+	instances := []string{}
+	for name, n := range toRemove {
+		service, err := srv.GetServiceByName(name)
+		if err != nil {
+			continue
+		}
+		running := service.Instances.Running
+		if n > len(running) {
+			n = len(running)
+		}
+		instances = append(instances, running[:n]...)
+	}
+
+	return instances
+}
+
 func (p *swapCreator) computeWeight(running string, candidate string, clusterData data.Shared) float64 {
-	srv_run, _ := srv.GetServiceByName(running)
-	srv_cand, _ := srv.GetServiceByName(candidate)
-	nRun := len(srv_run.Instances.Running)
-	baseServices := cfg.GetNodeConstraints().BaseServices
+	weight, _, _ := p.explainWeight(map[string]int{running: 1}, candidate, clusterData)
+	return weight
+}
 
-	if utils.ContainsString(baseServices, running) && nRun < 2 {
-		return 0.0
+func (p *swapCreator) explainWeight(toRemove map[string]int, candidate string, clusterData data.Shared) (float64, map[string]float64, string) {
+	inputs := map[string]float64{}
+
+	for name, n := range toRemove {
+		if n > removableInstances(name) {
+			service, _ := srv.GetServiceByName(name)
+			if len(service.Instances.Running)-n < scheduledMinimum(name) {
+				return 0.0, inputs, c_REASON_SCHEDULE
+			}
+			return 0.0, inputs, c_REASON_BASE_SERVICE
+		}
 	}
 
 	// If the service has the resources to start without stopping the other
 	// there is no reason to swap them
-	if res.AvailableResourcesService(candidate) > 0 {
-		return 0.0
+	service, _ := srv.GetServiceByName(candidate)
+	cores := service.Docker.CpusetCpus
+	if res.AvailableResourcesService(candidate) > 0 &&
+		(cores == "" || res.CheckSpecificCoresAvailable(cores)) {
+		return 0.0, inputs, c_REASON_FREE_RES
+	}
+
+	released := instancesToRemove(toRemove)
+	if !res.CheckPortsAvailableReleasing(candidate, released) {
+		return 0.0, inputs, c_REASON_NO_PORTS
+	}
+
+	if cores != "" && !res.CheckSpecificCoresAvailableReleasing(cores, released) {
+		return 0.0, inputs, c_REASON_NO_CORES
+	}
+
+	if !p.freesEnoughResources(toRemove, candidate) {
+		return 0.0, inputs, c_REASON_NOT_FREED
+	}
+
+	weights := []float64{}
+	for name, n := range toRemove {
+		weight := p.compareServices(name, candidate, clusterData, inputs)
+		for i := 0; i < n; i++ {
+			weights = append(weights, weight)
+		}
+	}
+
+	policyValue := math.Max(0.0, utils.Mean(weights))
+
+	return policyValue, inputs, zeroReason(policyValue)
+}
+
+func (p *swapCreator) freesEnoughResources(toRemove map[string]int, candidate string) bool {
+	candCpu, candMem, err := res.GetServiceRequirements(candidate)
+	if err != nil {
+		return false
 	}
 
-	// TODO now this works only with homogeneous containers
-	// and taking into account only the CPUs. This is not a
-	// a good thing, so in the feuture the swap policy should
-	// be able to compare the resources needed by each containers
-	// and evaulte if it is possible to swap a container with
-	// more than one that is active, in order to obtain
-	// the requested amount of resources.
-	if srv_run.Docker.CPUnumber != srv_cand.Docker.CPUnumber {
-		return 0.0
+	var freedCpu, freedMem int64
+	for name, n := range toRemove {
+		srvCpu, srvMem, err := res.GetServiceRequirements(name)
+		if err != nil {
+			return false
+		}
+		freedCpu += srvCpu * int64(n)
+		freedMem += srvMem * int64(n)
 	}
 
+	resources := res.GetResources()
+	freeCpu := resources.CPU.Total - resources.CPU.Used + freedCpu
+	freeMem := resources.Memory.Total - resources.Memory.Used + freedMem
+
+	return freeCpu >= candCpu && freeMem >= candMem
+}
+
+func (p *swapCreator) compareServices(running string, candidate string, clusterData data.Shared, inputs map[string]float64) float64 {
 	runShared := clusterData.Service[running]
 	candShared := clusterData.Service[candidate]
 	policy := cfg.GetPolicy().Swap
@@ -130,6 +294,7 @@ func (p *swapCreator) computeWeight(running string, candidate string, clusterDat
 			delta := candValue - runValue
 			weight := math.Min(1.0, delta/threshold)
 			weights = append(weights, weight)
+			inputs[running+":"+metric] = weight
 		} else {
 			log.WithFields(log.Fields{
 				"metric":    metric,
@@ -156,6 +321,7 @@ func (p *swapCreator) computeWeight(running string, candidate string, clusterDat
 			delta := candValue - runValue
 			weight := math.Min(1.0, delta/threshold)
 			weights = append(weights, weight)
+			inputs[running+":"+analytic] = weight
 		} else {
 			log.WithFields(log.Fields{
 				"analytic":  analytic,
@@ -165,7 +331,34 @@ func (p *swapCreator) computeWeight(running string, candidate string, clusterDat
 		}
 	}
 
-	policyValue := math.Max(0.0, utils.Mean(weights))
+	return utils.Mean(weights)
+}
+
+type byLoad struct {
+	services    []string
+	clusterData data.Shared
+}
+
+func (p byLoad) Len() int      { return len(p.services) }
+func (p byLoad) Swap(i, j int) { p.services[i], p.services[j] = p.services[j], p.services[i] }
+func (p byLoad) Less(i, j int) bool {
+	return serviceLoad(p.services[i], p.clusterData) < serviceLoad(p.services[j], p.clusterData)
+}
+
+func serviceLoad(name string, clusterData data.Shared) float64 {
+	policy := cfg.GetPolicy().Swap
+	srvShared := clusterData.Service[name]
+	values := []float64{}
+	for _, metric := range policy.Metrics {
+		if value, ok := srvShared.Data.BaseShared[metric]; ok {
+			values = append(values, value)
+		}
+	}
+	for _, analytic := range policy.Analytics {
+		if value, ok := srvShared.Data.UserShared[analytic]; ok {
+			values = append(values, value)
+		}
+	}
 
-	return policyValue
+	return utils.Mean(values)
 }
@@ -16,6 +16,7 @@ func (p *dummyStrategy) Initialize() error {
 
 func (p *dummyStrategy) MakeDecision(policies []data.Policy) *data.Policy {
 	var chosenPolicy *data.Policy
+	lastThreshold = 0.0
 	maxWeight := 0.0
 	for _, plc := range policies {
 		if plc.Weight > maxWeight {
@@ -16,6 +16,7 @@ func (p *probCumulativeStrategy) Initialize() error {
 
 func (p *probCumulativeStrategy) MakeDecision(policies []data.Policy) *data.Policy {
 	threshold := randUniform(0, 1)
+	lastThreshold = threshold
 	shuffle(policies)
 	return weightedRandomElement(policies, threshold)
 }
@@ -16,6 +16,7 @@ func (p *probDeltaStrategy) Initialize() error {
 
 func (p *probDeltaStrategy) MakeDecision(policies []data.Policy) *data.Policy {
 	threshold := randUniform(0, 1)
+	lastThreshold = threshold
 	shuffle(policies)
 	return deltaElement(policies, threshold)
 }
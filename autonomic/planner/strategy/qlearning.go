@@ -0,0 +1,197 @@
+package strategy
+
+import (
+	"math"
+	"strconv"
+	"strings"
+
+	log "github.com/elleFlorio/gru/Godeps/_workspace/src/github.com/Sirupsen/logrus"
+
+	"github.com/elleFlorio/gru/data"
+	"github.com/elleFlorio/gru/enum"
+	"github.com/elleFlorio/gru/utils"
+)
+
+const (
+	c_QL_EPSILON = 0.1
+	c_QL_GAMMA   = 0.5
+	c_QL_LEVELS  = 4
+)
+
+// The state is a discretization of the cluster system analytics, while the
+// reward is the reduction of the load of the system, i.e. the mean of its
+// resources usage and analytics, observed at the next loop. The learning
+// rate of each entry of the table is the inverse of its visits.
+type qlearningStrategy struct {
+	table data.Learning
+	last  *experience
+}
+
+type experience struct {
+	state  string
+	action string
+	load   float64
+}
+
+func (p *qlearningStrategy) Name() string {
+	return "qlearning"
+}
+
+func (p *qlearningStrategy) Initialize() error {
+	p.last = nil
+	table, err := data.GetLearning()
+	if err != nil {
+		log.Debugln("No learning data stored: starting from scratch")
+		table = data.Learning{}
+	}
+
+	if table.Values == nil {
+		table.Values = make(map[string]float64)
+	}
+	if table.Visits == nil {
+		table.Visits = make(map[string]int)
+	}
+	p.table = table
+
+	return nil
+}
+
+func (p *qlearningStrategy) MakeDecision(policies []data.Policy) *data.Policy {
+	if len(policies) == 0 {
+		return nil
+	}
+
+	state, load := observeSystem()
+	if p.last != nil {
+		p.learn(state, load, policies)
+	}
+
+	var chosenPolicy *data.Policy
+	lastThreshold = randUniform(0, 1)
+	if lastThreshold < c_QL_EPSILON {
+		shuffle(policies)
+		chosenPolicy = weightedRandomElement(policies, randUniform(0, 1))
+	} else {
+		chosenPolicy = p.bestPolicy(state, policies)
+	}
+
+	if chosenPolicy == nil {
+		chosenPolicy = noactionPolicy(policies)
+	}
+
+	if chosenPolicy == nil {
+		p.last = nil
+		return nil
+	}
+
+	p.last = &experience{
+		state:  state,
+		action: actionKey(*chosenPolicy),
+		load:   load,
+	}
+
+	log.WithFields(log.Fields{
+		"state":  state,
+		"action": p.last.action,
+		"load":   load,
+	}).Debugln("Recorded experience")
+
+	return chosenPolicy
+}
+
+func (p *qlearningStrategy) learn(state string, load float64, policies []data.Policy) {
+	reward := p.last.load - load
+	maxNext := 0.0
+	for i, plc := range policies {
+		value := p.table.Values[tableKey(state, actionKey(plc))]
+		if i == 0 || value > maxNext {
+			maxNext = value
+		}
+	}
+
+	key := tableKey(p.last.state, p.last.action)
+	old := p.table.Values[key]
+	p.table.Visits[key] += 1
+	alpha := 1.0 / float64(p.table.Visits[key])
+	p.table.Values[key] = old + alpha*(reward+c_QL_GAMMA*maxNext-old)
+	data.SaveLearning(p.table)
+
+	log.WithFields(log.Fields{
+		"key":    key,
+		"reward": reward,
+		"value":  p.table.Values[key],
+	}).Debugln("Updated learning table")
+}
+
+// Policies with weight 0 cannot be actuated (e.g. no resources), so they
+// are never chosen even if they have learned a good value.
+func (p *qlearningStrategy) bestPolicy(state string, policies []data.Policy) *data.Policy {
+	var chosenPolicy *data.Policy
+	maxScore := math.Inf(-1)
+	for i, plc := range policies {
+		if plc.Weight <= 0 {
+			continue
+		}
+		score := plc.Weight + p.table.Values[tableKey(state, actionKey(plc))]
+		if score > maxScore {
+			chosenPolicy = &policies[i]
+			maxScore = score
+		}
+	}
+
+	return chosenPolicy
+}
+
+func noactionPolicy(policies []data.Policy) *data.Policy {
+	for i, plc := range policies {
+		if plc.Name == "noaction" {
+			return &policies[i]
+		}
+	}
+
+	return nil
+}
+
+func observeSystem() (string, float64) {
+	clusterData, err := data.GetSharedCluster()
+	if err != nil {
+		return "unknown", 0.0
+	}
+
+	system := clusterData.System.Data
+	cpu := system.BaseShared[enum.METRIC_CPU_AVG.ToString()]
+	mem := system.BaseShared[enum.METRIC_MEM_AVG.ToString()]
+	state := "cpu=" + strconv.Itoa(level(cpu)) + ",mem=" + strconv.Itoa(level(mem))
+
+	return state, computeLoad(system)
+}
+
+func computeLoad(system data.SharedData) float64 {
+	values := []float64{}
+	for _, value := range system.BaseShared {
+		values = append(values, value)
+	}
+	for _, value := range system.UserShared {
+		values = append(values, value)
+	}
+
+	return utils.Mean(values)
+}
+
+func level(value float64) int {
+	value = math.Max(0.0, math.Min(value, 1.0))
+	lvl := int(value * c_QL_LEVELS)
+	if lvl >= c_QL_LEVELS {
+		lvl = c_QL_LEVELS - 1
+	}
+
+	return lvl
+}
+
+func actionKey(plc data.Policy) string {
+	return plc.Name + "(" + strings.Join(plc.Targets, ",") + ")"
+}
+
+func tableKey(state string, action string) string {
+	return state + "|" + action
+}
@@ -0,0 +1,146 @@
+package strategy
+
+import (
+	"testing"
+
+	"github.com/elleFlorio/gru/Godeps/_workspace/src/github.com/stretchr/testify/assert"
+
+	"github.com/elleFlorio/gru/data"
+	"github.com/elleFlorio/gru/enum"
+	"github.com/elleFlorio/gru/storage"
+)
+
+func TestQLearningMakeDecision(t *testing.T) {
+	storage.New("internal")
+	defer storage.DeleteAllData(enum.LEARNING)
+	data.SaveSharedCluster(data.CreateMockShared())
+
+	targets := []string{"pippo"}
+	actions := map[string][]enum.Action{
+		"pippo": []enum.Action{enum.START},
+	}
+	policies := []data.Policy{
+		data.CreateMockPolicy("scaleout", 0.8, targets, actions),
+		data.CreateMockPolicy("scalein", 0.0, targets, actions),
+		data.CreateMockPolicy("noaction", 0.2, targets, actions),
+	}
+
+	strtg := &qlearningStrategy{}
+	strtg.Initialize()
+	plc := strtg.MakeDecision(policies)
+	assert.NotNil(t, plc)
+	assert.NotEqual(t, "scalein", plc.Name)
+	assert.NotNil(t, strtg.last)
+
+	strtg.MakeDecision(policies)
+	stored, err := data.GetLearning()
+	assert.NoError(t, err)
+	assert.NotEmpty(t, stored.Values)
+
+	assert.Nil(t, strtg.MakeDecision([]data.Policy{}))
+}
+
+func TestQLearningLearn(t *testing.T) {
+	storage.New("internal")
+	defer storage.DeleteAllData(enum.LEARNING)
+
+	targets := []string{"pippo"}
+	actions := map[string][]enum.Action{
+		"pippo": []enum.Action{enum.START},
+	}
+	policies := []data.Policy{
+		data.CreateMockPolicy("scaleout", 0.2, targets, actions),
+		data.CreateMockPolicy("noaction", 0.8, targets, actions),
+	}
+
+	strtg := &qlearningStrategy{}
+	strtg.Initialize()
+	strtg.last = &experience{
+		state:  "s",
+		action: actionKey(policies[0]),
+		load:   0.9,
+	}
+	strtg.learn("s", 0.2, policies)
+	key := tableKey("s", actionKey(policies[0]))
+	good := strtg.table.Values[key]
+	assert.InDelta(t, 0.7, good, 0.001)
+
+	// The second visit weights the new sample as much as the first one
+	strtg.last.load = 0.0
+	strtg.learn("s", 0.9, policies)
+	bad := strtg.table.Values[key]
+	assert.InDelta(t, 0.075, bad, 0.001)
+	assert.Equal(t, 2, strtg.table.Visits[key])
+
+	// The learned value is kept by a new instance of the strategy
+	other := &qlearningStrategy{}
+	other.Initialize()
+	assert.Equal(t, bad, other.table.Values[tableKey("s", actionKey(policies[0]))])
+}
+
+func TestQLearningNoAction(t *testing.T) {
+	storage.New("internal")
+	defer storage.DeleteAllData(enum.LEARNING)
+
+	targets := []string{"pippo"}
+	actions := map[string][]enum.Action{
+		"pippo": []enum.Action{enum.START},
+	}
+	policies := []data.Policy{
+		data.CreateMockPolicy("scalein", 0.0, targets, actions),
+		data.CreateMockPolicy("noaction", 0.0, []string{}, nil),
+	}
+
+	strtg := &qlearningStrategy{}
+	strtg.Initialize()
+	plc := strtg.MakeDecision(policies)
+	assert.Equal(t, "noaction", plc.Name)
+	assert.Nil(t, strtg.MakeDecision(policies[:1]))
+	assert.Nil(t, strtg.last)
+}
+
+func TestComputeLoad(t *testing.T) {
+	system := data.SharedData{
+		BaseShared: map[string]float64{
+			enum.METRIC_CPU_AVG.ToString(): 0.6,
+			enum.METRIC_MEM_AVG.ToString(): 0.2,
+		},
+		UserShared: map[string]float64{"LOAD": 0.7},
+	}
+	assert.InDelta(t, 0.5, computeLoad(system), 0.001)
+	assert.Equal(t, 0.0, computeLoad(data.SharedData{}))
+}
+
+func TestQLearningBestPolicy(t *testing.T) {
+	targets := []string{"pippo"}
+	actions := map[string][]enum.Action{
+		"pippo": []enum.Action{enum.START},
+	}
+	policies := []data.Policy{
+		data.CreateMockPolicy("p1", 0.6, targets, actions),
+		data.CreateMockPolicy("p2", 0.4, targets, actions),
+		data.CreateMockPolicy("p3", 0.0, targets, actions),
+	}
+
+	strtg := &qlearningStrategy{
+		table: data.Learning{
+			Values: map[string]float64{
+				tableKey("s", actionKey(policies[1])): 0.5,
+				tableKey("s", actionKey(policies[2])): 10.0,
+			},
+		},
+	}
+
+	plc := strtg.bestPolicy("s", policies)
+	assert.Equal(t, "p2", plc.Name)
+	plc = strtg.bestPolicy("other", policies)
+	assert.Equal(t, "p1", plc.Name)
+}
+
+func TestLevel(t *testing.T) {
+	assert.Equal(t, 0, level(-1.0))
+	assert.Equal(t, 0, level(0.1))
+	assert.Equal(t, 2, level(0.6))
+	assert.Equal(t, c_QL_LEVELS-1, level(1.0))
+	assert.Equal(t, c_QL_LEVELS-1, level(2.0))
+}
@@ -24,6 +24,10 @@ func TestNew(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, "probdelta", Name())
 
+	_, err = New("qlearning")
+	assert.NoError(t, err)
+	assert.Equal(t, "qlearning", Name())
+
 	_, err = New("notImplemented")
 	assert.Error(t, err)
 	assert.Equal(t, "dummy", Name())
@@ -34,6 +38,7 @@ func TestList(t *testing.T) {
 	assert.Contains(t, names, "dummy")
 	assert.Contains(t, names, "probcumulative")
 	assert.Contains(t, names, "probdelta")
+	assert.Contains(t, names, "qlearning")
 }
 
 func TestMakeDecision(t *testing.T) {
@@ -25,6 +25,7 @@ func init() {
 		&dummyStrategy{},
 		&probCumulativeStrategy{},
 		&probDeltaStrategy{},
+		&qlearningStrategy{},
 	}
 }
 
@@ -67,3 +68,8 @@ func Initialize() error {
 func MakeDecision(policies []data.Policy) *data.Policy {
 	return active().MakeDecision(policies)
 }
+
+// The random threshold used by the last decision, if any
+func LastThreshold() float64 {
+	return lastThreshold
+}
@@ -13,7 +13,8 @@ func init() {
 }
 
 var (
-	gen *rand.Rand
+	gen           *rand.Rand
+	lastThreshold float64
 )
 
 func randUniform(min, max float64) float64 {
@@ -2,37 +2,33 @@ package channels
 
 import (
 	"errors"
-
-	cfg "github.com/elleFlorio/gru/configuration"
-	"github.com/elleFlorio/gru/enum"
+	"sync"
 )
 
+const c_ACTION_QUEUE_SIZE = 100
+
 var (
+	ErrActionQueueFull error = errors.New("Action queue is full")
+
 	ch_action        chan ActionMessage
 	ch_instances     map[string]chan struct{}
-	ch_removal       chan struct{}
+	ch_removals      map[string]chan struct{}
 	ch_autonomic_err chan error
 
-	needsRemovalNotification bool
+	mutex_removal = sync.Mutex{}
 )
 
 func init() {
-	ch_action = make(chan ActionMessage)
+	ch_action = make(chan ActionMessage, c_ACTION_QUEUE_SIZE)
 	ch_instances = make(map[string]chan struct{})
-	ch_removal = make(chan struct{})
+	ch_removals = make(map[string]chan struct{})
 	ch_autonomic_err = make(chan error)
-
-	needsRemovalNotification = false
 }
 
 func GetActionChannel() chan ActionMessage {
 	return getChannel("action").(chan ActionMessage)
 }
 
-func GetRemovalChannel() chan struct{} {
-	return getChannel("removal").(chan struct{})
-}
-
 func GetAutonomicErrChannel() chan error {
 	return getChannel("autonomic_err").(chan error)
 }
@@ -41,8 +37,6 @@ func getChannel(name string) interface{} {
 	switch name {
 	case "action":
 		return ch_action
-	case "removal":
-		return ch_removal
 	case "autonomic_err":
 		return ch_autonomic_err
 	}
@@ -50,28 +44,39 @@ func getChannel(name string) interface{} {
 	return nil
 }
 
-func SetRemovalNotification(value bool) {
-	needsRemovalNotification = value
-}
-
-func NeedsRemovalNotification() bool {
-	return needsRemovalNotification
+// The action is queued without waiting for the executor: if the queue is
+// full the action is refused.
+func SendActionMessage(message ActionMessage) error {
+	select {
+	case ch_action <- message:
+		return nil
+	default:
+		return ErrActionQueueFull
+	}
 }
 
-func SendActionStartMessage(target *cfg.Service) {
-	message := ActionMessage{target, []enum.Action{enum.START}}
-	sendActionMessage(message)
-
+// The removal of each container is notified on its own channel, so the
+// removals executed concurrently do not wait for each other.
+func CreateRemovalChannel(id string) chan struct{} {
+	mutex_removal.Lock()
+	defer mutex_removal.Unlock()
+	ch_removals[id] = make(chan struct{}, 1)
+	return ch_removals[id]
 }
 
-func SendActionStopMessage(target *cfg.Service) {
-	message := ActionMessage{target, []enum.Action{enum.STOP, enum.REMOVE}}
-	sendActionMessage(message)
-
+func NotifyRemoval(id string) {
+	mutex_removal.Lock()
+	defer mutex_removal.Unlock()
+	if ch_removal, ok := ch_removals[id]; ok {
+		ch_removal <- struct{}{}
+		delete(ch_removals, id)
+	}
 }
 
-func sendActionMessage(message ActionMessage) {
-	ch_action <- message
+func RemoveRemovalChannel(id string) {
+	mutex_removal.Lock()
+	defer mutex_removal.Unlock()
+	delete(ch_removals, id)
 }
 
 func CreateInstanceChannel(id string) chan struct{} {
@@ -6,6 +6,7 @@ import (
 )
 
 type ActionMessage struct {
+	Id      string
 	Target  *cfg.Service
 	Actions enum.Actions
 }
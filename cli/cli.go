@@ -3,6 +3,7 @@ package cli
 import (
 	"fmt"
 	"os"
+	"path/filepath"
 
 	log "github.com/elleFlorio/gru/Godeps/_workspace/src/github.com/Sirupsen/logrus"
 	"github.com/elleFlorio/gru/Godeps/_workspace/src/github.com/codegangsta/cli"
@@ -49,6 +50,11 @@ func Run() {
 					Usage:  fmt.Sprintf("url of etcd server"),
 					EnvVar: "ETCD_ADDR",
 				},
+				cli.StringFlag{
+					Name:   "discovery, d",
+					Usage:  fmt.Sprintf("URI of the discovery service (e.g. consul://localhost:8500). Default is etcd at the etcdserver url"),
+					EnvVar: "GRU_DISCOVERY",
+				},
 			},
 		},
 		{
@@ -61,6 +67,11 @@ func Run() {
 					Usage:  fmt.Sprintf("url of etcd server"),
 					EnvVar: "ETCD_ADDR",
 				},
+				cli.StringFlag{
+					Name:   "discovery, d",
+					Usage:  fmt.Sprintf("URI of the discovery service (e.g. consul://localhost:8500). Default is etcd at the etcdserver url"),
+					EnvVar: "GRU_DISCOVERY",
+				},
 				cli.StringFlag{
 					Name:  "name, n",
 					Value: "random_name",
@@ -78,6 +89,37 @@ func Run() {
 					Usage:  fmt.Sprintf("Port for the rest api server. Default is 5000"),
 					EnvVar: "GRU_PORT",
 				},
+				cli.StringFlag{
+					Name:   "zone",
+					Usage:  fmt.Sprintf("Zone of the node, used to choose the friends"),
+					EnvVar: "GRU_ZONE",
+				},
+				cli.StringFlag{
+					Name:   "rack",
+					Usage:  fmt.Sprintf("Rack of the node in its zone"),
+					EnvVar: "GRU_RACK",
+				},
+				cli.StringFlag{
+					Name:   "discovery-cache",
+					Value:  defaultCachePath(),
+					Usage:  fmt.Sprintf("File used to cache the data of the discovery service"),
+					EnvVar: "GRU_DISCOVERY_CACHE",
+				},
+				cli.StringFlag{
+					Name:   "tls-cert",
+					Usage:  fmt.Sprintf("Certificate of the node for TLS"),
+					EnvVar: "GRU_TLS_CERT",
+				},
+				cli.StringFlag{
+					Name:   "tls-key",
+					Usage:  fmt.Sprintf("Private key of the node certificate"),
+					EnvVar: "GRU_TLS_KEY",
+				},
+				cli.StringFlag{
+					Name:   "tls-ca",
+					Usage:  fmt.Sprintf("CA of the cluster used to verify the peers"),
+					EnvVar: "GRU_TLS_CA",
+				},
 			},
 		},
 		{
@@ -85,14 +127,51 @@ func Run() {
 			Usage:  "manage a GRU cluster",
 			Action: manage,
 			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:   "token, t",
+					Usage:  fmt.Sprintf("Token to authorize the commands sent to the agents"),
+					EnvVar: "GRU_TOKEN",
+				},
 				cli.StringFlag{
 					Name:   "etcdserver, e",
 					Usage:  fmt.Sprintf("url of etcd server"),
 					EnvVar: "ETCD_ADDR",
 				},
+				cli.StringFlag{
+					Name:   "discovery, d",
+					Usage:  fmt.Sprintf("URI of the discovery service (e.g. consul://localhost:8500). Default is etcd at the etcdserver url"),
+					EnvVar: "GRU_DISCOVERY",
+				},
+				cli.StringFlag{
+					Name:   "tls-cert",
+					Usage:  fmt.Sprintf("Certificate of the node for TLS"),
+					EnvVar: "GRU_TLS_CERT",
+				},
+				cli.StringFlag{
+					Name:   "tls-key",
+					Usage:  fmt.Sprintf("Private key of the node certificate"),
+					EnvVar: "GRU_TLS_KEY",
+				},
+				cli.StringFlag{
+					Name:   "tls-ca",
+					Usage:  fmt.Sprintf("CA of the cluster used to verify the peers"),
+					EnvVar: "GRU_TLS_CA",
+				},
 			},
 		},
 	}
 
 	app.Run(os.Args)
 }
+
+// The cache holds the data of the cluster, so by default it is kept in the
+// home of the user and not in the shared temporary directory. Without a home
+// the cache is disabled.
+func defaultCachePath() string {
+	home := os.Getenv("HOME")
+	if home == "" {
+		return ""
+	}
+
+	return filepath.Join(home, ".gru", "discovery-cache.json")
+}
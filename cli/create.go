@@ -18,11 +18,9 @@ func create(c *cli.Context) {
 	} else {
 		clusterName = c.Args().First()
 	}
-	// Get etcd address
-	etcdAddress := c.String("etcdserver")
-
-	// Initialize etcd client
-	discovery.New("etcd", etcdAddress)
+	// Initialize discovery client
+	name, address := discoveryService(c)
+	discovery.New(name, address)
 
 	// Generate cluster
 	id, err := utils.GenerateUUID()
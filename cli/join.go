@@ -17,6 +17,7 @@ import (
 	"github.com/elleFlorio/gru/network"
 	"github.com/elleFlorio/gru/node"
 	res "github.com/elleFlorio/gru/resources"
+	"github.com/elleFlorio/gru/service"
 	"github.com/elleFlorio/gru/storage"
 	"github.com/elleFlorio/gru/utils"
 )
@@ -37,14 +38,19 @@ func join(c *cli.Context) {
 	}
 	ipAddress := c.String("address")
 	port := c.String("port")
-	etcdAddress := c.String("etcdserver")
 	nodeName := c.String("name")
+	cachePath := c.String("discovery-cache")
+	zone := c.String("zone")
+	rack := c.String("rack")
 
 	// infrastructure
 	initializeNetwork(ipAddress, port)
-	initializeDiscovery("etcd", etcdAddress)
+	initializeTLS(c)
+	discoveryName, discoveryAddress := discoveryService(c)
+	initializeDiscovery(discoveryName, discoveryAddress, cachePath)
 	// Configuration
 	initializeAgent(clusterName)
+	initializeAgentToken()
 	initializeServices(clusterName)
 	initializePolicy(clusterName)
 	initializeAnalytics(clusterName)
@@ -54,7 +60,7 @@ func join(c *cli.Context) {
 	initializeContainerEngine()
 	// Resources
 	initializeResources()
-	initializeNode(nodeName, clusterName)
+	initializeNode(nodeName, zone, rack, clusterName)
 	// Join Cluster
 	registerToCluster(clusterName)
 	agent.StartMonitoring()
@@ -63,6 +69,35 @@ func join(c *cli.Context) {
 	fmt.Printf("Joined cluster %s.\nWaiting for commands...\n", clusterName)
 }
 
+func initializeTLS(c *cli.Context) {
+	tlsConfig := network.TLSConfig{
+		CertFile: c.String("tls-cert"),
+		KeyFile:  c.String("tls-key"),
+		CAFile:   c.String("tls-ca"),
+	}
+	if err := network.InitializeTLS(tlsConfig); err != nil {
+		log.WithField("err", err).Fatalln("Error initializing TLS")
+	}
+	if network.TLSEnabled() {
+		log.Infoln("TLS enabled")
+	}
+}
+
+// The agent uses the first token with the agent role to talk with the
+// other agents.
+func initializeAgentToken() {
+	for _, token := range cfg.GetAgentAuth().Tokens {
+		if token.Role == api.RoleAgent {
+			network.SetToken(token.Token)
+			return
+		}
+	}
+
+	if len(cfg.GetAgentAuth().Tokens) > 0 {
+		log.Warnln("No token with agent role, the requests to the other agents will be rejected")
+	}
+}
+
 func initializeNetwork(address string, port string) {
 	err := network.InitializeNetwork(address, port)
 	if err != nil {
@@ -71,8 +106,31 @@ func initializeNetwork(address string, port string) {
 	log.WithField(network.Config().IpAddress+":"+network.Config().Port, "ok").Infoln("Network initialized")
 }
 
-func initializeDiscovery(name string, address string) {
-	_, err := discovery.New(name, address)
+// The discovery service is given as URI with the flag discovery, otherwise
+// etcd is used at the url given with the flag etcdserver.
+func discoveryService(c *cli.Context) (string, string) {
+	uri := c.String("discovery")
+	if uri == "" {
+		return "etcd", c.String("etcdserver")
+	}
+
+	name, address, err := discovery.Parse(uri)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"uri": uri,
+			"err": err,
+		}).Fatalln("Error parsing discovery service URI")
+	}
+
+	return name, address
+}
+
+func initializeDiscovery(name string, address string, cachePath string) {
+	_, err := discovery.NewCached(name, address, cachePath)
+	if err == discovery.ErrDegraded {
+		log.WithField("address", address).Warnln("Discovery service unreachable, starting with cached data")
+		return
+	}
 	if err != nil {
 		log.WithField("err", err).Fatalln("Error initializing discovery service")
 	}
@@ -88,7 +146,10 @@ func initializeAgent(clusterName string) {
 
 func initializeServices(clusterName string) {
 	remote := c_GRU_REMOTE + clusterName + "/" + c_SERVICES_REMOTE
-	services := cfg.ReadServices(remote)
+	services := service.ValidateServices(cfg.ReadServices(remote))
+	if err := service.CheckDependencies(services); err != nil {
+		log.WithField("err", err).Fatalln("Error in services dependencies")
+	}
 	cfg.SetServices(services)
 }
 
@@ -168,7 +229,7 @@ func initializeResources() {
 	res.Initialize()
 }
 
-func initializeNode(nodeName string, clusterName string) {
+func initializeNode(nodeName string, zone string, rack string, clusterName string) {
 	if nodeName == "random_name" {
 		nodeName = utils.GetRandomName(0)
 	}
@@ -178,7 +239,7 @@ func initializeNode(nodeName string, clusterName string) {
 		counter++
 	}
 	log.Debugln("Node name: ", nodeName)
-	node.CreateNode(nodeName, res.GetResources())
+	node.CreateNode(nodeName, zone, rack, res.GetResources())
 }
 
 func nameExist(nodeName string, clusterName string) bool {
@@ -2,14 +2,17 @@ package cli
 
 import (
 	"github.com/elleFlorio/gru/manager"
+	"github.com/elleFlorio/gru/network"
 
 	log "github.com/elleFlorio/gru/Godeps/_workspace/src/github.com/Sirupsen/logrus"
 	"github.com/elleFlorio/gru/Godeps/_workspace/src/github.com/codegangsta/cli"
 )
 
 func manage(c *cli.Context) {
-	etcdAddress := c.String("etcdserver")
-	man, err := manager.New(etcdAddress)
+	discoveryName, discoveryAddress := discoveryService(c)
+	initializeTLS(c)
+	network.SetToken(c.String("token"))
+	man, err := manager.New(discoveryName, discoveryAddress)
 	if err != nil {
 		log.WithField("err", err).Fatalln("Cannot start manager")
 	}
@@ -18,6 +18,7 @@ const c_CONFIG_REMOTE = "config/"
 const c_SERVICES_REMOTE = "services/"
 const c_POLICY_REMOTE = "policy/"
 const c_ANALYTIC_REMOTE = "analytics/"
+const c_LEASES_REMOTE = "leases/"
 const c_TTL = 5
 
 type Cluster struct {
@@ -139,6 +140,10 @@ func keepAlive(ttl int) {
 			err := updateNodeFolder(ttl + 1)
 			if err != nil {
 				log.Errorln("Error keeping the node alive")
+				// The folder expired while the discovery service was unreachable
+				if err != discovery.ErrUnreachable {
+					createNodeFolder()
+				}
 			}
 		}
 	}
@@ -172,6 +177,57 @@ func GetMyCluster() (Cluster, error) {
 	return myCluster, nil
 }
 
+// The lease is a key with a TTL that can be created only if it does not
+// exist, so only one node at a time can hold the lease on a service.
+func AcquireServiceLease(serviceName string, ttl int) bool {
+	if myCluster.UUID == "" {
+		return false
+	}
+
+	owner := cfg.GetNodeConfig().Name
+	remote := c_GRU_REMOTE + myCluster.Name + "/" + c_LEASES_REMOTE + serviceName
+	opt := discovery.Options{
+		"TTL":       time.Second * time.Duration(ttl),
+		"PrevExist": false,
+	}
+
+	err := discovery.Set(remote, owner, opt)
+	if err == nil {
+		log.WithField("service", serviceName).Debugln("Lease acquired")
+		return true
+	}
+
+	// The owner is read from the discovery service, never from the cache
+	resp, err := discovery.Get(remote, discovery.Options{"Quorum": true})
+	if err != nil {
+		return false
+	}
+
+	return resp[remote] == owner
+}
+
+// The lease is deleted only if it is held by this node, with a single
+// compare-and-delete, so a lease acquired meanwhile by another node is kept.
+func ReleaseServiceLease(serviceName string) {
+	if myCluster.UUID == "" {
+		return
+	}
+
+	remote := c_GRU_REMOTE + myCluster.Name + "/" + c_LEASES_REMOTE + serviceName
+	err := discovery.DeleteIf(remote, cfg.GetNodeConfig().Name)
+	if err == discovery.ErrKeyNotFound || err == discovery.ErrCompareFailed {
+		return
+	}
+	if err != nil {
+		log.WithFields(log.Fields{
+			"service": serviceName,
+			"err":     err,
+		}).Warnln("Cannot release lease")
+		return
+	}
+	log.WithField("service", serviceName).Debugln("Lease released")
+}
+
 func ListClusters() map[string]string {
 	resp, err := discovery.Get(c_GRU_REMOTE, discovery.Options{})
 	if err != nil {
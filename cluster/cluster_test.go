@@ -0,0 +1,51 @@
+package cluster
+
+import (
+	"testing"
+
+	"github.com/elleFlorio/gru/Godeps/_workspace/src/github.com/stretchr/testify/assert"
+
+	cfg "github.com/elleFlorio/gru/configuration"
+	"github.com/elleFlorio/gru/discovery"
+)
+
+func TestCluster(t *testing.T) {
+	_, err := discovery.New("file", "")
+	assert.NoError(t, err)
+	defer discovery.New("noservice", "")
+
+	RegisterCluster("cluster1", "uuid1")
+	assert.Equal(t, map[string]string{"cluster1": "uuid1"}, ListClusters())
+
+	cfg.SetNode(cfg.Node{
+		Configuration: cfg.NodeConfig{Name: "node1", Address: "http://node1:5000"},
+		Active:        true,
+	})
+	assert.Error(t, JoinCluster("cluster2"))
+	assert.NoError(t, JoinCluster("cluster1"))
+	myCluster, err := GetMyCluster()
+	assert.NoError(t, err)
+	assert.Equal(t, "uuid1", myCluster.UUID)
+
+	nodes := GetNodes("cluster1", true)
+	if assert.Len(t, nodes, 1) {
+		assert.Equal(t, "/gru/cluster1/nodes/node1", nodes[0].Configuration.Remote)
+	}
+	assert.Equal(t, map[string]string{"node1": "http://node1:5000"}, ListNodes("cluster1", true))
+	assert.NoError(t, updateNodeFolder(c_TTL+1))
+
+	UpdateService("cluster1", "service1", cfg.Service{Name: "service1", Image: "image1"})
+	assert.Equal(t, map[string]string{"service1": "image1"}, ListServices("cluster1"))
+	assert.Equal(t, "image1", GetService("cluster1", "service1").Image)
+
+	assert.True(t, AcquireServiceLease("service1", 10))
+	assert.True(t, AcquireServiceLease("service1", 10))
+	cfg.GetNodeConfig().Name = "node2"
+	assert.False(t, AcquireServiceLease("service1", 10))
+	ReleaseServiceLease("service1")
+	assert.False(t, AcquireServiceLease("service1", 10))
+	cfg.GetNodeConfig().Name = "node1"
+	ReleaseServiceLease("service1")
+	cfg.GetNodeConfig().Name = "node2"
+	assert.True(t, AcquireServiceLease("service1", 10))
+}
@@ -16,7 +16,13 @@ import (
 )
 
 // api
-const c_ROUTE_SHARED string = "/gru/v1/shared"
+const c_ROUTE_GOSSIP string = "/gru/v1/gossip"
+const c_GOSSIP_CONTENT_TYPE = data.ContentTypeMsgpack
+
+const (
+	c_DEFAULT_ROUNDS_MAX_AGE = 3
+	c_DEFAULT_MAX_AGE        = 180
+)
 
 var (
 	ErrInvalidFriendsNumber error = errors.New("Friends number should be > 0")
@@ -46,6 +52,9 @@ func start(nFriends int, timeInterval int) {
 	}
 }
 
+// Every round the node exchanges digests and deltas of the gossip entries
+// with some random friends, then removes the departed nodes and the old
+// entries and computes the cluster view from the entries left.
 func updateFriendsData(nFriends int) error {
 	var err error
 	log.Debugln("Updating friends data")
@@ -54,24 +63,33 @@ func updateFriendsData(nFriends int) error {
 		return err
 	}
 
-	peers := getAllPeers()
+	self := cfg.GetNodeConfig().Name
+	peerNodes := getPeerNodes()
+	peers := peerAddresses(peerNodes)
 	log.WithField("peers", len(peers)).Debugln("Number of peers")
 	if len(peers) == 0 {
 		return ErrNoPeers
 	}
+	data.RemoveGossipNodes(self, peers)
+	forgetDepartedPeers(peers)
 
-	friends, err := chooseRandomFriends(peers, nFriends)
+	friends, err := chooseFriends(peerNodes, nFriends)
 	if err != nil {
 		return err
 	}
 	log.WithField("friends", friends).Debugln("Friends to connect with")
 
-	friendsData, err := getFriendsData(friends)
-	if err != nil {
-		return err
+	for friend, address := range friends {
+		if err = exchangeGossip(self, friend, address); err != nil {
+			log.WithFields(log.Fields{
+				"friend": friend,
+				"err":    err,
+			}).Debugln("Cannot exchange gossip with friend")
+		}
 	}
 
-	clusterData, err := mergeSharedData(friendsData)
+	data.ExpireGossipEntries(self, MaxAge())
+	clusterData, err := data.ComputeGossipCluster(MaxAge())
 	if err != nil {
 		return err
 	}
@@ -81,6 +99,90 @@ func updateFriendsData(nFriends int) error {
 	return nil
 }
 
+// Push-pull exchange: the digest is sent to the friend, that answers with
+// the entries newer than the digest and its own digest, then the entries
+// newer than the digest of the friend are pushed to it. The pull is used to
+// measure the RTT of the friend.
+func exchangeGossip(self string, friend string, address string) error {
+	start := time.Now()
+	pull, err := sendGossip(address, data.GossipMessage{Digest: data.GetGossipDigest()})
+	recordLatency(friend, time.Since(start), err)
+	if err != nil {
+		return err
+	}
+
+	updated := data.MergeGossipEntries(self, pull.Entries)
+	log.WithFields(log.Fields{
+		"address": address,
+		"updated": updated,
+	}).Debugln("Gossip entries pulled")
+
+	delta := data.GetGossipDelta(pull.Digest)
+	if len(delta) == 0 {
+		return nil
+	}
+
+	_, err = sendGossip(address, data.GossipMessage{Entries: delta})
+	return err
+}
+
+// The gossip is exchanged in msgpack, that is smaller and faster to encode
+// than JSON for large clusters.
+func sendGossip(address string, msg data.GossipMessage) (data.GossipMessage, error) {
+	body, err := data.Encode(msg, c_GOSSIP_CONTENT_TYPE)
+	if err != nil {
+		return data.GossipMessage{}, err
+	}
+
+	resp, contentType, err := network.DoRequestContent("POST", address+c_ROUTE_GOSSIP, body,
+		c_GOSSIP_CONTENT_TYPE, c_GOSSIP_CONTENT_TYPE)
+	if err != nil {
+		return data.GossipMessage{}, err
+	}
+
+	reply := data.GossipMessage{}
+	if len(resp) == 0 {
+		return reply, nil
+	}
+	contentType, err = data.ParseContentType(contentType)
+	if err != nil {
+		return reply, err
+	}
+	err = data.Decode(resp, &reply, contentType)
+
+	return reply, err
+}
+
+// The friend receiving a gossip message stores the pushed entries and, if
+// the message contains a digest, answers with its delta and digest.
+func HandleGossip(msg data.GossipMessage) data.GossipMessage {
+	self := cfg.GetNodeConfig().Name
+	data.MergeGossipEntries(self, msg.Entries)
+	if msg.Digest == nil {
+		return data.GossipMessage{}
+	}
+
+	return data.GossipMessage{
+		Digest:  data.GetGossipDigest(),
+		Entries: data.GetGossipDelta(msg.Digest),
+	}
+}
+
+// The entries not updated for MaxAge seconds are expired. By default they
+// are kept for three communication rounds.
+func MaxAge() time.Duration {
+	comCfg := cfg.GetAgentCommunication()
+	maxAge := comCfg.MaxAge
+	if maxAge <= 0 {
+		maxAge = c_DEFAULT_ROUNDS_MAX_AGE * comCfg.LoopTimeInterval
+	}
+	if maxAge <= 0 {
+		maxAge = c_DEFAULT_MAX_AGE
+	}
+
+	return time.Duration(maxAge) * time.Second
+}
+
 func clearFriendsData() error {
 	allData, err := storage.GetAllData(enum.SHARED)
 	if err != nil {
@@ -98,14 +200,21 @@ func clearFriendsData() error {
 	return nil
 }
 
-func getAllPeers() map[string]string {
+func getPeerNodes() []cfg.Node {
 	myCluster, err := cluster.GetMyCluster()
 	if err != nil {
 		log.WithField("err", err).Errorln("Error getting my cluster")
-		return map[string]string{}
+		return []cfg.Node{}
 	}
-	peers := cluster.ListNodes(myCluster.Name, true)
-	delete(peers, cfg.GetNodeConfig().Name)
+
+	self := cfg.GetNodeConfig().Name
+	peers := []cfg.Node{}
+	for _, peer := range cluster.GetNodes(myCluster.Name, true) {
+		if peer.Configuration.Name != self {
+			peers = append(peers, peer)
+		}
+	}
+
 	return peers
 }
 
@@ -137,47 +246,3 @@ func chooseRandomFriends(peers map[string]string, n int) (map[string]string, err
 
 	return friends, nil
 }
-
-func getFriendsData(friends map[string]string) ([]data.Shared, error) {
-	var err error
-	friendsData := make([]data.Shared, 0, len(friends))
-
-	for friend, address := range friends {
-		friendRoute := address + c_ROUTE_SHARED
-		friendData, err := network.DoRequest("GET", friendRoute, nil)
-		if err != nil {
-			log.WithField("address", address).Debugln("Error retrieving friend stats")
-		}
-		err = storage.StoreData(friend, friendData, enum.SHARED)
-		if err != nil {
-			log.WithField("err", err).Debugln("Error storing friends data")
-		}
-
-		sharedData, err := data.ByteToShared(friendData)
-		if err != nil {
-			log.WithField("address", address).Debugln("Friend data not stored")
-		} else {
-			friendsData = append(friendsData, sharedData)
-		}
-
-	}
-
-	return friendsData, err
-}
-
-func mergeSharedData(friendsData []data.Shared) (data.Shared, error) {
-	sharedStored, err := data.GetSharedCluster()
-	if err != nil {
-		log.WithField("err", err).Debugln("Cannot get stored shared data")
-		return data.MergeShared(friendsData)
-	}
-
-	toMerge := append(friendsData, sharedStored)
-	sharedCluster, err := data.MergeShared(toMerge)
-	if err != nil {
-		log.WithField("err", err).Debugln("Cannot merge friends data")
-		return data.Shared{}, err
-	}
-
-	return sharedCluster, nil
-}
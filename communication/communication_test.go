@@ -1,12 +1,16 @@
 package communication
 
 import (
+	"errors"
+	"fmt"
 	"math/rand"
 	"testing"
+	"time"
 
 	"github.com/elleFlorio/gru/Godeps/_workspace/src/github.com/stretchr/testify/assert"
 
 	cfg "github.com/elleFlorio/gru/configuration"
+	"github.com/elleFlorio/gru/data"
 	"github.com/elleFlorio/gru/enum"
 	"github.com/elleFlorio/gru/node"
 	"github.com/elleFlorio/gru/storage"
@@ -72,3 +76,115 @@ func createMockPeers(nPeers int) map[string]string {
 	}
 	return mockPeers
 }
+
+func TestChooseZoneFriends(t *testing.T) {
+	peers := createMockPeerNodes(20, []string{"zone1", "zone2"})
+	friends, err := chooseZoneFriends(peers, 5, "zone1", 0)
+	assert.NoError(t, err)
+	assert.Len(t, friends, 5)
+	assert.Equal(t, 5, countZone(peers, friends, "zone1"))
+
+	friends, _ = chooseZoneFriends(peers, 5, "zone1", 0.4)
+	assert.Len(t, friends, 5)
+	assert.Equal(t, 2, countZone(peers, friends, "zone2"))
+
+	// The remote peers are used when the zone has not enough peers
+	friends, _ = chooseZoneFriends(peers, 15, "zone1", 0)
+	assert.Len(t, friends, 15)
+	assert.Equal(t, 10, countZone(peers, friends, "zone1"))
+
+	_, err = chooseZoneFriends(peers, 0, "zone1", 0)
+	assert.Equal(t, ErrInvalidFriendsNumber, err)
+}
+
+func TestChooseLatencyFriends(t *testing.T) {
+	defer func() { latencies = make(map[string]peerLatency) }()
+	peers := createMockPeerNodes(5, []string{""})
+	for i, peer := range peers[:4] {
+		recordLatency(peer.Configuration.Name, time.Duration(10*(i+1))*time.Millisecond, nil)
+	}
+
+	// node4 was never measured, then node0 and node1 are the fastest
+	friends, err := chooseLatencyFriends(peers, 3)
+	assert.NoError(t, err)
+	assert.Len(t, friends, 3)
+	assert.Contains(t, friends, "node4")
+	assert.Contains(t, friends, "node0")
+
+	recordLatency("node4", 100*time.Millisecond, nil)
+	recordLatency("node0", 0, errors.New("unreachable"))
+	assert.Equal(t, time.Duration(0.7*float64(10*time.Millisecond)+0.3*float64(c_RTT_FAILURE)), latencies["node0"].rtt)
+	friends, _ = chooseLatencyFriends(peers, 1)
+	assert.Equal(t, map[string]string{"node1": "address1"}, friends)
+
+	// The friend measured longest ago is chosen to update its RTT
+	friends, _ = chooseLatencyFriends(peers, 2)
+	assert.Contains(t, friends, "node1")
+	assert.Contains(t, friends, "node2")
+
+	forgetDepartedPeers(peerAddresses(peers[:2]))
+	assert.Len(t, latencies, 2)
+}
+
+func TestChooseRoundRobinFriends(t *testing.T) {
+	defer func() { lastFriend = "" }()
+	peers := createMockPeerNodes(10, []string{""})
+
+	// Every peer is contacted within 3 rounds, even with 1 friend per round
+	contacted := make(map[string]string)
+	for round := 0; round < 3; round++ {
+		friends, err := chooseRoundRobinFriends(peers, 1, 3)
+		assert.NoError(t, err)
+		assert.Len(t, friends, 4)
+		for name, address := range friends {
+			contacted[name] = address
+		}
+	}
+	assert.Len(t, contacted, 10)
+
+	lastFriend = "node9"
+	friends, _ := chooseRoundRobinFriends(peers, 2, 0)
+	assert.Equal(t, map[string]string{"node0": "address0", "node1": "address1"}, friends)
+	assert.Equal(t, "node1", lastFriend)
+
+	_, err := chooseRoundRobinFriends([]cfg.Node{}, 2, 3)
+	assert.Equal(t, ErrNoFriends, err)
+}
+
+func createMockPeerNodes(nPeers int, zones []string) []cfg.Node {
+	peers := make([]cfg.Node, 0, nPeers)
+	for i := 0; i < nPeers; i++ {
+		peer := cfg.Node{}
+		peer.Configuration.Name = fmt.Sprintf("node%d", i)
+		peer.Configuration.Address = fmt.Sprintf("address%d", i)
+		peer.Configuration.Zone = zones[i%len(zones)]
+		peers = append(peers, peer)
+	}
+	return peers
+}
+
+func countZone(peers []cfg.Node, friends map[string]string, zone string) int {
+	count := 0
+	for _, peer := range peers {
+		if _, ok := friends[peer.Configuration.Name]; ok && peer.Configuration.Zone == zone {
+			count++
+		}
+	}
+	return count
+}
+
+func TestHandleGossip(t *testing.T) {
+	defer data.CleanGossip()
+	cfg.SetNode(node.CreateMockNode())
+	self := cfg.GetNodeConfig().Name
+	data.UpdateGossipLocal(self, data.Shared{})
+
+	reply := HandleGossip(data.GossipMessage{Digest: data.GossipDigest{}})
+	assert.Equal(t, uint64(1), reply.Digest[self])
+	assert.Len(t, reply.Entries, 1)
+
+	pushed := data.GossipEntry{Node: "friend", Version: 2}
+	reply = HandleGossip(data.GossipMessage{Entries: []data.GossipEntry{pushed}})
+	assert.Empty(t, reply.Entries)
+	assert.Equal(t, uint64(2), data.GetGossipDigest()["friend"])
+}
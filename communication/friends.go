@@ -0,0 +1,219 @@
+package communication
+
+import (
+	"math/rand"
+	"sort"
+	"time"
+
+	cfg "github.com/elleFlorio/gru/configuration"
+)
+
+const (
+	SelectionRandom     = "random"
+	SelectionZone       = "zone"
+	SelectionLatency    = "latency"
+	SelectionRoundRobin = "roundrobin"
+
+	// Weight of the new sample in the moving average of the RTT
+	c_RTT_SMOOTHING = 0.3
+	// RTT given to a friend that cannot be reached
+	c_RTT_FAILURE = 10 * time.Second
+)
+
+var (
+	latencies  = make(map[string]peerLatency)
+	lastFriend string
+)
+
+type peerLatency struct {
+	rtt      time.Duration
+	measured time.Time
+}
+
+func chooseFriends(peers []cfg.Node, n int) (map[string]string, error) {
+	comCfg := cfg.GetAgentCommunication()
+	switch comCfg.FriendSelection {
+	case SelectionZone:
+		return chooseZoneFriends(peers, n, cfg.GetNodeConfig().Zone, comCfg.RemoteFraction)
+	case SelectionLatency:
+		return chooseLatencyFriends(peers, n)
+	case SelectionRoundRobin:
+		return chooseRoundRobinFriends(peers, n, comCfg.CoverageRounds)
+	}
+
+	return chooseRandomFriends(peerAddresses(peers), n)
+}
+
+func checkFriendsNumber(nPeers int, n int) (int, error) {
+	if nPeers < 1 {
+		return 0, ErrNoFriends
+	}
+	if n <= 0 {
+		return 0, ErrInvalidFriendsNumber
+	} else if n > nPeers {
+		n = nPeers
+	}
+
+	return n, nil
+}
+
+// The friends are chosen in the same zone of the node, but a fraction of
+// them is chosen in the other zones so the data of the whole cluster keep
+// flowing. The fraction is rounded randomly, so on average it is respected
+// also when there are only a few friends.
+func chooseZoneFriends(peers []cfg.Node, n int, zone string, fraction float64) (map[string]string, error) {
+	n, err := checkFriendsNumber(len(peers), n)
+	if err != nil {
+		return nil, err
+	}
+
+	local := []cfg.Node{}
+	remote := []cfg.Node{}
+	for _, peer := range peers {
+		if peer.Configuration.Zone == zone {
+			local = append(local, peer)
+		} else {
+			remote = append(remote, peer)
+		}
+	}
+
+	expected := float64(n) * fraction
+	nRemote := int(expected)
+	if rand.Float64() < expected-float64(nRemote) {
+		nRemote++
+	}
+	if nRemote > len(remote) {
+		nRemote = len(remote)
+	}
+	nLocal := n - nRemote
+	if nLocal > len(local) {
+		nRemote += nLocal - len(local)
+		nLocal = len(local)
+	}
+
+	friends := make(map[string]string, n)
+	addRandomFriends(friends, local, nLocal)
+	addRandomFriends(friends, remote, nRemote)
+
+	return friends, nil
+}
+
+func addRandomFriends(friends map[string]string, peers []cfg.Node, n int) {
+	for _, index := range rand.Perm(len(peers))[:n] {
+		friends[peers[index].Configuration.Name] = peers[index].Configuration.Address
+	}
+}
+
+// The friends with the lowest RTT are chosen. The peers never measured are
+// considered the fastest, so they are measured soon, while one friend is
+// the one measured longest ago to keep the measures updated.
+func chooseLatencyFriends(peers []cfg.Node, n int) (map[string]string, error) {
+	n, err := checkFriendsNumber(len(peers), n)
+	if err != nil {
+		return nil, err
+	}
+
+	sorted := make([]cfg.Node, len(peers))
+	copy(sorted, peers)
+	sort.Sort(byLatency(sorted))
+
+	friends := make(map[string]string, n)
+	nFastest := n
+	if n > 1 && n < len(sorted) {
+		nFastest = n - 1
+		oldest := nFastest
+		for i := nFastest; i < len(sorted); i++ {
+			if latencies[sorted[i].Configuration.Name].measured.Before(
+				latencies[sorted[oldest].Configuration.Name].measured) {
+				oldest = i
+			}
+		}
+		friends[sorted[oldest].Configuration.Name] = sorted[oldest].Configuration.Address
+	}
+	for _, peer := range sorted[:nFastest] {
+		friends[peer.Configuration.Name] = peer.Configuration.Address
+	}
+
+	return friends, nil
+}
+
+// The RTT is smoothed with an exponential moving average.
+func recordLatency(friend string, rtt time.Duration, err error) {
+	if err != nil {
+		rtt = c_RTT_FAILURE
+	}
+
+	latency, measured := latencies[friend]
+	if measured {
+		rtt = time.Duration((1-c_RTT_SMOOTHING)*float64(latency.rtt) + c_RTT_SMOOTHING*float64(rtt))
+	}
+	latencies[friend] = peerLatency{rtt, time.Now()}
+}
+
+func forgetDepartedPeers(peers map[string]string) {
+	for peer := range latencies {
+		if _, ok := peers[peer]; !ok {
+			delete(latencies, peer)
+		}
+	}
+}
+
+// The peers are contacted in order of name starting after the last friend
+// of the previous round. Every round contacts at least the peers needed to
+// contact all of them in the given rounds.
+func chooseRoundRobinFriends(peers []cfg.Node, n int, rounds int) (map[string]string, error) {
+	if rounds > 0 && len(peers) > 0 {
+		perRound := (len(peers) + rounds - 1) / rounds
+		if perRound > n {
+			n = perRound
+		}
+	}
+	n, err := checkFriendsNumber(len(peers), n)
+	if err != nil {
+		return nil, err
+	}
+
+	sorted := make([]cfg.Node, len(peers))
+	copy(sorted, peers)
+	sort.Sort(byName(sorted))
+
+	start := sort.Search(len(sorted), func(i int) bool {
+		return sorted[i].Configuration.Name > lastFriend
+	})
+	friends := make(map[string]string, n)
+	for i := 0; i < n; i++ {
+		peer := sorted[(start+i)%len(sorted)]
+		friends[peer.Configuration.Name] = peer.Configuration.Address
+		lastFriend = peer.Configuration.Name
+	}
+
+	return friends, nil
+}
+
+func peerAddresses(peers []cfg.Node) map[string]string {
+	addresses := make(map[string]string, len(peers))
+	for _, peer := range peers {
+		addresses[peer.Configuration.Name] = peer.Configuration.Address
+	}
+
+	return addresses
+}
+
+type byName []cfg.Node
+
+func (p byName) Len() int           { return len(p) }
+func (p byName) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
+func (p byName) Less(i, j int) bool { return p[i].Configuration.Name < p[j].Configuration.Name }
+
+type byLatency []cfg.Node
+
+func (p byLatency) Len() int      { return len(p) }
+func (p byLatency) Swap(i, j int) { p[i], p[j] = p[j], p[i] }
+func (p byLatency) Less(i, j int) bool {
+	rttI := latencies[p[i].Configuration.Name].rtt
+	rttJ := latencies[p[j].Configuration.Name].rtt
+	if rttI != rttJ {
+		return rttI < rttJ
+	}
+	return p[i].Configuration.Name < p[j].Configuration.Name
+}
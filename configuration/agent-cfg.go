@@ -7,22 +7,44 @@ type Agent struct {
 	Storage       StorageConfig       `json:"storage"`
 	Metric        MetricConfig        `json:"metric"`
 	Discovery     DiscoveryConfig     `json:"discovery"`
+	Auth          AuthConfig          `json:"auth"`
 }
 
 type DockerConfig struct {
-	DaemonUrl     string `json:"daemonurl"`
-	DaemonTimeout int    `json:"daemontimeout"`
+	DaemonUrl     string                  `json:"daemonurl"`
+	DaemonTimeout int                     `json:"daemontimeout"`
+	Registries    map[string]RegistryAuth `json:"registries"`
+	AdoptLegacy   bool                    `json:"adoptlegacy"`
+}
+
+type RegistryAuth struct {
+	Username      string `json:"username"`
+	Password      string `json:"password"`
+	Email         string `json:"email"`
+	RegistryToken string `json:"registrytoken"`
 }
 
 type AutonomicConfig struct {
-	LoopTimeInterval int    `json:"looptimeinterval"`
-	PlannerStrategy  string `json:"plannerstrategy"`
-	EnableLogReading bool   `json:"enableLogReading"`
+	LoopTimeInterval  int    `json:"looptimeinterval"`
+	PlannerStrategy   string `json:"plannerstrategy"`
+	EnableLogReading  bool   `json:"enableLogReading"`
+	MaxActionsPerLoop int    `json:"maxactionsperloop"`
+	Coordination      string `json:"coordination"`
+	Mode              string `json:"mode"`
+	ActionTimeout     int    `json:"actiontimeout"`
+	ActionRetries     int    `json:"actionretries"`
+	ActionWorkers     int    `json:"actionworkers"`
 }
 
 type CommunicationConfig struct {
-	LoopTimeInterval int `json:"looptimeinterval"`
-	MaxFriends       int `json:"maxfriends"`
+	LoopTimeInterval int     `json:"looptimeinterval"`
+	MaxFriends       int     `json:"maxfriends"`
+	MaxAge           int     `json:"maxage"`
+	MergeWeighting   string  `json:"mergeweighting"`
+	DecayHalfLife    int     `json:"decayhalflife"`
+	FriendSelection  string  `json:"friendselection"`
+	RemoteFraction   float64 `json:"remotefraction"`
+	CoverageRounds   int     `json:"coveragerounds"`
 }
 
 type StorageConfig struct {
@@ -38,3 +60,15 @@ type DiscoveryConfig struct {
 	AppRoot string `json:"approot"`
 	TTL     int    `json:ttl`
 }
+
+// If no token is configured the API does not require authorization
+type AuthConfig struct {
+	Tokens   []AuthToken `json:"tokens"`
+	AuditLog string      `json:"auditlog"`
+}
+
+type AuthToken struct {
+	Name  string `json:"name"`
+	Token string `json:"token"`
+	Role  string `json:"role"`
+}
@@ -1,12 +1,21 @@
 package configuration
 
+import (
+	"errors"
+	"sync"
+)
+
 const (
+	ModeActive   = "active"
+	ModeAdvisory = "advisory"
+
 	c_AGENT_DOCKER    = "docker"
 	c_AGENT_AUTONOMIC = "autonomic"
 	c_AGENT_COM       = "communication"
 	c_AGENT_STORAGE   = "storage"
 	c_AGENT_METRIC    = "metric"
 	c_AGENT_DISCOVERY = "discovery"
+	c_AGENT_AUTH      = "auth"
 
 	c_NODE_CONFIG      = "config"
 	c_NODE_CONSTRAINTS = "constraints"
@@ -16,6 +25,11 @@ const (
 )
 
 var (
+	ErrInvalidMode error = errors.New("Mode not valid: it should be active or advisory")
+
+	mutex_mode    = sync.RWMutex{}
+	mutex_service = sync.RWMutex{}
+
 	agent       Agent
 	node        Node
 	services    []Service = []Service{}
@@ -28,6 +42,8 @@ func init() {
 }
 
 func SetAgent(cfg Agent) {
+	mutex_mode.Lock()
+	defer mutex_mode.Unlock()
 	agent = cfg
 }
 
@@ -59,6 +75,34 @@ func GetAgentDiscovery() *DiscoveryConfig {
 	return getAgentSubConfig(c_AGENT_DISCOVERY).(*DiscoveryConfig)
 }
 
+func GetAgentAuth() *AuthConfig {
+	return getAgentSubConfig(c_AGENT_AUTH).(*AuthConfig)
+}
+
+// The mode can be changed by the API while the agent is running, so it is
+// read and written only through these functions.
+func GetAgentMode() string {
+	mutex_mode.RLock()
+	defer mutex_mode.RUnlock()
+	if agent.Autonomic.Mode == "" {
+		return ModeActive
+	}
+
+	return agent.Autonomic.Mode
+}
+
+func SetAgentMode(mode string) error {
+	if mode != ModeActive && mode != ModeAdvisory {
+		return ErrInvalidMode
+	}
+
+	mutex_mode.Lock()
+	defer mutex_mode.Unlock()
+	agent.Autonomic.Mode = mode
+
+	return nil
+}
+
 func getAgentSubConfig(subCfg string) interface{} {
 	switch subCfg {
 	case c_AGENT_DOCKER:
@@ -73,6 +117,8 @@ func getAgentSubConfig(subCfg string) interface{} {
 		return &agent.Metric
 	case c_AGENT_DISCOVERY:
 		return &agent.Discovery
+	case c_AGENT_AUTH:
+		return &agent.Auth
 	}
 
 	return nil
@@ -126,6 +172,8 @@ func ClearNodeInstances() {
 }
 
 func SetServices(cfg []Service) {
+	mutex_service.Lock()
+	defer mutex_service.Unlock()
 	services = cfg
 }
 
@@ -153,11 +201,27 @@ func RemoveServices(rmServices []string) {
 	}
 }
 
+// The image is changed by the rolling updates, that run in the background
+func SetServiceImage(name string, image string, previous string) bool {
+	mutex_service.Lock()
+	defer mutex_service.Unlock()
+	for i := range services {
+		if services[i].Name == name {
+			services[i].Image = image
+			services[i].PreviousImage = previous
+			return true
+		}
+	}
+
+	return false
+}
+
 func CleanServices() {
 	services = make([]Service, 0)
 }
 
 func SetPolicy(cfg Policy) {
+	cfg.Schedule.Location = loadScheduleLocation(cfg.Schedule.Timezone)
 	policy = cfg
 }
 
@@ -6,6 +6,8 @@ type Node struct {
 	Resources     NodeResources   `json:"resources"`
 	Instances     ServiceStatus   `json:"instances"`
 	Active        bool            `json:"active"`
+	// The node works on cached data because the discovery is unreachable
+	Degraded bool `json:"degraded"`
 }
 
 type NodeConfig struct {
@@ -14,12 +16,16 @@ type NodeConfig struct {
 	Address string `json:"address"`
 	Cluster string `json:"cluster"`
 	Remote  string `json:"remote"`
+	// Topology labels used to choose the friends
+	Zone string `json:"zone"`
+	Rack string `json:"rack"`
 }
 
-// Is this still necessary?
 type NodeConstraints struct {
 	CpuMin       float64  `json:"cpumin"`
 	CpuMax       float64  `json:"cpumax"`
+	MemMin       float64  `json:"memmin"`
+	MemMax       float64  `json:"memmax"`
 	BaseServices []string `json:"baseservices"`
 }
 
@@ -1,9 +1,16 @@
 package configuration
 
+import (
+	"time"
+
+	log "github.com/elleFlorio/gru/Godeps/_workspace/src/github.com/Sirupsen/logrus"
+)
+
 type Policy struct {
 	Scalein  PolicyConfig
 	Scaleout PolicyConfig
 	Swap     PolicyConfig
+	Schedule ScheduleConfig
 }
 
 type PolicyConfig struct {
@@ -12,3 +19,35 @@ type PolicyConfig struct {
 	Metrics   []string
 	Analytics []string
 }
+
+type ScheduleConfig struct {
+	Enable   bool
+	Weight   float64
+	Timezone string
+	Rules    []ScheduleRule
+	// Resolved from the timezone when the policy is set
+	Location *time.Location `json:"-"`
+}
+
+type ScheduleRule struct {
+	Service      string
+	Days         string
+	Start        string
+	End          string
+	MinInstances int
+	MaxInstances int
+}
+
+func loadScheduleLocation(timezone string) *time.Location {
+	if timezone == "" {
+		return time.Local
+	}
+
+	location, err := time.LoadLocation(timezone)
+	if err != nil {
+		log.WithField("timezone", timezone).Warnln("Cannot load schedule timezone, using UTC")
+		return time.UTC
+	}
+
+	return location
+}
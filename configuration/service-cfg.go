@@ -4,14 +4,24 @@ type Service struct {
 	Name          string             `json:"name"`
 	Type          string             `json:"type"`
 	Image         string             `json:"image"`
+	PreviousImage string             `json:"previousimage"`
 	Remote        string             `json:"remote"`
 	DiscoveryPort string             `json:"discoveryport"`
 	Instances     ServiceStatus      `json:"instances"`
 	Analytics     []string           `json:"analytics"`
 	Constraints   map[string]float64 `json:"constraints"`
+	DependsOn     []string           `json:"dependson"`
+	PropagateAt   int                `json:"propagateat"`
+	Drain         ServiceDrain       `json:"drain"`
 	Docker        ServiceDocker      `json:"configuration"`
 }
 
+type ServiceDrain struct {
+	Period      int      `json:"period"`
+	PreStopHTTP string   `json:"prestophttp"`
+	PreStopExec []string `json:"prestopexec"`
+}
+
 type ServiceStatus struct {
 	All     []string `json:"all"`
 	Running []string `json:"running"`
@@ -21,15 +31,60 @@ type ServiceStatus struct {
 }
 
 type ServiceDocker struct {
-	Env         map[string]string   `json:"env"`
-	Volumes     map[string]struct{} `json:"volumes"`
-	Entrypoint  []string            `json:"entrypoint"`
-	Memory      string              `json:"memory"`
-	CPUnumber   int                 `json:"cpunumber"`
-	CpuShares   int64               `json:"cpushares"`
-	CpusetCpus  string              `json:"cpusetcpus"`
-	Links       []string            `json:"links"`
-	Ports       map[string]string   `json:"ports"`
-	Cmd         []string            `json:"cmd"`
-	StopTimeout int                 `json:"stoptimeout"`
+	Env           map[string]string     `json:"env"`
+	Volumes       map[string]struct{}   `json:"volumes"`
+	Binds         []string              `json:"binds"`
+	Entrypoint    []string              `json:"entrypoint"`
+	Memory        string                `json:"memory"`
+	CPUnumber     int                   `json:"cpunumber"`
+	CpuShares     int64                 `json:"cpushares"`
+	CpusetCpus    string                `json:"cpusetcpus"`
+	Links         []string              `json:"links"`
+	Ports         map[string]string     `json:"ports"`
+	PortsConfig   map[string]PortConfig `json:"portsconfig"`
+	Cmd           []string              `json:"cmd"`
+	StopTimeout   int                   `json:"stoptimeout"`
+	PullPolicy    string                `json:"pullpolicy"`
+	RestartPolicy RestartPolicy         `json:"restartpolicy"`
+	Labels        map[string]string     `json:"labels"`
+	NetworkMode   string                `json:"networkmode"`
+	Dns           []string              `json:"dns"`
+	DnsSearch     []string              `json:"dnssearch"`
+	DnsOptions    []string              `json:"dnsoptions"`
+	Ulimits       []Ulimit              `json:"ulimits"`
+	CapAdd        []string              `json:"capadd"`
+	CapDrop       []string              `json:"capdrop"`
+	User          string                `json:"user"`
+	WorkingDir    string                `json:"workingdir"`
+	LogConfig     LogConfig             `json:"logconfig"`
+	Healthcheck   Healthcheck           `json:"healthcheck"`
+}
+
+// The configuration of a port is identified by the guest port
+type PortConfig struct {
+	Protocol string `json:"protocol"`
+	HostIp   string `json:"hostip"`
+}
+
+type RestartPolicy struct {
+	Name              string `json:"name"`
+	MaximumRetryCount int64  `json:"maximumretrycount"`
+}
+
+type Ulimit struct {
+	Name string `json:"name"`
+	Soft uint64 `json:"soft"`
+	Hard uint64 `json:"hard"`
+}
+
+type LogConfig struct {
+	Type   string            `json:"type"`
+	Config map[string]string `json:"config"`
+}
+
+type Healthcheck struct {
+	Test     []string `json:"test"`
+	Interval string   `json:"interval"`
+	Timeout  string   `json:"timeout"`
+	Retries  int      `json:"retries"`
 }
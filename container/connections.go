@@ -0,0 +1,74 @@
+package container
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const c_TCP_ESTABLISHED = "01"
+
+// The /proc of the host is used to read the sockets in the network
+// namespace of the container, so it should be mounted if Gru is running
+// inside a container.
+var procRoot = "/proc"
+
+// The connections are the established TCP connections on the given ports
+// of the container.
+func CountConnections(id string, ports []string) (int, error) {
+	info, err := docker.Client.InspectContainer(id)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, file := range []string{"tcp", "tcp6"} {
+		path := fmt.Sprintf("%s/%d/net/%s", procRoot, info.State.Pid, file)
+		n, err := countEstablished(path, ports)
+		if err != nil {
+			if os.IsNotExist(err) && file == "tcp6" {
+				continue
+			}
+			return 0, err
+		}
+		count += n
+	}
+
+	return count, nil
+}
+
+func countEstablished(path string, ports []string) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	hexPorts := make(map[string]bool, len(ports))
+	for _, port := range ports {
+		if value, err := strconv.Atoi(port); err == nil {
+			hexPorts[fmt.Sprintf("%04X", value)] = true
+		}
+	}
+
+	count := 0
+	scanner := bufio.NewScanner(f)
+	// The first line is the header
+	scanner.Scan()
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 4 || fields[3] != c_TCP_ESTABLISHED {
+			continue
+		}
+
+		local := fields[1]
+		port := local[strings.LastIndex(local, ":")+1:]
+		if hexPorts[port] {
+			count++
+		}
+	}
+
+	return count, scanner.Err()
+}
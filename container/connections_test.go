@@ -0,0 +1,37 @@
+package container
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/elleFlorio/gru/Godeps/_workspace/src/github.com/stretchr/testify/assert"
+)
+
+const mockTcp = `  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode
+   0: 00000000:C350 00000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 1001 1 0000000000000000 100 0 0 10 0
+   1: 0100007F:C350 0100007F:D431 01 00000000:00000000 00:00000000 00000000     0        0 1002 1 0000000000000000 20 4 30 10 -1
+   2: 0100007F:C350 0100007F:D432 01 00000000:00000000 00:00000000 00000000     0        0 1003 1 0000000000000000 20 4 30 10 -1
+   3: 0100007F:D431 0100007F:C350 01 00000000:00000000 00:00000000 00000000     0        0 1004 1 0000000000000000 20 4 30 10 -1
+   4: 0100007F:1F90 0100007F:D433 06 00000000:00000000 00:00000000 00000000     0        0 1005 1 0000000000000000 20 4 30 10 -1
+`
+
+func TestCountEstablished(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gru-proc")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "tcp")
+	assert.NoError(t, ioutil.WriteFile(path, []byte(mockTcp), 0644))
+
+	count, err := countEstablished(path, []string{"50000"})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, count)
+
+	count, err = countEstablished(path, []string{"8080"})
+	assert.NoError(t, err)
+	assert.Equal(t, 0, count)
+
+	_, err = countEstablished(filepath.Join(dir, "missing"), []string{"50000"})
+	assert.Error(t, err)
+}
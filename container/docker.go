@@ -1,6 +1,12 @@
 package container
 
 import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
 	"strings"
 	"time"
 
@@ -14,6 +20,15 @@ type DockerConfig struct {
 	Client        *dockerclient.DockerClient
 }
 
+// The vendored client does not support the healthcheck of the containers,
+// so it is sent by CreateContainer together with the container config.
+type HealthConfig struct {
+	Test     []string      `json:",omitempty"`
+	Interval time.Duration `json:",omitempty"`
+	Timeout  time.Duration `json:",omitempty"`
+	Retries  int           `json:",omitempty"`
+}
+
 var docker DockerConfig
 
 //TODO implement tls config
@@ -67,3 +82,48 @@ func createPortBindings(dockerBindings map[string][]dockerclient.PortBinding) ma
 
 	return portBindings
 }
+
+// The container is created with a request to the daemon, like the client
+// does, adding the healthcheck to the config if it is defined.
+func CreateContainer(config *dockerclient.ContainerConfig, healthcheck *HealthConfig, name string) (string, error) {
+	body, err := json.Marshal(struct {
+		*dockerclient.ContainerConfig
+		Healthcheck *HealthConfig `json:",omitempty"`
+	}{config, healthcheck})
+	if err != nil {
+		return "", err
+	}
+
+	uri := fmt.Sprintf("%s/%s/containers/create", docker.Client.URL.String(), dockerclient.APIVersion)
+	if name != "" {
+		values := url.Values{}
+		values.Set("name", name)
+		uri += "?" + values.Encode()
+	}
+	req, err := http.NewRequest("POST", uri, bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Add("Content-Type", "application/json")
+
+	resp, err := docker.Client.HTTPClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode >= 400 {
+		return "", fmt.Errorf("%s", strings.TrimSpace(string(data)))
+	}
+
+	created := dockerclient.RespContainersCreate{}
+	if err = json.Unmarshal(data, &created); err != nil {
+		return "", err
+	}
+
+	return created.Id, nil
+}
@@ -0,0 +1,259 @@
+package container
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/elleFlorio/gru/Godeps/_workspace/src/github.com/Sirupsen/logrus"
+	"github.com/elleFlorio/gru/Godeps/_workspace/src/github.com/samalba/dockerclient"
+
+	cfg "github.com/elleFlorio/gru/configuration"
+)
+
+const (
+	PullAlways       = "always"
+	PullIfNotPresent = "if-not-present"
+	PullNever        = "never"
+
+	c_DEFAULT_REGISTRY  = "docker.io"
+	c_PULL_BACKOFF_BASE = 10 * time.Second
+	c_PULL_BACKOFF_MAX  = 5 * time.Minute
+)
+
+var (
+	ErrImageNotPresent error = errors.New("Image not present and pull policy is never")
+	ErrPullBackoff     error = errors.New("Image pull failed recently, waiting for backoff")
+
+	pullFailures = make(map[string]pullFailure)
+	mutex_pull   = sync.Mutex{}
+
+	// The clock can be replaced to test the backoff deterministically
+	now = time.Now
+)
+
+type pullFailure struct {
+	count   int
+	retryAt time.Time
+}
+
+type pullProgress struct {
+	Status         string `json:"status"`
+	Progress       string `json:"progress"`
+	ID             string `json:"id"`
+	Error          string `json:"error"`
+	ProgressDetail struct {
+		Current int64 `json:"current"`
+		Total   int64 `json:"total"`
+	} `json:"progressDetail"`
+}
+
+// The image is pulled according to the pull policy of the service. The
+// default policy pulls the image only if it is not present in the node.
+func EnsureImage(image string, policy string) error {
+	if policy == PullAlways {
+		return pullWithBackoff(image)
+	}
+
+	present, err := IsImagePresent(image)
+	if err != nil {
+		return err
+	}
+	if present {
+		return nil
+	}
+
+	if policy == PullNever {
+		log.WithField("image", image).Errorln("Cannot start new instance")
+		return ErrImageNotPresent
+	}
+
+	return pullWithBackoff(image)
+}
+
+func IsImagePresent(image string) (bool, error) {
+	_, err := docker.Client.InspectImage(image)
+	if err == dockerclient.ErrNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+func pullWithBackoff(image string) error {
+	mutex_pull.Lock()
+	failure, failed := pullFailures[image]
+	mutex_pull.Unlock()
+	if failed && now().Before(failure.retryAt) {
+		log.WithFields(log.Fields{
+			"image":   image,
+			"retryat": failure.retryAt,
+		}).Warnln("Skipping image pull")
+		return ErrPullBackoff
+	}
+
+	err := PullImage(image)
+
+	mutex_pull.Lock()
+	defer mutex_pull.Unlock()
+	if err != nil {
+		failure.count += 1
+		failure.retryAt = now().Add(pullBackoff(failure.count))
+		pullFailures[image] = failure
+		return err
+	}
+
+	delete(pullFailures, image)
+	return nil
+}
+
+func pullBackoff(failures int) time.Duration {
+	backoff := c_PULL_BACKOFF_BASE
+	for i := 1; i < failures && backoff < c_PULL_BACKOFF_MAX; i++ {
+		backoff *= 2
+	}
+	if backoff > c_PULL_BACKOFF_MAX {
+		backoff = c_PULL_BACKOFF_MAX
+	}
+
+	return backoff
+}
+
+// The pull uses a client without the timeout of the docker client, because
+// downloading an image can take much longer than the other requests. For
+// this reason it is done before the START action, outside its timeout.
+func PullImage(image string) error {
+	repository, tag := splitImageTag(image)
+	values := url.Values{}
+	values.Set("fromImage", repository)
+	values.Set("tag", tag)
+	uri := fmt.Sprintf("%s/%s/images/create?%s", docker.Client.URL.String(), dockerclient.APIVersion, values.Encode())
+	req, err := http.NewRequest("POST", uri, nil)
+	if err != nil {
+		return err
+	}
+
+	registry := registryOf(repository)
+	if auth, ok := cfg.GetAgentDocker().Registries[registry]; ok {
+		encoded, err := encodeAuth(auth)
+		if err != nil {
+			return err
+		}
+		req.Header.Add("X-Registry-Auth", encoded)
+	}
+
+	log.WithFields(log.Fields{
+		"image":    repository + ":" + tag,
+		"registry": registry,
+	}).Infoln("Pulling image")
+
+	client := &http.Client{Transport: docker.Client.HTTPClient.Transport}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		data, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return err
+		}
+		return fmt.Errorf("%s", strings.TrimSpace(string(data)))
+	}
+
+	err = readPullProgress(image, resp.Body)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"image": image,
+			"err":   err,
+		}).Errorln("Cannot pull image")
+		return err
+	}
+
+	log.WithField("image", image).Infoln("Image pulled")
+	return nil
+}
+
+func readPullProgress(image string, body io.Reader) error {
+	decoder := json.NewDecoder(body)
+	for {
+		progress := pullProgress{}
+		err := decoder.Decode(&progress)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if progress.Error != "" {
+			return errors.New(progress.Error)
+		}
+
+		log.WithFields(log.Fields{
+			"image":    image,
+			"layer":    progress.ID,
+			"status":   progress.Status,
+			"progress": progress.Progress,
+		}).Debugln("Image pull progress")
+	}
+}
+
+func splitImageTag(image string) (string, string) {
+	if strings.Contains(image, "@") {
+		parts := strings.SplitN(image, "@", 2)
+		return parts[0], parts[1]
+	}
+
+	lastSlash := strings.LastIndex(image, "/")
+	lastColon := strings.LastIndex(image, ":")
+	if lastColon > lastSlash {
+		return image[:lastColon], image[lastColon+1:]
+	}
+
+	return image, "latest"
+}
+
+// The first component of the repository is a registry only if it looks
+// like a host (e.g. myregistry.com:5000/app), otherwise it is a user of
+// the default registry (e.g. elleflorio/service1).
+func registryOf(repository string) string {
+	parts := strings.SplitN(repository, "/", 2)
+	if len(parts) < 2 {
+		return c_DEFAULT_REGISTRY
+	}
+
+	first := parts[0]
+	if strings.ContainsAny(first, ".:") || first == "localhost" {
+		return first
+	}
+
+	return c_DEFAULT_REGISTRY
+}
+
+func encodeAuth(auth cfg.RegistryAuth) (string, error) {
+	var buf bytes.Buffer
+	dockerAuth := dockerclient.AuthConfig{
+		Username:      auth.Username,
+		Password:      auth.Password,
+		Email:         auth.Email,
+		RegistryToken: auth.RegistryToken,
+	}
+	if err := json.NewEncoder(&buf).Encode(dockerAuth); err != nil {
+		return "", err
+	}
+
+	return base64.URLEncoding.EncodeToString(buf.Bytes()), nil
+}
@@ -0,0 +1,176 @@
+package container
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/elleFlorio/gru/Godeps/_workspace/src/github.com/samalba/dockerclient"
+	"github.com/elleFlorio/gru/Godeps/_workspace/src/github.com/stretchr/testify/assert"
+
+	cfg "github.com/elleFlorio/gru/configuration"
+)
+
+type mockDaemon struct {
+	images   map[string]bool
+	pulls    int
+	fail     bool
+	lastAuth string
+	created  map[string]interface{}
+}
+
+func (m *mockDaemon) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.Method == "GET" && strings.HasSuffix(r.URL.Path, "/json"):
+		name := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/"+dockerclient.APIVersion+"/images/"), "/json")
+		if !m.images[name] {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		fmt.Fprint(w, `{"Id":"abc"}`)
+	case r.Method == "POST" && strings.HasSuffix(r.URL.Path, "/images/create"):
+		m.pulls += 1
+		m.lastAuth = r.Header.Get("X-Registry-Auth")
+		if m.fail {
+			fmt.Fprint(w, `{"status":"Pulling"}{"error":"pull access denied"}`)
+			return
+		}
+		fmt.Fprint(w, `{"status":"Downloading","id":"layer1","progress":"[==>  ]"}{"status":"Download complete","id":"layer1"}`)
+		m.images[r.URL.Query().Get("fromImage")+":"+r.URL.Query().Get("tag")] = true
+	case r.Method == "POST" && strings.HasSuffix(r.URL.Path, "/containers/create"):
+		m.created = make(map[string]interface{})
+		json.NewDecoder(r.Body).Decode(&m.created)
+		m.created["name"] = r.URL.Query().Get("name")
+		fmt.Fprint(w, `{"Id":"container1"}`)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func connectMockDaemon(t *testing.T, daemon *mockDaemon) *httptest.Server {
+	server := httptest.NewServer(daemon)
+	client, err := dockerclient.NewDockerClient(server.URL, nil)
+	assert.NoError(t, err)
+	docker.Client = client
+
+	return server
+}
+
+func TestEnsureImage(t *testing.T) {
+	defer func() { pullFailures = make(map[string]pullFailure) }()
+	daemon := &mockDaemon{images: map[string]bool{"test/present:latest": true}}
+	server := connectMockDaemon(t, daemon)
+	defer server.Close()
+
+	assert.NoError(t, EnsureImage("test/present:latest", PullIfNotPresent))
+	assert.Equal(t, 0, daemon.pulls)
+
+	assert.Equal(t, ErrImageNotPresent, EnsureImage("test/missing", PullNever))
+	assert.Equal(t, 0, daemon.pulls)
+
+	assert.NoError(t, EnsureImage("test/missing", ""))
+	assert.Equal(t, 1, daemon.pulls)
+	assert.True(t, daemon.images["test/missing:latest"])
+
+	assert.NoError(t, EnsureImage("test/present:latest", PullAlways))
+	assert.Equal(t, 2, daemon.pulls)
+}
+
+func TestPullBackoff(t *testing.T) {
+	defer func() { pullFailures = make(map[string]pullFailure) }()
+	defer func() { now = time.Now }()
+	daemon := &mockDaemon{images: map[string]bool{}, fail: true}
+	server := connectMockDaemon(t, daemon)
+	defer server.Close()
+
+	current := time.Unix(1000, 0)
+	now = func() time.Time { return current }
+
+	err := EnsureImage("test/denied", PullIfNotPresent)
+	assert.EqualError(t, err, "pull access denied")
+	assert.Equal(t, ErrPullBackoff, EnsureImage("test/denied", PullIfNotPresent))
+	assert.Equal(t, 1, daemon.pulls)
+
+	current = current.Add(c_PULL_BACKOFF_BASE)
+	assert.Error(t, EnsureImage("test/denied", PullIfNotPresent))
+	assert.Equal(t, 2, daemon.pulls)
+	assert.Equal(t, current.Add(2*c_PULL_BACKOFF_BASE), pullFailures["test/denied"].retryAt)
+
+	daemon.fail = false
+	current = current.Add(c_PULL_BACKOFF_MAX)
+	assert.NoError(t, EnsureImage("test/denied", PullIfNotPresent))
+	assert.Empty(t, pullFailures)
+
+	assert.Equal(t, c_PULL_BACKOFF_BASE, pullBackoff(1))
+	assert.Equal(t, 4*c_PULL_BACKOFF_BASE, pullBackoff(3))
+	assert.Equal(t, c_PULL_BACKOFF_MAX, pullBackoff(20))
+}
+
+func TestPullImageCredentials(t *testing.T) {
+	defer func() { cfg.GetAgentDocker().Registries = nil }()
+	daemon := &mockDaemon{images: map[string]bool{}}
+	server := connectMockDaemon(t, daemon)
+	defer server.Close()
+
+	cfg.GetAgentDocker().Registries = map[string]cfg.RegistryAuth{
+		"myregistry.com:5000": cfg.RegistryAuth{Username: "user", Password: "pwd"},
+	}
+
+	assert.NoError(t, PullImage("elleflorio/service1"))
+	assert.Empty(t, daemon.lastAuth)
+
+	assert.NoError(t, PullImage("myregistry.com:5000/app:1.0"))
+	assert.True(t, daemon.images["myregistry.com:5000/app:1.0"])
+	decoded, err := base64.URLEncoding.DecodeString(daemon.lastAuth)
+	assert.NoError(t, err)
+	auth := dockerclient.AuthConfig{}
+	assert.NoError(t, json.Unmarshal(decoded, &auth))
+	assert.Equal(t, "user", auth.Username)
+	assert.Equal(t, "pwd", auth.Password)
+}
+
+func TestSplitImage(t *testing.T) {
+	var repository, tag string
+	repository, tag = splitImageTag("elleflorio/service1")
+	assert.Equal(t, "elleflorio/service1", repository)
+	assert.Equal(t, "latest", tag)
+
+	repository, tag = splitImageTag("localhost:5000/app:1.0")
+	assert.Equal(t, "localhost:5000/app", repository)
+	assert.Equal(t, "1.0", tag)
+
+	repository, tag = splitImageTag("localhost:5000/app")
+	assert.Equal(t, "localhost:5000/app", repository)
+	assert.Equal(t, "latest", tag)
+
+	assert.Equal(t, "docker.io", registryOf("mysql"))
+	assert.Equal(t, "docker.io", registryOf("elleflorio/service1"))
+	assert.Equal(t, "localhost:5000", registryOf("localhost:5000/app"))
+	assert.Equal(t, "quay.io", registryOf("quay.io/user/app"))
+}
+
+func TestCreateContainer(t *testing.T) {
+	daemon := &mockDaemon{}
+	server := connectMockDaemon(t, daemon)
+	defer server.Close()
+
+	config := &dockerclient.ContainerConfig{Image: "test/image"}
+	healthcheck := &HealthConfig{Test: []string{"CMD", "true"}, Retries: 3}
+	id, err := CreateContainer(config, healthcheck, "service1_uuid")
+	assert.NoError(t, err)
+	assert.Equal(t, "container1", id)
+	assert.Equal(t, "service1_uuid", daemon.created["name"])
+	assert.Equal(t, "test/image", daemon.created["Image"])
+	if assert.Contains(t, daemon.created, "Healthcheck") {
+		assert.Equal(t, float64(3), daemon.created["Healthcheck"].(map[string]interface{})["Retries"])
+	}
+
+	id, err = CreateContainer(config, nil, "")
+	assert.NoError(t, err)
+	assert.NotContains(t, daemon.created, "Healthcheck")
+}
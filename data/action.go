@@ -0,0 +1,25 @@
+package data
+
+import (
+	"time"
+)
+
+const (
+	ActionQueued    = "queued"
+	ActionRunning   = "running"
+	ActionSucceeded = "succeeded"
+	ActionFailed    = "failed"
+	ActionTimedOut  = "timed-out"
+)
+
+type ActionRecord struct {
+	Id        string     `json:"id"`
+	Service   string     `json:"service"`
+	Actions   []string   `json:"actions"`
+	Status    string     `json:"status"`
+	Error     string     `json:"error,omitempty"`
+	Created   time.Time  `json:"created"`
+	Started   time.Time  `json:"started"`
+	Ended     time.Time  `json:"ended"`
+	Execution *Execution `json:"execution,omitempty"`
+}
@@ -0,0 +1,25 @@
+package data
+
+import (
+	"time"
+)
+
+type Advice struct {
+	Timestamp time.Time `json:"timestamp"`
+	Policy    string    `json:"policy"`
+	Target    string    `json:"target"`
+	Actions   []string  `json:"actions"`
+}
+
+type AdvisoryReport struct {
+	Since    time.Time                     `json:"since"`
+	Advices  []Advice                      `json:"advices"`
+	Services map[string]AdvisoryComparison `json:"services"`
+}
+
+type AdvisoryComparison struct {
+	AdvisedStart int `json:"advisedstart"`
+	AdvisedStop  int `json:"advisedstop"`
+	ActualStart  int `json:"actualstart"`
+	ActualStop   int `json:"actualstop"`
+}
@@ -3,15 +3,27 @@ package data
 import (
 	"encoding/json"
 	"errors"
+	"math"
+	"strconv"
+	"time"
 
 	log "github.com/elleFlorio/gru/Godeps/_workspace/src/github.com/Sirupsen/logrus"
 
+	cfg "github.com/elleFlorio/gru/configuration"
 	"github.com/elleFlorio/gru/enum"
 	srv "github.com/elleFlorio/gru/service"
 	"github.com/elleFlorio/gru/storage"
 	"github.com/elleFlorio/gru/utils"
 )
 
+const (
+	c_MAX_DECISIONS           = 100
+	c_DEFAULT_DECAY_HALF_LIFE = 60 * time.Second
+)
+
+// The clock can be replaced to test the time decay deterministically
+var sharedNow = time.Now
+
 func SaveStats(stats GruStats) {
 	err := saveData(stats, enum.STATS, enum.LOCAL)
 	if err != nil {
@@ -33,6 +45,60 @@ func SavePolicy(policy Policy) {
 	}
 }
 
+func SaveLearning(learning Learning) {
+	err := saveData(learning, enum.LEARNING, enum.LOCAL)
+	if err != nil {
+		log.WithField("err", err).Debugln("Cannot convert learning to data")
+	}
+}
+
+// Only the last c_MAX_DECISIONS decisions are kept
+func SaveDecision(decision Decision) {
+	decisions, err := GetDecisions()
+	if err != nil {
+		decisions = []Decision{}
+	}
+
+	decisions = append(decisions, decision)
+	if len(decisions) > c_MAX_DECISIONS {
+		decisions = decisions[len(decisions)-c_MAX_DECISIONS:]
+	}
+
+	err = saveData(decisions, enum.DECISIONS, enum.LOCAL)
+	if err != nil {
+		log.WithField("err", err).Debugln("Cannot convert decisions to data")
+	}
+}
+
+// The outcomes of the execution are attached to the decision that chose
+// the executed policies. A decision without executions keeps its outcomes.
+func SaveDecisionOutcomes(id string, outcomes []Execution) {
+	if len(outcomes) == 0 {
+		return
+	}
+
+	decisions, err := GetDecisions()
+	if err != nil {
+		log.Debugln("No decision to attach the outcomes to")
+		return
+	}
+
+	for i := len(decisions) - 1; i >= 0; i-- {
+		if decisions[i].ID != id {
+			continue
+		}
+
+		decisions[i].Outcomes = outcomes
+		err = saveData(decisions, enum.DECISIONS, enum.LOCAL)
+		if err != nil {
+			log.WithField("err", err).Debugln("Cannot convert decisions to data")
+		}
+		return
+	}
+
+	log.WithField("decision", id).Debugln("No decision to attach the outcomes to")
+}
+
 func SaveSharedLocal(info Shared) {
 	err := saveData(info, enum.SHARED, enum.LOCAL)
 	if err != nil {
@@ -75,6 +141,18 @@ func saveData(data interface{}, dataType enum.Datatype, dataOwner enum.DataOwner
 		if err != nil {
 			return err
 		}
+	case enum.LEARNING:
+		learning := data.(Learning)
+		encoded, err = json.Marshal(learning)
+		if err != nil {
+			return err
+		}
+	case enum.DECISIONS:
+		decisions := data.([]Decision)
+		encoded, err = json.Marshal(decisions)
+		if err != nil {
+			return err
+		}
 	default:
 		return errors.New("Cannot save data: unknown data type")
 	}
@@ -114,6 +192,58 @@ func GetPolicy() (Policy, error) {
 	return policy.(Policy), nil
 }
 
+func GetLearning() (Learning, error) {
+	learning, err := getData(enum.LEARNING, enum.LOCAL)
+	if err != nil {
+		log.WithField("err", err).Warnln("Cannot get learning data")
+		return Learning{}, err
+	}
+
+	return learning.(Learning), nil
+}
+
+func GetDecisions() ([]Decision, error) {
+	decisions, err := getData(enum.DECISIONS, enum.LOCAL)
+	if err != nil {
+		log.WithField("err", err).Debugln("Cannot get decisions data")
+		return []Decision{}, err
+	}
+
+	return decisions.([]Decision), nil
+}
+
+// A zero time means no bound. An empty service name matches every decision.
+func FilterDecisions(decisions []Decision, service string, since time.Time, until time.Time) []Decision {
+	filtered := []Decision{}
+	for _, decision := range decisions {
+		if !since.IsZero() && decision.Timestamp.Before(since) {
+			continue
+		}
+
+		if !until.IsZero() && decision.Timestamp.After(until) {
+			continue
+		}
+
+		if service != "" && !decisionInvolves(decision, service) {
+			continue
+		}
+
+		filtered = append(filtered, decision)
+	}
+
+	return filtered
+}
+
+func decisionInvolves(decision Decision, service string) bool {
+	for _, plc := range decision.Candidates {
+		if utils.ContainsString(plc.Targets, service) {
+			return true
+		}
+	}
+
+	return false
+}
+
 func GetSharedLocal() (Shared, error) {
 	info, err := getData(enum.SHARED, enum.LOCAL)
 	if err != nil {
@@ -181,6 +311,28 @@ func getData(dataType enum.Datatype, dataOwner enum.DataOwner) (interface{}, err
 				return nil, err
 			}
 		}
+	case enum.LEARNING:
+		data = Learning{}
+		dataLearning, err := storage.GetData(dataOwner.ToString(), dataType)
+		if err != nil {
+			return nil, err
+		} else {
+			data, err = ByteToLearning(dataLearning)
+			if err != nil {
+				return nil, err
+			}
+		}
+	case enum.DECISIONS:
+		data = []Decision{}
+		dataDecisions, err := storage.GetData(dataOwner.ToString(), dataType)
+		if err != nil {
+			return nil, err
+		} else {
+			data, err = ByteToDecisions(dataDecisions)
+			if err != nil {
+				return nil, err
+			}
+		}
 	}
 
 	return data, nil
@@ -223,6 +375,18 @@ func ByteToPolicy(data []byte) (Policy, error) {
 
 }
 
+func ByteToDecisions(data []byte) ([]Decision, error) {
+	decisions := []Decision{}
+	err := json.Unmarshal(data, &decisions)
+	if err != nil {
+		log.WithField("err", err).Warnln("Cannot convert byte to decisions")
+		return []Decision{}, err
+	}
+
+	return decisions, nil
+
+}
+
 func ByteToShared(data []byte) (Shared, error) {
 	info := Shared{}
 	err := json.Unmarshal(data, &info)
@@ -235,80 +399,125 @@ func ByteToShared(data []byte) (Shared, error) {
 
 }
 
+func ByteToLearning(data []byte) (Learning, error) {
+	learning := Learning{}
+	err := json.Unmarshal(data, &learning)
+	if err != nil {
+		log.WithField("err", err).Warnln("Cannot conver byte to learning")
+		return Learning{}, err
+	}
+
+	return learning, nil
+
+}
+
+// The shared data of the nodes are merged using the weighting configured
+// in the communication of the agent.
 func MergeShared(toMerge []Shared) (Shared, error) {
+	comCfg := cfg.GetAgentCommunication()
+	halfLife := time.Duration(comCfg.DecayHalfLife) * time.Second
+	return MergeSharedWeighted(toMerge, comCfg.MergeWeighting, halfLife)
+}
+
+// The values of a node can be weighted by the number of instances it runs,
+// by the age of the data (the weight halves every halfLife), or equally.
+func MergeSharedWeighted(toMerge []Shared, weighting string, halfLife time.Duration) (Shared, error) {
 	if len(toMerge) < 1 {
 		return Shared{}, errors.New("No shared data to merge")
 	}
 
+	if weighting != WeightingInstances && weighting != WeightingDecay {
+		weighting = WeightingMean
+	}
+	if halfLife <= 0 {
+		halfLife = c_DEFAULT_DECAY_HALF_LIFE
+	}
+
 	if len(toMerge) == 1 {
-		return toMerge[0], nil
+		single := toMerge[0]
+		single.Weighting = weighting
+		single.Weights = map[string]SharedWeights{
+			nodeKey(single, 0): singleWeights(single),
+		}
+		return single, nil
 	}
 
 	merged := Shared{
-		Service: make(map[string]ServiceShared),
+		Service:   make(map[string]ServiceShared),
+		Weighting: weighting,
+		Weights:   make(map[string]SharedWeights, len(toMerge)),
+	}
+	for i, data := range toMerge {
+		merged.Weights[nodeKey(data, i)] = SharedWeights{Service: make(map[string]float64)}
 	}
 
+	now := sharedNow()
 	for _, name := range srv.List() {
 		srvMerged := ServiceShared{}
 		baseValues := make(map[string][]float64)
+		baseWeights := make(map[string][]float64)
 		userValues := make(map[string][]float64)
-		for _, data := range toMerge {
+		userWeights := make(map[string][]float64)
+		for i, data := range toMerge {
 			if data.Service[name].Active {
 				srvMerged.Active = true
+				srvMerged.Instances += data.Service[name].Instances
+				if data.Service[name].Timestamp.After(srvMerged.Timestamp) {
+					srvMerged.Timestamp = data.Service[name].Timestamp
+				}
+
+				weight := computeWeight(weighting, data.Service[name].Instances, data.Service[name].Timestamp, halfLife, now)
+				merged.Weights[nodeKey(data, i)].Service[name] = weight
 
 				for analytics, value := range data.Service[name].Data.BaseShared {
 					baseValues[analytics] = append(baseValues[analytics], value)
+					baseWeights[analytics] = append(baseWeights[analytics], weight)
 				}
 
 				for analytics, value := range data.Service[name].Data.UserShared {
 					userValues[analytics] = append(userValues[analytics], value)
+					userWeights[analytics] = append(userWeights[analytics], weight)
 				}
 			}
 		}
 
-		baseMerged := make(map[string]float64, len(baseValues))
-		for analytics, values := range baseValues {
-			baseMerged[analytics] = utils.Mean(values)
-		}
-
-		userMerged := make(map[string]float64, len(userValues))
-		for analytics, values := range userValues {
-			userMerged[analytics] = utils.Mean(values)
-		}
-
-		srvMerged.Data.BaseShared = baseMerged
-		srvMerged.Data.UserShared = userMerged
+		srvMerged.Data.BaseShared = mergeValues(baseValues, baseWeights)
+		srvMerged.Data.UserShared = mergeValues(userValues, userWeights)
 		merged.Service[name] = srvMerged
 	}
 
 	sysMerged := SystemShared{}
 	baseValues := make(map[string][]float64)
+	baseWeights := make(map[string][]float64)
 	userValues := make(map[string][]float64)
-	for _, data := range toMerge {
+	userWeights := make(map[string][]float64)
+	for i, data := range toMerge {
+		sysMerged.Instances += data.System.Instances
+		if data.System.Timestamp.After(sysMerged.Timestamp) {
+			sysMerged.Timestamp = data.System.Timestamp
+		}
+
+		weight := computeWeight(weighting, data.System.Instances, data.System.Timestamp, halfLife, now)
+		key := nodeKey(data, i)
+		weights := merged.Weights[key]
+		weights.System = weight
+		merged.Weights[key] = weights
 
 		for analytics, value := range data.System.Data.BaseShared {
 			baseValues[analytics] = append(baseValues[analytics], value)
+			baseWeights[analytics] = append(baseWeights[analytics], weight)
 		}
 
 		for analytics, value := range data.System.Data.UserShared {
 			userValues[analytics] = append(userValues[analytics], value)
+			userWeights[analytics] = append(userWeights[analytics], weight)
 		}
 
 		sysMerged.ActiveServices = checkAndAppend(sysMerged.ActiveServices, data.System.ActiveServices)
 	}
 
-	baseMerged := make(map[string]float64, len(baseValues))
-	for analytics, values := range baseValues {
-		baseMerged[analytics] = utils.Mean(values)
-	}
-
-	userMerged := make(map[string]float64, len(userValues))
-	for analytics, values := range userValues {
-		userMerged[analytics] = utils.Mean(values)
-	}
-
-	sysMerged.Data.BaseShared = baseMerged
-	sysMerged.Data.UserShared = userMerged
+	sysMerged.Data.BaseShared = mergeValues(baseValues, baseWeights)
+	sysMerged.Data.UserShared = mergeValues(userValues, userWeights)
 	merged.System = sysMerged
 
 	return merged, nil
@@ -382,6 +591,60 @@ func MergeShared(toMerge []Shared) (Shared, error) {
 	// merged.System = mergedSystem
 }
 
+// The data without instances or timestamp (e.g. sent by older agents) get
+// the weight of a single instance and of fresh data.
+func computeWeight(weighting string, instances int, timestamp time.Time, halfLife time.Duration, now time.Time) float64 {
+	switch weighting {
+	case WeightingInstances:
+		if instances < 1 {
+			return 1.0
+		}
+		return float64(instances)
+	case WeightingDecay:
+		if timestamp.IsZero() {
+			return 1.0
+		}
+		age := now.Sub(timestamp)
+		if age < 0 {
+			age = 0
+		}
+		return math.Pow(0.5, age.Seconds()/halfLife.Seconds())
+	}
+
+	return 1.0
+}
+
+func mergeValues(values map[string][]float64, weights map[string][]float64) map[string]float64 {
+	merged := make(map[string]float64, len(values))
+	for analytics, toMerge := range values {
+		merged[analytics] = utils.WeightedMean(toMerge, weights[analytics])
+	}
+
+	return merged
+}
+
+func singleWeights(data Shared) SharedWeights {
+	weights := SharedWeights{
+		Service: make(map[string]float64, len(data.Service)),
+		System:  1.0,
+	}
+	for name, srvShared := range data.Service {
+		if srvShared.Active {
+			weights.Service[name] = 1.0
+		}
+	}
+
+	return weights
+}
+
+func nodeKey(data Shared, index int) string {
+	if data.Node != "" {
+		return data.Node
+	}
+
+	return "#" + strconv.Itoa(index)
+}
+
 func checkAndAppend(list []string, toAppend []string) []string {
 	if len(list) == 0 {
 		return append(list, toAppend...)
@@ -2,7 +2,9 @@ package data
 
 import (
 	"encoding/json"
+	"fmt"
 	"testing"
+	"time"
 
 	"github.com/elleFlorio/gru/Godeps/_workspace/src/github.com/stretchr/testify/assert"
 
@@ -186,6 +188,83 @@ func TestGetPolicy(t *testing.T) {
 	assert.Equal(t, expected, policy)
 }
 
+func TestGetLearning(t *testing.T) {
+	defer storage.DeleteAllData(enum.LEARNING)
+	var err error
+
+	_, err = GetLearning()
+	assert.Error(t, err)
+
+	expected := Learning{
+		Values: map[string]float64{"s|a": 0.5},
+		Visits: map[string]int{"s|a": 1},
+	}
+	SaveLearning(expected)
+	learning, err := GetLearning()
+	assert.NoError(t, err)
+	assert.Equal(t, expected, learning)
+}
+
+func TestGetDecisions(t *testing.T) {
+	defer storage.DeleteAllData(enum.DECISIONS)
+	var err error
+
+	_, err = GetDecisions()
+	assert.Error(t, err)
+
+	policies := CreateRandomMockPolicies(1)
+	for i := 0; i < c_MAX_DECISIONS+5; i++ {
+		SaveDecision(Decision{
+			ID:         fmt.Sprintf("decision%d", i),
+			Timestamp:  time.Unix(int64(i), 0).UTC(),
+			Strategy:   "dummy",
+			Candidates: policies,
+			Chosen:     policies[:1],
+		})
+	}
+
+	decisions, err := GetDecisions()
+	assert.NoError(t, err)
+	assert.Len(t, decisions, c_MAX_DECISIONS)
+	assert.Equal(t, time.Unix(5, 0).UTC(), decisions[0].Timestamp)
+	assert.Equal(t, policies, decisions[0].Candidates)
+
+	outcomes := []Execution{Execution{Policy: "dummy", Outcome: OutcomeRolledBack}}
+	last := fmt.Sprintf("decision%d", c_MAX_DECISIONS+4)
+	SaveDecisionOutcomes(last, outcomes)
+	decisions, _ = GetDecisions()
+	assert.Empty(t, decisions[0].Outcomes)
+	assert.Equal(t, outcomes, decisions[len(decisions)-1].Outcomes)
+
+	// The outcomes are never replaced by empty ones, nor attached to
+	// another decision
+	SaveDecisionOutcomes(last, []Execution{})
+	SaveDecisionOutcomes("decision0", outcomes)
+	decisions, _ = GetDecisions()
+	assert.Equal(t, outcomes, decisions[len(decisions)-1].Outcomes)
+	assert.Empty(t, decisions[len(decisions)-2].Outcomes)
+}
+
+func TestFilterDecisions(t *testing.T) {
+	plc1 := CreateMockPolicy("scaleout", 0.5, []string{"service1"}, nil)
+	plc2 := CreateMockPolicy("scalein", 0.5, []string{"service2"}, nil)
+	decisions := []Decision{
+		Decision{Timestamp: time.Unix(10, 0), Candidates: []Policy{plc1}},
+		Decision{Timestamp: time.Unix(20, 0), Candidates: []Policy{plc1, plc2}},
+		Decision{Timestamp: time.Unix(30, 0), Candidates: []Policy{plc2}},
+	}
+
+	assert.Len(t, FilterDecisions(decisions, "", time.Time{}, time.Time{}), 3)
+	assert.Len(t, FilterDecisions(decisions, "service1", time.Time{}, time.Time{}), 2)
+	assert.Len(t, FilterDecisions(decisions, "service3", time.Time{}, time.Time{}), 0)
+	assert.Len(t, FilterDecisions(decisions, "", time.Unix(15, 0), time.Time{}), 2)
+	assert.Len(t, FilterDecisions(decisions, "", time.Time{}, time.Unix(20, 0)), 2)
+
+	filtered := FilterDecisions(decisions, "service2", time.Unix(15, 0), time.Unix(25, 0))
+	assert.Len(t, filtered, 1)
+	assert.Equal(t, time.Unix(20, 0), filtered[0].Timestamp)
+}
+
 func TestGeShared(t *testing.T) {
 	defer storage.DeleteAllData(enum.SHARED)
 	var err error
@@ -254,3 +333,122 @@ func TestMergeInfo(t *testing.T) {
 	_, err = MergeShared(one)
 	assert.NoError(t, err)
 }
+
+func TestGossipExchange(t *testing.T) {
+	defer CleanGossip()
+	defer func() { gossipNow = time.Now }()
+	defer service.ClearMockServices()
+	service.SetMockServices()
+	current := time.Now()
+	gossipNow = func() time.Time { return current }
+
+	local := UpdateGossipLocal("node1", CreateMockShared())
+	assert.Equal(t, uint64(1), local.Version)
+	local = UpdateGossipLocal("node1", CreateMockShared())
+	assert.Equal(t, uint64(2), local.Version)
+
+	remote := GossipEntry{Node: "node2", Version: 5, Shared: CreateMockShared()}
+	assert.Equal(t, 1, MergeGossipEntries("node1", []GossipEntry{remote}))
+	remote.Version = 4
+	assert.Equal(t, 0, MergeGossipEntries("node1", []GossipEntry{remote}))
+	assert.Equal(t, GossipDigest{"node1": 2, "node2": 5}, GetGossipDigest())
+
+	delta := GetGossipDelta(GossipDigest{"node2": 5})
+	if assert.Len(t, delta, 1) {
+		assert.Equal(t, "node1", delta[0].Node)
+	}
+	assert.Empty(t, GetGossipDelta(GetGossipDigest()))
+
+	// The entry of this node received from a restarted agent is overridden
+	MergeGossipEntries("node1", []GossipEntry{GossipEntry{Node: "node1", Version: 7}})
+	assert.Equal(t, uint64(8), GetGossipDigest()["node1"])
+
+	cluster, err := ComputeGossipCluster(time.Minute)
+	assert.NoError(t, err)
+	assert.Equal(t, 0.6, cluster.Service["service1"].Data.BaseShared[enum.METRIC_CPU_AVG.ToString()])
+}
+
+func TestGossipTombstones(t *testing.T) {
+	defer CleanGossip()
+	defer func() { gossipNow = time.Now }()
+	current := time.Now()
+	gossipNow = func() time.Time { return current }
+
+	UpdateGossipLocal("node1", Shared{})
+	MergeGossipEntries("node1", []GossipEntry{
+		GossipEntry{Node: "node2", Version: 3},
+		GossipEntry{Node: "node3", Version: 1},
+	})
+
+	RemoveGossipNodes("node1", map[string]string{"node3": "address3"})
+	entries := GetGossipEntries()
+	assert.True(t, entries[1].Tombstone)
+	assert.False(t, entries[2].Tombstone)
+
+	// The tombstone wins over the entry with the same version
+	assert.Equal(t, 0, MergeGossipEntries("node1", []GossipEntry{GossipEntry{Node: "node2", Version: 3}}))
+	assert.Len(t, GetGossipDelta(GossipDigest{"node2": 3, "node1": 1, "node3": 1}), 1)
+
+	// The old tombstone is removed while the old entry becomes a tombstone
+	current = current.Add(2 * time.Minute)
+	_, err := ComputeGossipCluster(time.Minute)
+	assert.Equal(t, ErrNoGossipEntries, err)
+	ExpireGossipEntries("node1", time.Minute)
+	entries = GetGossipEntries()
+	if assert.Len(t, entries, 2) {
+		assert.Equal(t, "node3", entries[1].Node)
+		assert.True(t, entries[1].Tombstone)
+	}
+
+	current = current.Add(2 * time.Minute)
+	ExpireGossipEntries("node1", time.Minute)
+	entries = GetGossipEntries()
+	if assert.Len(t, entries, 1) {
+		assert.Equal(t, "node1", entries[0].Node)
+	}
+}
+
+func TestMergeSharedWeighted(t *testing.T) {
+	defer service.ClearMockServices()
+	defer func() { sharedNow = time.Now }()
+	service.SetMockServices()
+	current := time.Now()
+	sharedNow = func() time.Time { return current }
+	cpu := enum.METRIC_CPU_AVG.ToString()
+
+	small := CreateMockShared()
+	small.Node = "node1"
+	srvSmall := small.Service["service1"]
+	srvSmall.Data.BaseShared = map[string]float64{cpu: 0.2}
+	srvSmall.Instances = 1
+	srvSmall.Timestamp = current.Add(-2 * time.Minute)
+	small.Service["service1"] = srvSmall
+
+	big := CreateMockShared()
+	big.Node = "node2"
+	srvBig := big.Service["service1"]
+	srvBig.Data.BaseShared = map[string]float64{cpu: 0.8}
+	srvBig.Instances = 3
+	srvBig.Timestamp = current
+	big.Service["service1"] = srvBig
+
+	toMerge := []Shared{small, big}
+	merged, err := MergeSharedWeighted(toMerge, WeightingMean, time.Minute)
+	assert.NoError(t, err)
+	assert.Equal(t, WeightingMean, merged.Weighting)
+	assert.InDelta(t, 0.5, merged.Service["service1"].Data.BaseShared[cpu], 1e-9)
+
+	merged, _ = MergeSharedWeighted(toMerge, WeightingInstances, time.Minute)
+	assert.InDelta(t, 0.65, merged.Service["service1"].Data.BaseShared[cpu], 1e-9)
+	assert.Equal(t, 4, merged.Service["service1"].Instances)
+	assert.Equal(t, 3.0, merged.Weights["node2"].Service["service1"])
+
+	// The data of node1 is two half-lives old
+	merged, _ = MergeSharedWeighted(toMerge, WeightingDecay, time.Minute)
+	assert.InDelta(t, 0.25, merged.Weights["node1"].Service["service1"], 1e-9)
+	assert.InDelta(t, 0.68, merged.Service["service1"].Data.BaseShared[cpu], 1e-9)
+	assert.Equal(t, current, merged.Service["service1"].Timestamp)
+
+	merged, _ = MergeSharedWeighted(toMerge, "unknown", time.Minute)
+	assert.Equal(t, WeightingMean, merged.Weighting)
+}
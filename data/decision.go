@@ -0,0 +1,15 @@
+package data
+
+import (
+	"time"
+)
+
+type Decision struct {
+	ID         string      `json:"id"`
+	Timestamp  time.Time   `json:"timestamp"`
+	Strategy   string      `json:"strategy"`
+	Threshold  float64     `json:"threshold"`
+	Candidates []Policy    `json:"candidates"`
+	Chosen     []Policy    `json:"chosen"`
+	Outcomes   []Execution `json:"outcomes"`
+}
@@ -0,0 +1,99 @@
+package data
+
+import (
+	"encoding/json"
+	"errors"
+	"mime"
+	"strings"
+
+	"github.com/elleFlorio/gru/Godeps/_workspace/src/github.com/ugorji/go/codec"
+)
+
+const (
+	ContentTypeJSON    = "application/json"
+	ContentTypeMsgpack = "application/msgpack"
+	ContentTypeCBOR    = "application/cbor"
+)
+
+var (
+	ErrUnsupportedContentType error = errors.New("Unsupported content type")
+
+	msgpackHandle = &codec.MsgpackHandle{}
+	cborHandle    = &codec.CborHandle{}
+
+	contentTypes = map[string]string{
+		ContentTypeJSON:         ContentTypeJSON,
+		ContentTypeMsgpack:      ContentTypeMsgpack,
+		"application/x-msgpack": ContentTypeMsgpack,
+		ContentTypeCBOR:         ContentTypeCBOR,
+	}
+)
+
+func init() {
+	// The strings are decoded as strings and not as byte slices
+	msgpackHandle.RawToString = true
+	msgpackHandle.WriteExt = true
+}
+
+// The first supported type of the Accept header is chosen, otherwise the
+// data are encoded in JSON, that is readable by humans.
+func NegotiateContentType(accept string) string {
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		if contentType, ok := contentTypes[mediaType]; ok {
+			return contentType
+		}
+	}
+
+	return ContentTypeJSON
+}
+
+// An empty content type is considered JSON
+func ParseContentType(header string) (string, error) {
+	if header == "" {
+		return ContentTypeJSON, nil
+	}
+
+	mediaType, _, err := mime.ParseMediaType(header)
+	if err != nil {
+		return "", err
+	}
+	contentType, ok := contentTypes[mediaType]
+	if !ok {
+		return "", ErrUnsupportedContentType
+	}
+
+	return contentType, nil
+}
+
+func Encode(value interface{}, contentType string) ([]byte, error) {
+	var encoded []byte
+	switch contentType {
+	case ContentTypeJSON:
+		return json.Marshal(value)
+	case ContentTypeMsgpack:
+		err := codec.NewEncoderBytes(&encoded, msgpackHandle).Encode(value)
+		return encoded, err
+	case ContentTypeCBOR:
+		err := codec.NewEncoderBytes(&encoded, cborHandle).Encode(value)
+		return encoded, err
+	}
+
+	return nil, ErrUnsupportedContentType
+}
+
+func Decode(encoded []byte, value interface{}, contentType string) error {
+	switch contentType {
+	case ContentTypeJSON:
+		return json.Unmarshal(encoded, value)
+	case ContentTypeMsgpack:
+		return codec.NewDecoderBytes(encoded, msgpackHandle).Decode(value)
+	case ContentTypeCBOR:
+		return codec.NewDecoderBytes(encoded, cborHandle).Decode(value)
+	}
+
+	return ErrUnsupportedContentType
+}
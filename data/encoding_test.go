@@ -0,0 +1,135 @@
+package data
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/elleFlorio/gru/Godeps/_workspace/src/github.com/stretchr/testify/assert"
+)
+
+func TestEncodeDecode(t *testing.T) {
+	shared := createLargeShared(3, 2)
+	msg := GossipMessage{
+		Digest:  GossipDigest{"node1": 3, "node2": 1},
+		Entries: []GossipEntry{{Node: "node1", Version: 3, Timestamp: time.Unix(1000, 0).UTC(), Shared: shared}},
+	}
+
+	for _, contentType := range []string{ContentTypeJSON, ContentTypeMsgpack, ContentTypeCBOR} {
+		encoded, err := Encode(msg, contentType)
+		assert.NoError(t, err, contentType)
+
+		decoded := GossipMessage{}
+		assert.NoError(t, Decode(encoded, &decoded, contentType), contentType)
+		assert.Equal(t, msg.Digest, decoded.Digest, contentType)
+		if assert.Len(t, decoded.Entries, 1, contentType) {
+			entry := decoded.Entries[0]
+			assert.Equal(t, uint64(3), entry.Version, contentType)
+			assert.True(t, msg.Entries[0].Timestamp.Equal(entry.Timestamp), contentType)
+			assert.Equal(t, shared.Service["service0"].Data, entry.Shared.Service["service0"].Data, contentType)
+			assert.Equal(t, shared.Weights, entry.Shared.Weights, contentType)
+			assert.Equal(t, shared.System.ActiveServices, entry.Shared.System.ActiveServices, contentType)
+		}
+	}
+
+	_, err := Encode(msg, "text/plain")
+	assert.Equal(t, ErrUnsupportedContentType, err)
+	assert.Equal(t, ErrUnsupportedContentType, Decode([]byte{}, &msg, "text/plain"))
+}
+
+func TestNegotiateContentType(t *testing.T) {
+	assert.Equal(t, ContentTypeJSON, NegotiateContentType(""))
+	assert.Equal(t, ContentTypeJSON, NegotiateContentType("*/*"))
+	assert.Equal(t, ContentTypeMsgpack, NegotiateContentType("application/msgpack"))
+	assert.Equal(t, ContentTypeMsgpack, NegotiateContentType("text/html, application/x-msgpack;q=0.9"))
+	assert.Equal(t, ContentTypeCBOR, NegotiateContentType("application/cbor, application/json"))
+
+	contentType, err := ParseContentType("")
+	assert.NoError(t, err)
+	assert.Equal(t, ContentTypeJSON, contentType)
+	contentType, err = ParseContentType("application/json; charset=UTF-8")
+	assert.NoError(t, err)
+	assert.Equal(t, ContentTypeJSON, contentType)
+	_, err = ParseContentType("text/plain")
+	assert.Equal(t, ErrUnsupportedContentType, err)
+}
+
+func BenchmarkEncodeSharedJSON(b *testing.B)    { benchmarkEncode(b, ContentTypeJSON) }
+func BenchmarkEncodeSharedMsgpack(b *testing.B) { benchmarkEncode(b, ContentTypeMsgpack) }
+func BenchmarkEncodeSharedCBOR(b *testing.B)    { benchmarkEncode(b, ContentTypeCBOR) }
+func BenchmarkDecodeSharedJSON(b *testing.B)    { benchmarkDecode(b, ContentTypeJSON) }
+func BenchmarkDecodeSharedMsgpack(b *testing.B) { benchmarkDecode(b, ContentTypeMsgpack) }
+func BenchmarkDecodeSharedCBOR(b *testing.B)    { benchmarkDecode(b, ContentTypeCBOR) }
+
+// The payload of a cluster with 200 services and 500 nodes
+func benchmarkEncode(b *testing.B, contentType string) {
+	shared := createLargeShared(200, 500)
+	var encoded []byte
+	var err error
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if encoded, err = Encode(shared, contentType); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ReportMetric(float64(len(encoded)), "bytes/payload")
+}
+
+func benchmarkDecode(b *testing.B, contentType string) {
+	encoded, err := Encode(createLargeShared(200, 500), contentType)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		decoded := Shared{}
+		if err = Decode(encoded, &decoded, contentType); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ReportMetric(float64(len(encoded)), "bytes/payload")
+}
+
+func createLargeShared(nServices int, nNodes int) Shared {
+	timestamp := time.Unix(1000, 0).UTC()
+	shared := Shared{
+		Node:      "node0",
+		Service:   make(map[string]ServiceShared, nServices),
+		Weighting: WeightingInstances,
+		Weights:   make(map[string]SharedWeights, nNodes),
+	}
+
+	active := make([]string, 0, nServices)
+	for i := 0; i < nServices; i++ {
+		name := fmt.Sprintf("service%d", i)
+		active = append(active, name)
+		shared.Service[name] = ServiceShared{
+			Data: SharedData{
+				BaseShared: map[string]float64{"CPU_AVG": float64(i) / 211, "MEM_AVG": float64(i) / 307},
+				UserShared: map[string]float64{"RESP_TIME": float64(i) * 1.37},
+			},
+			Active:    true,
+			Instances: i % 5,
+			Timestamp: timestamp,
+		}
+	}
+	shared.System = SystemShared{
+		Data: SharedData{
+			BaseShared: map[string]float64{"CPU_AVG": 0.5, "MEM_AVG": 0.25},
+			UserShared: map[string]float64{},
+		},
+		ActiveServices: active,
+		Instances:      nServices,
+		Timestamp:      timestamp,
+	}
+
+	for i := 0; i < nNodes; i++ {
+		weights := SharedWeights{Service: make(map[string]float64, nServices), System: float64(i%7+1) / 3}
+		for name := range shared.Service {
+			weights.Service[name] = float64(i%7+1) / 3
+		}
+		shared.Weights[fmt.Sprintf("node%d", i)] = weights
+	}
+
+	return shared
+}
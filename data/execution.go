@@ -0,0 +1,27 @@
+package data
+
+import (
+	"time"
+)
+
+const (
+	OutcomeSuccess    = "success"
+	OutcomeRolledBack = "rolledback"
+	OutcomePartial    = "partial"
+)
+
+type Execution struct {
+	Policy        string          `json:"policy"`
+	Timestamp     time.Time       `json:"timestamp"`
+	Outcome       string          `json:"outcome"`
+	Steps         []ExecutionStep `json:"steps"`
+	Compensations []ExecutionStep `json:"compensations"`
+}
+
+type ExecutionStep struct {
+	Target   string `json:"target"`
+	Action   string `json:"action"`
+	Instance string `json:"instance"`
+	Attempts int    `json:"attempts"`
+	Error    string `json:"error,omitempty"`
+}
@@ -0,0 +1,208 @@
+package data
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	log "github.com/elleFlorio/gru/Godeps/_workspace/src/github.com/Sirupsen/logrus"
+)
+
+var (
+	ErrNoGossipEntries error = errors.New("No fresh gossip entry to compute the cluster view")
+
+	gossip       = make(map[string]GossipEntry)
+	mutex_gossip = sync.RWMutex{}
+
+	// The clock can be replaced to test the expiry deterministically
+	gossipNow = time.Now
+)
+
+// Each node owns the entry with its local shared data and it is the only
+// one that increases its version. The other nodes can only turn an entry
+// into a tombstone, keeping the same version, when the node leaves the
+// cluster or the entry is too old.
+type GossipEntry struct {
+	Node      string    `json:"node"`
+	Version   uint64    `json:"version"`
+	Timestamp time.Time `json:"timestamp"`
+	Tombstone bool      `json:"tombstone"`
+	Shared    Shared    `json:"shared"`
+	// Time of the last change of the entry in this node, used for the expiry
+	// to avoid depending on the clock of the other nodes.
+	Received time.Time `json:"-"`
+}
+
+// The digest contains the version of each entry known by a node
+type GossipDigest map[string]uint64
+
+// A gossip exchange sends the digest to get the entries that are newer in
+// the friend, and the entries that are newer than the digest of the friend.
+type GossipMessage struct {
+	Digest  GossipDigest  `json:"digest,omitempty"`
+	Entries []GossipEntry `json:"entries,omitempty"`
+}
+
+func UpdateGossipLocal(node string, local Shared) GossipEntry {
+	mutex_gossip.Lock()
+	defer mutex_gossip.Unlock()
+	entry := gossip[node]
+	entry.Node = node
+	entry.Version += 1
+	entry.Timestamp = gossipNow()
+	entry.Received = entry.Timestamp
+	entry.Tombstone = false
+	entry.Shared = local
+	gossip[node] = entry
+
+	return entry
+}
+
+func GetGossipDigest() GossipDigest {
+	mutex_gossip.RLock()
+	defer mutex_gossip.RUnlock()
+	digest := make(GossipDigest, len(gossip))
+	for node, entry := range gossip {
+		digest[node] = entry.Version
+	}
+
+	return digest
+}
+
+// The delta contains the entries unknown to the digest or with a higher
+// version. The tombstones are included so the removal is propagated too.
+func GetGossipDelta(digest GossipDigest) []GossipEntry {
+	mutex_gossip.RLock()
+	defer mutex_gossip.RUnlock()
+	delta := []GossipEntry{}
+	for node, entry := range gossip {
+		version, known := digest[node]
+		if !known || entry.Version > version || (entry.Version == version && entry.Tombstone) {
+			delta = append(delta, entry)
+		}
+	}
+	sort.Sort(byNode(delta))
+
+	return delta
+}
+
+// An entry replaces the stored one if it has a higher version, or the same
+// version but it is a tombstone. If the entry of this node is received with
+// a version not lower than the local one (e.g. after a restart of the agent)
+// the local version is increased to win over it.
+func MergeGossipEntries(self string, entries []GossipEntry) int {
+	mutex_gossip.Lock()
+	defer mutex_gossip.Unlock()
+	updated := 0
+	for _, entry := range entries {
+		stored, known := gossip[entry.Node]
+		if entry.Node == self {
+			if known && entry.Version >= stored.Version {
+				stored.Version = entry.Version + 1
+				stored.Timestamp = gossipNow()
+				stored.Received = stored.Timestamp
+				gossip[self] = stored
+			}
+			continue
+		}
+
+		if !known || entry.Version > stored.Version ||
+			(entry.Version == stored.Version && entry.Tombstone && !stored.Tombstone) {
+			entry.Received = gossipNow()
+			gossip[entry.Node] = entry
+			updated++
+		}
+	}
+
+	return updated
+}
+
+// The nodes that are not registered in the cluster anymore are marked as
+// departed with a tombstone.
+func RemoveGossipNodes(self string, active map[string]string) {
+	mutex_gossip.Lock()
+	defer mutex_gossip.Unlock()
+	for node, entry := range gossip {
+		if node == self || entry.Tombstone {
+			continue
+		}
+		if _, ok := active[node]; !ok {
+			log.WithField("node", node).Debugln("Node departed, adding tombstone")
+			gossip[node] = tombstone(entry)
+		}
+	}
+}
+
+// The entries not updated for maxAge become tombstones, and the tombstones
+// are removed after maxAge more, when the other nodes had time to receive
+// them. The entry of this node never expires.
+func ExpireGossipEntries(self string, maxAge time.Duration) {
+	mutex_gossip.Lock()
+	defer mutex_gossip.Unlock()
+	now := gossipNow()
+	for node, entry := range gossip {
+		if node == self || now.Sub(entry.Received) < maxAge {
+			continue
+		}
+		if entry.Tombstone {
+			delete(gossip, node)
+			continue
+		}
+
+		log.WithField("node", node).Debugln("Gossip entry expired, adding tombstone")
+		gossip[node] = tombstone(entry)
+	}
+}
+
+func tombstone(entry GossipEntry) GossipEntry {
+	entry.Tombstone = true
+	entry.Shared = Shared{}
+	entry.Received = gossipNow()
+
+	return entry
+}
+
+func GetGossipEntries() []GossipEntry {
+	mutex_gossip.RLock()
+	defer mutex_gossip.RUnlock()
+	entries := make([]GossipEntry, 0, len(gossip))
+	for _, entry := range gossip {
+		entries = append(entries, entry)
+	}
+	sort.Sort(byNode(entries))
+
+	return entries
+}
+
+// The cluster view is computed merging the freshest entry of each node, so
+// every node is counted once and the departed nodes are not counted.
+func ComputeGossipCluster(maxAge time.Duration) (Shared, error) {
+	now := gossipNow()
+	toMerge := []Shared{}
+	for _, entry := range GetGossipEntries() {
+		if entry.Tombstone || now.Sub(entry.Received) >= maxAge {
+			continue
+		}
+		entry.Shared.Node = entry.Node
+		toMerge = append(toMerge, entry.Shared)
+	}
+
+	if len(toMerge) == 0 {
+		return Shared{}, ErrNoGossipEntries
+	}
+
+	return MergeShared(toMerge)
+}
+
+func CleanGossip() {
+	mutex_gossip.Lock()
+	defer mutex_gossip.Unlock()
+	gossip = make(map[string]GossipEntry)
+}
+
+type byNode []GossipEntry
+
+func (e byNode) Len() int           { return len(e) }
+func (e byNode) Swap(i, j int)      { e[i], e[j] = e[j], e[i] }
+func (e byNode) Less(i, j int) bool { return e[i].Node < e[j].Node }
@@ -0,0 +1,6 @@
+package data
+
+type Learning struct {
+	Values map[string]float64 `json:"values"`
+	Visits map[string]int     `json:"visits"`
+}
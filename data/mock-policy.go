@@ -17,7 +17,18 @@ func init() {
 }
 
 func CreateMockPolicy(name string, weight float64, targets []string, actions map[string][]enum.Action) Policy {
-	return Policy{name, weight, targets, actions}
+	primary := ""
+	if len(targets) == 1 {
+		primary = targets[0]
+	}
+
+	return Policy{
+		Name:    name,
+		Weight:  weight,
+		Primary: primary,
+		Targets: targets,
+		Actions: actions,
+	}
 }
 
 func CreateRandomMockPolicies(nServices int) []Policy {
@@ -4,9 +4,16 @@ import (
 	"github.com/elleFlorio/gru/enum"
 )
 
+// The primary target is the service the policy is computed for, while the
+// other targets are the services affected by the policy (e.g. the
+// dependencies started with it). It is empty if the policy is computed for
+// several services.
 type Policy struct {
 	Name    string
 	Weight  float64
+	Primary string
 	Targets []string
 	Actions map[string][]enum.Action
+	Inputs  map[string]float64
+	Reason  string
 }
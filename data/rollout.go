@@ -0,0 +1,32 @@
+package data
+
+import (
+	"time"
+)
+
+const (
+	RolloutRunning   = "running"
+	RolloutCompleted = "completed"
+	RolloutPaused    = "paused"
+)
+
+type RollingUpdate struct {
+	Service        string `json:"service"`
+	Image          string `json:"image"`
+	PreviousImage  string `json:"previousimage"`
+	MaxSurge       int    `json:"maxsurge"`
+	MaxUnavailable int    `json:"maxunavailable"`
+	ReadyTimeout   int    `json:"readytimeout"`
+}
+
+type Rollout struct {
+	Service       string    `json:"service"`
+	Image         string    `json:"image"`
+	PreviousImage string    `json:"previousimage"`
+	Status        string    `json:"status"`
+	Total         int       `json:"total"`
+	Replaced      int       `json:"replaced"`
+	Error         string    `json:"error,omitempty"`
+	Started       time.Time `json:"started"`
+	Updated       time.Time `json:"updated"`
+}
@@ -1,21 +1,45 @@
 package data
 
+import (
+	"time"
+)
+
+const (
+	WeightingMean      = "mean"
+	WeightingInstances = "instances"
+	WeightingDecay     = "decay"
+)
+
+// The merged shared data reports the weighting used and the weights given
+// to the data of each node.
 type Shared struct {
-	Service map[string]ServiceShared `json:"service"`
-	System  SystemShared             `json:"system"`
+	Node      string                   `json:"node,omitempty"`
+	Service   map[string]ServiceShared `json:"service"`
+	System    SystemShared             `json:"system"`
+	Weighting string                   `json:"weighting,omitempty"`
+	Weights   map[string]SharedWeights `json:"weights,omitempty"`
 }
 
 type ServiceShared struct {
-	Data   SharedData
-	Active bool `json:"active"`
+	Data      SharedData
+	Active    bool      `json:"active"`
+	Instances int       `json:"instances"`
+	Timestamp time.Time `json:"timestamp"`
 }
 
 type SystemShared struct {
 	Data           SharedData
-	ActiveServices []string `json:"activeservices"`
+	ActiveServices []string  `json:"activeservices"`
+	Instances      int       `json:"instances"`
+	Timestamp      time.Time `json:"timestamp"`
 }
 
 type SharedData struct {
 	BaseShared map[string]float64
 	UserShared map[string]float64
 }
+
+type SharedWeights struct {
+	Service map[string]float64 `json:"service"`
+	System  float64            `json:"system"`
+}
@@ -0,0 +1,458 @@
+package discovery
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+
+	log "github.com/elleFlorio/gru/Godeps/_workspace/src/github.com/Sirupsen/logrus"
+)
+
+const c_CACHE_INTERVAL = 5 * time.Second
+
+var (
+	ErrDegraded    error = errors.New("discovery service unreachable, using cached data")
+	ErrUnsafeCache error = errors.New("discovery cache is not private to the user")
+
+	current     *cachedDiscovery
+	mutex_cache = sync.RWMutex{}
+)
+
+// The cache wraps the discovery service keeping the last response to every
+// query, that is served when the service cannot be contacted. The writes
+// done in the meanwhile are queued and replayed in order when the service
+// is reachable again.
+type cachedDiscovery struct {
+	backend   Discovery
+	uri       string
+	path      string
+	responses map[string]map[string]string
+	writes    []cachedWrite
+	sequence  uint64
+	degraded  bool
+	dirty     bool
+	stop      chan struct{}
+	mutex     sync.Mutex
+}
+
+type cachedWrite struct {
+	sequence uint64
+	key      string
+	value    string
+	options  Options
+	register bool
+	delete   bool
+}
+
+type cacheFile struct {
+	Responses map[string]map[string]string `json:"responses"`
+}
+
+// NewCached initializes the discovery service like New, loading the cache
+// from path. If the service is unreachable but some data are cached the
+// agent can start anyway: the discovery is returned with ErrDegraded.
+func NewCached(name string, uri string, path string) (Discovery, error) {
+	dscvr, err := New(name, uri)
+	if err != nil && err != ErrUnreachable {
+		return dscvr, err
+	}
+
+	for index, backend := range discoveries {
+		if backend.Name() != name {
+			continue
+		}
+
+		cache := newCachedDiscovery(backend, uri, path)
+		if err == ErrUnreachable {
+			if len(cache.responses) == 0 {
+				return dscvr, err
+			}
+			cache.setDegraded(true)
+		}
+
+		discService = index
+		setCache(cache)
+		go cache.maintain(c_CACHE_INTERVAL)
+		if cache.isDegraded() {
+			return cache, ErrDegraded
+		}
+
+		return cache, nil
+	}
+
+	return dscvr, ErrNotSupported
+}
+
+// Degraded is true when the discovery service is unreachable and the agent
+// is working on the cached data.
+func Degraded() bool {
+	cache := getCache()
+	return cache != nil && cache.isDegraded()
+}
+
+func newCachedDiscovery(backend Discovery, uri string, path string) *cachedDiscovery {
+	cache := &cachedDiscovery{
+		backend:   backend,
+		uri:       uri,
+		path:      path,
+		responses: make(map[string]map[string]string),
+		stop:      make(chan struct{}),
+	}
+	cache.load()
+
+	return cache
+}
+
+func getCache() *cachedDiscovery {
+	mutex_cache.RLock()
+	defer mutex_cache.RUnlock()
+	return current
+}
+
+func setCache(cache *cachedDiscovery) {
+	mutex_cache.Lock()
+	defer mutex_cache.Unlock()
+	current = cache
+}
+
+func stopCache() {
+	mutex_cache.Lock()
+	defer mutex_cache.Unlock()
+	if current != nil {
+		close(current.stop)
+		current = nil
+	}
+}
+
+func (c *cachedDiscovery) Name() string {
+	return c.backend.Name()
+}
+
+func (c *cachedDiscovery) Initialize(uri string) error {
+	c.uri = uri
+	err := c.backend.Initialize(uri)
+	c.setDegraded(err == ErrUnreachable)
+
+	return err
+}
+
+func (c *cachedDiscovery) Register(nodePath string, nodeAddress string) error {
+	return c.write(cachedWrite{key: nodePath, value: nodeAddress, register: true})
+}
+
+func (c *cachedDiscovery) Get(key string, opt Options) (map[string]string, error) {
+	if !c.isDegraded() {
+		resp, err := c.backend.Get(key, opt)
+		if err != ErrUnreachable {
+			c.store(key, resp, err)
+			return resp, err
+		}
+		c.setDegraded(true)
+	}
+	// The reads that need the latest value (e.g. the owner of a lease)
+	// cannot be served from the cache
+	if quorum, _ := opt["Quorum"].(bool); quorum {
+		return nil, ErrUnreachable
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	cached, ok := c.responses[key]
+	if !ok {
+		return nil, ErrUnreachable
+	}
+	resp := make(map[string]string, len(cached))
+	for k, v := range cached {
+		resp[k] = v
+	}
+
+	return resp, nil
+}
+
+func (c *cachedDiscovery) Set(key string, value string, opt Options) error {
+	return c.write(cachedWrite{key: key, value: value, options: copyOptions(opt)})
+}
+
+func (c *cachedDiscovery) Delete(key string) error {
+	return c.write(cachedWrite{key: key, delete: true})
+}
+
+// The conditional delete cannot be queued, since the value of the key could
+// change before it is replayed.
+func (c *cachedDiscovery) DeleteIf(key string, value string) error {
+	if c.isDegraded() {
+		return ErrUnreachable
+	}
+
+	err := c.backend.DeleteIf(key, value)
+	switch err {
+	case nil:
+		c.mutex.Lock()
+		c.apply(cachedWrite{key: key, delete: true})
+		c.mutex.Unlock()
+	case ErrUnreachable:
+		c.setDegraded(true)
+	}
+
+	return err
+}
+
+// The conditional writes that create a key only if it does not exist (e.g.
+// the leases) cannot be queued, since the caller needs to know the result.
+func (c *cachedDiscovery) write(w cachedWrite) error {
+	if !c.isDegraded() {
+		err := c.replay(w)
+		if err != ErrUnreachable {
+			if err == nil {
+				c.mutex.Lock()
+				c.apply(w)
+				c.mutex.Unlock()
+			}
+			return err
+		}
+		c.setDegraded(true)
+	}
+
+	if prevExist, ok := w.options["PrevExist"]; ok && prevExist == false {
+		return ErrUnreachable
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	pending := make([]cachedWrite, 0, len(c.writes)+1)
+	for _, queued := range c.writes {
+		if queued.key != w.key {
+			pending = append(pending, queued)
+		}
+	}
+	c.sequence++
+	w.sequence = c.sequence
+	c.writes = append(pending, w)
+	c.apply(w)
+	log.WithField("key", w.key).Debugln("Discovery write queued")
+
+	return nil
+}
+
+func (c *cachedDiscovery) replay(w cachedWrite) error {
+	switch {
+	case w.delete:
+		return c.backend.Delete(w.key)
+	case w.register:
+		return c.backend.Register(w.key, w.value)
+	}
+
+	return c.backend.Set(w.key, w.value, copyOptions(w.options))
+}
+
+// The cached responses are updated with the writes, so the agent reads its
+// own writes while the discovery service is unreachable.
+func (c *cachedDiscovery) apply(w cachedWrite) {
+	for query, resp := range c.responses {
+		if _, ok := resp[w.key]; !ok && query != w.key {
+			continue
+		}
+		if w.delete {
+			delete(resp, w.key)
+		} else {
+			resp[w.key] = w.value
+		}
+		c.dirty = true
+	}
+}
+
+func (c *cachedDiscovery) store(key string, resp map[string]string, err error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if err != nil {
+		if _, ok := c.responses[key]; ok {
+			delete(c.responses, key)
+			c.dirty = true
+		}
+		return
+	}
+
+	cached := make(map[string]string, len(resp))
+	for k, v := range resp {
+		cached[k] = v
+	}
+	c.responses[key] = cached
+	c.dirty = true
+}
+
+func (c *cachedDiscovery) isDegraded() bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.degraded
+}
+
+func (c *cachedDiscovery) setDegraded(degraded bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.degraded == degraded {
+		return
+	}
+
+	c.degraded = degraded
+	if degraded {
+		log.WithField("uri", c.uri).Warnln("Discovery service unreachable, using cached data")
+	} else {
+		log.WithField("uri", c.uri).Infoln("Discovery service reachable again")
+	}
+}
+
+func (c *cachedDiscovery) maintain(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.stop:
+			return
+		case <-ticker.C:
+			if c.isDegraded() {
+				c.reconnect()
+			}
+			c.save()
+		}
+	}
+}
+
+// The queued writes are replayed one at a time, so the new writes can be
+// queued meanwhile. The discovery is degraded until the queue is empty, to
+// keep the order of the writes.
+func (c *cachedDiscovery) reconnect() {
+	if err := c.backend.Initialize(c.uri); err != nil {
+		return
+	}
+
+	for {
+		c.mutex.Lock()
+		if len(c.writes) == 0 {
+			c.mutex.Unlock()
+			c.setDegraded(false)
+			return
+		}
+		w := c.writes[0]
+		c.mutex.Unlock()
+
+		err := c.replay(w)
+		if err == ErrUnreachable {
+			return
+		}
+		if err != nil {
+			log.WithFields(log.Fields{
+				"key": w.key,
+				"err": err,
+			}).Warnln("Cannot replay discovery write")
+		}
+
+		c.mutex.Lock()
+		if len(c.writes) > 0 && c.writes[0].sequence == w.sequence {
+			c.writes = c.writes[1:]
+		}
+		c.mutex.Unlock()
+	}
+}
+
+func (c *cachedDiscovery) load() {
+	if c.path == "" {
+		return
+	}
+
+	err := checkPrivate(filepath.Dir(c.path))
+	if err == nil {
+		err = checkPrivate(c.path)
+	}
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.WithFields(log.Fields{
+				"path": c.path,
+				"err":  err,
+			}).Errorln("Discovery cache not loaded")
+		}
+		return
+	}
+
+	content, err := ioutil.ReadFile(c.path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.WithField("err", err).Errorln("Error reading discovery cache")
+		}
+		return
+	}
+
+	file := cacheFile{}
+	if err = json.Unmarshal(content, &file); err != nil {
+		log.WithField("err", err).Errorln("Error reading discovery cache")
+		return
+	}
+	if file.Responses != nil {
+		c.responses = file.Responses
+	}
+}
+
+// The cache is written to a temporary file and then renamed, so a crash
+// does not leave a corrupted cache.
+func (c *cachedDiscovery) save() {
+	c.mutex.Lock()
+	if c.path == "" || !c.dirty {
+		c.mutex.Unlock()
+		return
+	}
+	content, err := json.Marshal(cacheFile{c.responses})
+	c.dirty = false
+	c.mutex.Unlock()
+	if err != nil {
+		log.WithField("err", err).Errorln("Error encoding discovery cache")
+		return
+	}
+
+	if err = os.MkdirAll(filepath.Dir(c.path), 0700); err == nil {
+		err = checkPrivate(filepath.Dir(c.path))
+	}
+	if err == nil {
+		tmp := c.path + ".tmp"
+		if err = ioutil.WriteFile(tmp, content, 0600); err == nil {
+			err = os.Rename(tmp, c.path)
+		}
+	}
+	if err != nil {
+		log.WithField("err", err).Errorln("Error writing discovery cache")
+	}
+}
+
+// The cache holds the data of the cluster, including its secrets, and the
+// agent trusts it when etcd is unreachable. So the cache, and the directory
+// where it is written, must belong to the user running the agent and must
+// not be writable by other users, that could replace it.
+func checkPrivate(path string) error {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() && !info.Mode().IsRegular() {
+		return ErrUnsafeCache
+	}
+	if info.Mode().Perm()&0022 != 0 {
+		return ErrUnsafeCache
+	}
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok && int(stat.Uid) != os.Getuid() {
+		return ErrUnsafeCache
+	}
+
+	return nil
+}
+
+func copyOptions(opt Options) Options {
+	copied := make(Options, len(opt))
+	for k, v := range opt {
+		copied[k] = v
+	}
+
+	return copied
+}
@@ -0,0 +1,167 @@
+package discovery
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/elleFlorio/gru/Godeps/_workspace/src/github.com/stretchr/testify/assert"
+)
+
+var errKeyNotFound = errors.New("key not found")
+
+type fakeDiscovery struct {
+	reachable bool
+	data      map[string]string
+	writes    []string
+}
+
+func (p *fakeDiscovery) Name() string {
+	return "fake"
+}
+
+func (p *fakeDiscovery) Initialize(uri string) error {
+	if !p.reachable {
+		return ErrUnreachable
+	}
+	return nil
+}
+
+func (p *fakeDiscovery) Register(key string, value string) error {
+	return p.Set(key, value, Options{})
+}
+
+func (p *fakeDiscovery) Get(key string, opt Options) (map[string]string, error) {
+	if !p.reachable {
+		return nil, ErrUnreachable
+	}
+	value, ok := p.data[key]
+	if !ok {
+		return nil, errKeyNotFound
+	}
+	return map[string]string{key: value}, nil
+}
+
+func (p *fakeDiscovery) Set(key string, value string, opt Options) error {
+	if !p.reachable {
+		return ErrUnreachable
+	}
+	p.data[key] = value
+	p.writes = append(p.writes, key)
+	return nil
+}
+
+func (p *fakeDiscovery) Delete(key string) error {
+	if !p.reachable {
+		return ErrUnreachable
+	}
+	delete(p.data, key)
+	p.writes = append(p.writes, key)
+	return nil
+}
+
+func (p *fakeDiscovery) DeleteIf(key string, value string) error {
+	if !p.reachable {
+		return ErrUnreachable
+	}
+	if stored, ok := p.data[key]; !ok || stored != value {
+		return ErrCompareFailed
+	}
+	return p.Delete(key)
+}
+
+func TestCachedDiscovery(t *testing.T) {
+	backend := &fakeDiscovery{
+		reachable: true,
+		data:      map[string]string{"/gru/c1/config": "cfg", "/gru/c1/uuid": "id"},
+	}
+	cache := newCachedDiscovery(backend, "uri", "")
+
+	resp, err := cache.Get("/gru/c1/config", Options{})
+	assert.NoError(t, err)
+	assert.Equal(t, "cfg", resp["/gru/c1/config"])
+	assert.False(t, cache.isDegraded())
+
+	backend.reachable = false
+	resp, err = cache.Get("/gru/c1/config", Options{})
+	assert.NoError(t, err)
+	assert.Equal(t, "cfg", resp["/gru/c1/config"])
+	assert.True(t, cache.isDegraded())
+	_, err = cache.Get("/gru/c1/uuid", Options{})
+	assert.Equal(t, ErrUnreachable, err)
+	_, err = cache.Get("/gru/c1/config", Options{"Quorum": true})
+	assert.Equal(t, ErrUnreachable, err)
+
+	// The writes are queued and the agent reads its own writes
+	assert.NoError(t, cache.Set("/gru/c1/nodes/n1", "a", Options{"TTL": 5}))
+	assert.NoError(t, cache.Set("/gru/c1/config", "new", Options{}))
+	assert.NoError(t, cache.Set("/gru/c1/nodes/n1", "b", Options{"PrevExist": true}))
+	assert.NoError(t, cache.Delete("/gru/c1/uuid"))
+	assert.Equal(t, ErrUnreachable, cache.Set("/gru/c1/leases/s1", "n1", Options{"PrevExist": false}))
+	assert.Equal(t, ErrUnreachable, cache.DeleteIf("/gru/c1/leases/s1", "n1"))
+	resp, _ = cache.Get("/gru/c1/config", Options{})
+	assert.Equal(t, "new", resp["/gru/c1/config"])
+	assert.Len(t, cache.writes, 3)
+
+	cache.reconnect()
+	assert.True(t, cache.isDegraded())
+	assert.Empty(t, backend.writes)
+
+	backend.reachable = true
+	cache.reconnect()
+	assert.False(t, cache.isDegraded())
+	assert.Empty(t, cache.writes)
+	assert.Equal(t, []string{"/gru/c1/config", "/gru/c1/nodes/n1", "/gru/c1/uuid"}, backend.writes)
+	assert.Equal(t, "b", backend.data["/gru/c1/nodes/n1"])
+	_, ok := backend.data["/gru/c1/uuid"]
+	assert.False(t, ok)
+
+	assert.Equal(t, ErrCompareFailed, cache.DeleteIf("/gru/c1/config", "old"))
+	assert.NoError(t, cache.DeleteIf("/gru/c1/config", "new"))
+	_, ok = backend.data["/gru/c1/config"]
+	assert.False(t, ok)
+}
+
+func TestCachePersistence(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gru-discovery")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "cache", "discovery.json")
+
+	backend := &fakeDiscovery{reachable: true, data: map[string]string{"/gru/c1/uuid": "id"}}
+	cache := newCachedDiscovery(backend, "uri", path)
+	cache.Get("/gru/c1/uuid", Options{})
+	cache.save()
+
+	backend.reachable = false
+	restarted := newCachedDiscovery(backend, "uri", path)
+	restarted.setDegraded(true)
+	resp, err := restarted.Get("/gru/c1/uuid", Options{})
+	assert.NoError(t, err)
+	assert.Equal(t, "id", resp["/gru/c1/uuid"])
+
+	// A cache that other users can replace is not trusted
+	assert.NoError(t, os.Chmod(path, 0666))
+	assert.Equal(t, ErrUnsafeCache, checkPrivate(path))
+	assert.Empty(t, newCachedDiscovery(backend, "uri", path).responses)
+	assert.NoError(t, os.Chmod(path, 0600))
+	assert.NoError(t, os.Chmod(filepath.Dir(path), 0777))
+	assert.Empty(t, newCachedDiscovery(backend, "uri", path).responses)
+	assert.NoError(t, os.Chmod(filepath.Dir(path), 0700))
+
+	discoveries = append(discoveries, backend)
+	defer func() {
+		discoveries = discoveries[:len(discoveries)-1]
+		stopCache()
+	}()
+	_, err = NewCached("fake", "uri", path)
+	assert.Equal(t, ErrDegraded, err)
+	assert.True(t, Degraded())
+	_, err = NewCached("fake", "uri", filepath.Join(dir, "missing.json"))
+	assert.Equal(t, ErrUnreachable, err)
+	assert.False(t, Degraded())
+}
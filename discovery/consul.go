@@ -0,0 +1,376 @@
+package discovery
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/elleFlorio/gru/Godeps/_workspace/src/github.com/Sirupsen/logrus"
+)
+
+const (
+	c_CONSUL_KV      = "/v1/kv/"
+	c_CONSUL_TIMEOUT = 3 * time.Second
+	// Consul does not accept sessions with a lower TTL
+	c_CONSUL_MIN_TTL = 10 * time.Second
+	// The instances are removed from the catalog if they fail for too long
+	c_CONSUL_DEREGISTER_AFTER = "1m"
+)
+
+var ErrWriteRejected error = errors.New("Write rejected by Consul")
+
+type consulDiscovery struct {
+	uri      string
+	client   *http.Client
+	sessions map[string]string
+	mutex    sync.Mutex
+}
+
+type consulPair struct {
+	Key         string
+	Value       []byte
+	ModifyIndex uint64
+}
+
+type consulService struct {
+	ID      string
+	Name    string
+	Address string
+	Port    int
+	Check   consulCheck
+}
+
+type consulCheck struct {
+	TTL                            string
+	DeregisterCriticalServiceAfter string
+}
+
+func (p *consulDiscovery) Name() string {
+	return "consul"
+}
+
+func (p *consulDiscovery) Initialize(uri string) error {
+	log.WithField("uri", uri).Debugln("Trying to connect to consul")
+	p.uri = strings.TrimSuffix(uri, "/")
+	p.client = &http.Client{Timeout: c_CONSUL_TIMEOUT}
+	p.sessions = make(map[string]string)
+
+	// Consul cannot be used if the cluster has no leader
+	leader, err := p.request("GET", "/v1/status/leader", nil)
+	if err != nil {
+		return err
+	}
+	if strings.Trim(string(leader), "\"\n ") == "" {
+		return ErrUnreachable
+	}
+
+	return nil
+}
+
+func (p *consulDiscovery) Register(nodePath string, nodeAddress string) error {
+	err := p.Set(nodePath, nodeAddress, Options{})
+	if err != nil {
+		log.WithField("err", err).Errorln("Registering to discovery service")
+	}
+
+	return err
+}
+
+// The keys are read recursively, then the result is built like etcd does:
+// the value of the key if it is not a directory, otherwise its children,
+// with an empty value for the ones that are directories. The option
+// Recursive returns all the keys in the tree of the directory, while Quorum
+// reads the value from the leader.
+func (p *consulDiscovery) Get(key string, opt Options) (map[string]string, error) {
+	prefix := strings.Trim(key, "/")
+	query := "?recurse"
+	if quorum, _ := opt["Quorum"].(bool); quorum {
+		query += "&consistent"
+	}
+	resp, err := p.request("GET", c_CONSUL_KV+prefix+query, nil)
+	if err != nil {
+		if err != ErrKeyNotFound {
+			log.WithField("err", err).Errorln("Querying discovery service")
+		}
+		return nil, err
+	}
+
+	pairs := []consulPair{}
+	if err = json.Unmarshal(resp, &pairs); err != nil {
+		return nil, err
+	}
+
+	recursive, _ := opt["Recursive"].(bool)
+	dirPrefix := prefix + "/"
+	if prefix == "" {
+		dirPrefix = ""
+	}
+
+	result := make(map[string]string)
+	for _, pair := range pairs {
+		if pair.Key == prefix {
+			result["/"+prefix] = string(pair.Value)
+			continue
+		}
+		if !strings.HasPrefix(pair.Key, dirPrefix) || pair.Key == dirPrefix {
+			continue
+		}
+
+		relative := strings.TrimPrefix(pair.Key, dirPrefix)
+		if recursive {
+			if !strings.HasSuffix(relative, "/") {
+				result["/"+pair.Key] = string(pair.Value)
+			}
+			continue
+		}
+
+		child := strings.SplitN(relative, "/", 2)
+		if len(child) == 1 {
+			result["/"+pair.Key] = string(pair.Value)
+		} else {
+			result["/"+dirPrefix+child[0]] = ""
+		}
+	}
+
+	// Clean empty results
+	if value, ok := result["/"+prefix]; ok && value == "" {
+		delete(result, "/"+prefix)
+	}
+
+	return result, nil
+}
+
+// The options follow the ones of etcd: Dir creates a directory, PrevExist
+// writes the key only if it does (not) exist and TTL binds the key to a
+// session that deletes it when it expires.
+func (p *consulDiscovery) Set(key string, value string, opt Options) error {
+	path := strings.Trim(key, "/")
+	if dir, _ := opt["Dir"].(bool); dir {
+		path += "/"
+		value = ""
+	}
+
+	params := url.Values{}
+	if prevExist, ok := opt["PrevExist"].(bool); ok {
+		if !prevExist {
+			params.Set("cas", "0")
+		} else if _, err := p.request("GET", c_CONSUL_KV+path, nil); err != nil {
+			return err
+		}
+	}
+
+	ttl, _ := opt["TTL"].(time.Duration)
+	session, err := p.session(strings.Trim(key, "/"), ttl)
+	if err != nil {
+		return err
+	}
+	if session != "" {
+		params.Set("acquire", session)
+	}
+
+	resp, err := p.request("PUT", c_CONSUL_KV+path+"?"+params.Encode(), []byte(value))
+	if err != nil {
+		log.WithField("err", err).Errorln("Error setting value to discovery service")
+		return err
+	}
+	if strings.TrimSpace(string(resp)) != "true" {
+		if params.Get("cas") != "" {
+			return ErrKeyExists
+		}
+		return ErrWriteRejected
+	}
+
+	return nil
+}
+
+// The key and the keys under it are deleted, together with its session.
+func (p *consulDiscovery) Delete(key string) error {
+	path := strings.Trim(key, "/")
+	_, err := p.request("DELETE", c_CONSUL_KV+path, nil)
+	if err == nil {
+		_, err = p.request("DELETE", c_CONSUL_KV+path+"/?recurse", nil)
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if session, ok := p.sessions[path]; ok {
+		p.request("PUT", "/v1/session/destroy/"+session, nil)
+		delete(p.sessions, path)
+	}
+
+	return err
+}
+
+// The key is deleted only if it was not modified after it was read, using
+// its index, and its session is destroyed.
+func (p *consulDiscovery) DeleteIf(key string, value string) error {
+	path := strings.Trim(key, "/")
+	resp, err := p.request("GET", c_CONSUL_KV+path, nil)
+	if err != nil {
+		return err
+	}
+
+	pairs := []consulPair{}
+	if err = json.Unmarshal(resp, &pairs); err != nil {
+		return err
+	}
+	if len(pairs) == 0 {
+		return ErrKeyNotFound
+	}
+	if string(pairs[0].Value) != value {
+		return ErrCompareFailed
+	}
+
+	resp, err = p.request("DELETE", fmt.Sprintf("%s%s?cas=%d", c_CONSUL_KV, path, pairs[0].ModifyIndex), nil)
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(string(resp)) != "true" {
+		return ErrCompareFailed
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if session, ok := p.sessions[path]; ok {
+		p.request("PUT", "/v1/session/destroy/"+session, nil)
+		delete(p.sessions, path)
+	}
+
+	return nil
+}
+
+// The session of a key is renewed at every write, and it is created again
+// if it expired. The keys written without a TTL under a directory with a
+// session are bound to the same session, so they are deleted with the
+// directory as in etcd.
+func (p *consulDiscovery) session(key string, ttl time.Duration) (string, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if ttl <= 0 {
+		parent, parentSession := "", ""
+		for dir, session := range p.sessions {
+			if strings.HasPrefix(key, dir+"/") && len(dir) > len(parent) {
+				parent, parentSession = dir, session
+			}
+		}
+		return parentSession, nil
+	}
+
+	if session, ok := p.sessions[key]; ok {
+		_, err := p.request("PUT", "/v1/session/renew/"+session, nil)
+		if err == nil {
+			return session, nil
+		}
+		if err != ErrKeyNotFound {
+			return "", err
+		}
+		delete(p.sessions, key)
+	}
+
+	if ttl < c_CONSUL_MIN_TTL {
+		ttl = c_CONSUL_MIN_TTL
+	}
+	body, _ := json.Marshal(map[string]string{
+		"Name":      "gru/" + key,
+		"TTL":       ttl.String(),
+		"Behavior":  "delete",
+		"LockDelay": "0s",
+	})
+	resp, err := p.request("PUT", "/v1/session/create", body)
+	if err != nil {
+		return "", err
+	}
+
+	created := struct{ ID string }{}
+	if err = json.Unmarshal(resp, &created); err != nil {
+		return "", err
+	}
+	p.sessions[key] = created.ID
+
+	return created.ID, nil
+}
+
+// The instance is registered in the catalog of the local Consul agent with
+// a TTL health check, that is passed every time the instance is kept alive.
+func (p *consulDiscovery) RegisterInstance(service string, id string, address string, ttl time.Duration) error {
+	host, port := address, 0
+	if splitHost, splitPort, err := net.SplitHostPort(address); err == nil {
+		host = splitHost
+		port, _ = strconv.Atoi(splitPort)
+	}
+	if ttl <= 0 {
+		ttl = c_CONSUL_MIN_TTL
+	}
+
+	body, err := json.Marshal(consulService{
+		ID:      id,
+		Name:    service,
+		Address: host,
+		Port:    port,
+		Check: consulCheck{
+			TTL:                            ttl.String(),
+			DeregisterCriticalServiceAfter: c_CONSUL_DEREGISTER_AFTER,
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	if _, err = p.request("PUT", "/v1/agent/service/register", body); err != nil {
+		return err
+	}
+
+	return p.PassInstance(id)
+}
+
+func (p *consulDiscovery) PassInstance(id string) error {
+	_, err := p.request("PUT", "/v1/agent/check/pass/service:"+id, nil)
+	return err
+}
+
+func (p *consulDiscovery) DeregisterInstance(id string) error {
+	_, err := p.request("PUT", "/v1/agent/service/deregister/"+id, nil)
+	return err
+}
+
+// The failures to contact Consul, and the errors of the servers (e.g. no
+// leader), are returned as ErrUnreachable.
+func (p *consulDiscovery) request(method string, path string, body []byte) ([]byte, error) {
+	req, err := http.NewRequest(method, p.uri+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		log.WithField("err", err).Debugln("Cannot contact consul")
+		return nil, ErrUnreachable
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, ErrUnreachable
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return nil, ErrKeyNotFound
+	case resp.StatusCode >= http.StatusInternalServerError:
+		log.WithField("status", resp.Status).Debugln("Consul cannot serve the request")
+		return nil, ErrUnreachable
+	case resp.StatusCode >= http.StatusMultipleChoices:
+		return nil, fmt.Errorf("consul: %s: %s", resp.Status, strings.TrimSpace(string(data)))
+	}
+
+	return data, nil
+}
@@ -0,0 +1,285 @@
+package discovery
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/elleFlorio/gru/Godeps/_workspace/src/github.com/stretchr/testify/assert"
+)
+
+// Stand-in of the HTTP API of Consul with the KV store, the sessions and
+// the catalog of the local agent.
+type fakeConsul struct {
+	kv       map[string]string
+	indexes  map[string]uint64
+	index    uint64
+	owners   map[string]string
+	sessions map[string]map[string]string
+	services map[string]consulService
+	passed   map[string]int
+	created  int
+	mutex    sync.Mutex
+}
+
+func newFakeConsul() *fakeConsul {
+	return &fakeConsul{
+		kv:       make(map[string]string),
+		indexes:  make(map[string]uint64),
+		owners:   make(map[string]string),
+		sessions: make(map[string]map[string]string),
+		services: make(map[string]consulService),
+		passed:   make(map[string]int),
+	}
+}
+
+func (f *fakeConsul) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	body, _ := ioutil.ReadAll(r.Body)
+	path := r.URL.Path
+	switch {
+	case path == "/v1/status/leader":
+		fmt.Fprint(w, `"127.0.0.1:8300"`)
+	case strings.HasPrefix(path, c_CONSUL_KV):
+		f.serveKV(w, r, strings.TrimPrefix(path, c_CONSUL_KV), string(body))
+	case path == "/v1/session/create":
+		session := map[string]string{}
+		json.Unmarshal(body, &session)
+		f.created++
+		id := fmt.Sprintf("session%d", f.created)
+		f.sessions[id] = session
+		fmt.Fprintf(w, `{"ID":"%s"}`, id)
+	case strings.HasPrefix(path, "/v1/session/renew/"):
+		if _, ok := f.sessions[strings.TrimPrefix(path, "/v1/session/renew/")]; !ok {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	case strings.HasPrefix(path, "/v1/session/destroy/"):
+		f.expire(strings.TrimPrefix(path, "/v1/session/destroy/"))
+	case path == "/v1/agent/service/register":
+		srv := consulService{}
+		json.Unmarshal(body, &srv)
+		f.services[srv.ID] = srv
+	case strings.HasPrefix(path, "/v1/agent/check/pass/service:"):
+		id := strings.TrimPrefix(path, "/v1/agent/check/pass/service:")
+		if _, ok := f.services[id]; !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		f.passed[id]++
+	case strings.HasPrefix(path, "/v1/agent/service/deregister/"):
+		delete(f.services, strings.TrimPrefix(path, "/v1/agent/service/deregister/"))
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (f *fakeConsul) serveKV(w http.ResponseWriter, r *http.Request, key string, value string) {
+	query := r.URL.Query()
+	_, recurse := query["recurse"]
+	switch r.Method {
+	case "GET":
+		pairs := []consulPair{}
+		for k, v := range f.kv {
+			if k == key || (recurse && strings.HasPrefix(k, key)) {
+				pairs = append(pairs, consulPair{Key: k, Value: []byte(v), ModifyIndex: f.indexes[k]})
+			}
+		}
+		if len(pairs) == 0 {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(pairs)
+	case "PUT":
+		_, exists := f.kv[key]
+		if query.Get("cas") == "0" && exists {
+			fmt.Fprint(w, "false")
+			return
+		}
+		if session := query.Get("acquire"); session != "" {
+			if owner, ok := f.owners[key]; ok && owner != session {
+				fmt.Fprint(w, "false")
+				return
+			}
+			f.owners[key] = session
+		}
+		f.kv[key] = value
+		f.index++
+		f.indexes[key] = f.index
+		fmt.Fprint(w, "true")
+	case "DELETE":
+		if cas := query.Get("cas"); cas != "" && cas != fmt.Sprint(f.indexes[key]) {
+			fmt.Fprint(w, "false")
+			return
+		}
+		for k := range f.kv {
+			if k == key || (recurse && strings.HasPrefix(k, key)) {
+				delete(f.kv, k)
+				delete(f.owners, k)
+			}
+		}
+		fmt.Fprint(w, "true")
+	}
+}
+
+// The keys acquired by the session are deleted when it expires
+func (f *fakeConsul) expire(session string) {
+	delete(f.sessions, session)
+	for key, owner := range f.owners {
+		if owner == session {
+			delete(f.kv, key)
+			delete(f.owners, key)
+		}
+	}
+}
+
+func (f *fakeConsul) keys() []string {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	keys := []string{}
+	for key := range f.kv {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func TestConsulKV(t *testing.T) {
+	fake := newFakeConsul()
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	consul := &consulDiscovery{}
+	assert.NoError(t, consul.Initialize(server.URL))
+
+	assert.NoError(t, consul.Register("/gru/c1/uuid", "id"))
+	assert.NoError(t, consul.Set("/gru/c1/services/", "", Options{"Dir": true}))
+	assert.NoError(t, consul.Set("/gru/c1/config/", "empty", Options{}))
+	assert.NoError(t, consul.Set("/gru/c1/services/srv1", "{}", Options{}))
+	assert.NoError(t, consul.Set("/gru/c1/services/srv2", "{}", Options{}))
+	assert.NoError(t, consul.Set("/gru/c1/nodes/n1/config", "cfg", Options{}))
+	assert.NoError(t, consul.Set("/gru/c10/uuid", "other", Options{}))
+
+	resp, err := consul.Get("/gru/c1/uuid", Options{})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"/gru/c1/uuid": "id"}, resp)
+	resp, _ = consul.Get("/gru/c1/config", Options{})
+	assert.Equal(t, "empty", resp["/gru/c1/config"])
+
+	// The directories return their children, like etcd
+	resp, _ = consul.Get("/gru/c1", Options{})
+	assert.Equal(t, map[string]string{
+		"/gru/c1/uuid":     "id",
+		"/gru/c1/services": "",
+		"/gru/c1/config":   "empty",
+		"/gru/c1/nodes":    "",
+	}, resp)
+	resp, _ = consul.Get("/gru/c1/services", Options{})
+	assert.Equal(t, map[string]string{"/gru/c1/services/srv1": "{}", "/gru/c1/services/srv2": "{}"}, resp)
+	resp, _ = consul.Get("/gru/c1/nodes", Options{"Recursive": true})
+	assert.Equal(t, map[string]string{"/gru/c1/nodes/n1/config": "cfg"}, resp)
+	resp, _ = consul.Get("/gru/", Options{})
+	assert.Len(t, resp, 2)
+
+	_, err = consul.Get("/gru/c2", Options{})
+	assert.Equal(t, ErrKeyNotFound, err)
+
+	assert.Equal(t, ErrKeyExists, consul.Set("/gru/c1/uuid", "new", Options{"PrevExist": false}))
+	assert.Equal(t, ErrKeyNotFound, consul.Set("/gru/c1/missing", "new", Options{"PrevExist": true}))
+
+	assert.Equal(t, ErrCompareFailed, consul.DeleteIf("/gru/c1/uuid", "other"))
+	assert.NoError(t, consul.DeleteIf("/gru/c1/uuid", "id"))
+	assert.Equal(t, ErrKeyNotFound, consul.DeleteIf("/gru/c1/uuid", "id"))
+
+	assert.NoError(t, consul.Delete("/gru/c1/services"))
+	_, err = consul.Get("/gru/c1/services", Options{})
+	assert.Equal(t, ErrKeyNotFound, err)
+	assert.Contains(t, fake.keys(), "gru/c10/uuid")
+
+	server.Close()
+	_, err = consul.Get("/gru/c1/uuid", Options{})
+	assert.Equal(t, ErrUnreachable, err)
+}
+
+func TestConsulTTL(t *testing.T) {
+	fake := newFakeConsul()
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	consul := &consulDiscovery{}
+	assert.NoError(t, consul.Initialize(server.URL))
+
+	// The keys under a directory with a TTL are deleted with it
+	ttl := Options{"TTL": 6 * time.Second, "Dir": true}
+	assert.NoError(t, consul.Set("/gru/c1/nodes/n1", "", ttl))
+	assert.NoError(t, consul.Set("/gru/c1/nodes/n1/config", "cfg", Options{}))
+	assert.NoError(t, consul.Set("/gru/c1/uuid", "id", Options{}))
+	session := consul.sessions["gru/c1/nodes/n1"]
+	assert.Equal(t, "10s", fake.sessions[session]["TTL"])
+	assert.Equal(t, "delete", fake.sessions[session]["Behavior"])
+
+	refresh := Options{"TTL": 6 * time.Second, "Dir": true, "PrevExist": true}
+	assert.NoError(t, consul.Set("/gru/c1/nodes/n1", "", refresh))
+	assert.Equal(t, session, consul.sessions["gru/c1/nodes/n1"])
+
+	fake.mutex.Lock()
+	fake.expire(session)
+	fake.mutex.Unlock()
+	assert.Equal(t, []string{"gru/c1/uuid"}, fake.keys())
+	assert.Equal(t, ErrKeyNotFound, consul.Set("/gru/c1/nodes/n1", "", refresh))
+
+	// A new session is created when the key is written again
+	assert.NoError(t, consul.Set("/gru/c1/nodes/n1", "", ttl))
+	assert.NotEqual(t, session, consul.sessions["gru/c1/nodes/n1"])
+
+	// The lease can be acquired only once
+	lease := Options{"TTL": 10 * time.Second, "PrevExist": false}
+	assert.NoError(t, consul.Set("/gru/c1/leases/srv1", "n1", lease))
+	assert.Equal(t, ErrKeyExists, consul.Set("/gru/c1/leases/srv1", "n2", lease))
+}
+
+func TestConsulCatalog(t *testing.T) {
+	fake := newFakeConsul()
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	_, err := New("consul", server.URL)
+	assert.NoError(t, err)
+	defer New("noservice", "")
+
+	assert.NoError(t, RegisterInstance("srv1", "abc", "10.0.0.1:8080", 5*time.Second))
+	srv := fake.services["abc"]
+	assert.Equal(t, "srv1", srv.Name)
+	assert.Equal(t, "10.0.0.1", srv.Address)
+	assert.Equal(t, 8080, srv.Port)
+	assert.Equal(t, "5s", srv.Check.TTL)
+	assert.Equal(t, 1, fake.passed["abc"])
+
+	assert.NoError(t, PassInstance("abc"))
+	assert.Equal(t, 2, fake.passed["abc"])
+
+	assert.NoError(t, DeregisterInstance("abc"))
+	assert.Empty(t, fake.services)
+	assert.Equal(t, ErrKeyNotFound, PassInstance("abc"))
+}
+
+func TestParse(t *testing.T) {
+	name, address, err := Parse("consul://localhost:8500")
+	assert.NoError(t, err)
+	assert.Equal(t, "consul", name)
+	assert.Equal(t, "http://localhost:8500", address)
+
+	name, address, _ = Parse("etcd://10.0.0.1:2379")
+	assert.Equal(t, "etcd", name)
+	assert.Equal(t, "http://10.0.0.1:2379", address)
+
+	_, _, err = Parse("zookeeper://localhost:2181")
+	assert.Equal(t, ErrNotSupported, err)
+}
@@ -2,6 +2,8 @@ package discovery
 
 import (
 	"errors"
+	"net/url"
+	"time"
 
 	log "github.com/elleFlorio/gru/Godeps/_workspace/src/github.com/Sirupsen/logrus"
 )
@@ -13,25 +15,44 @@ type Discovery interface {
 	Get(string, Options) (map[string]string, error)
 	Set(string, string, Options) error
 	Delete(string) error
+	// Deletes the key only if it has the given value
+	DeleteIf(string, string) error
 }
 
 type Options map[string]interface{}
 
+// The discovery services with a catalog of the services (e.g. Consul)
+// register there also the instances, with a health check that is passed
+// while the instance is alive.
+type Catalog interface {
+	RegisterInstance(string, string, string, time.Duration) error
+	PassInstance(string) error
+	DeregisterInstance(string) error
+}
+
 var (
 	discoveries []Discovery
 	discService int
 
 	ErrNotSupported = errors.New("discovery service not supported")
+	// Returned by the backends when the discovery service cannot be contacted
+	ErrUnreachable   error = errors.New("discovery service unreachable")
+	ErrKeyNotFound   error = errors.New("Key not found")
+	ErrKeyExists     error = errors.New("Key already exists")
+	ErrCompareFailed error = errors.New("Key has a different value")
 )
 
 func init() {
 	discoveries = []Discovery{
 		&noService{},
 		&etcdDiscovery{},
+		&consulDiscovery{},
+		&fileDiscovery{},
 	}
 }
 
 func New(name string, uri string) (Discovery, error) {
+	stopCache()
 	discService = 0
 	for index, dscvr := range discoveries {
 		if dscvr.Name() == name {
@@ -48,7 +69,32 @@ func New(name string, uri string) (Discovery, error) {
 	return discoveries[discService], ErrNotSupported
 }
 
+// Parse returns the discovery service and its address from an URI like
+// consul://localhost:8500. The file service is given as file:///path, or as
+// memory:// to keep the data only in memory.
+func Parse(uri string) (string, string, error) {
+	parsed, err := url.Parse(uri)
+	if err != nil {
+		return "", "", err
+	}
+
+	switch parsed.Scheme {
+	case "etcd", "consul":
+		return parsed.Scheme, "http://" + parsed.Host, nil
+	case "file":
+		return "file", parsed.Host + parsed.Path, nil
+	case "memory":
+		return "file", "", nil
+	}
+
+	return "", "", ErrNotSupported
+}
+
 func service() Discovery {
+	if cache := getCache(); cache != nil {
+		return cache
+	}
+
 	return discoveries[discService]
 }
 
@@ -75,3 +121,33 @@ func Set(key string, value string, opt Options) error {
 func Delete(key string) error {
 	return service().Delete(key)
 }
+
+func DeleteIf(key string, value string) error {
+	return service().DeleteIf(key, value)
+}
+
+// The catalog is used directly and not through the cache: if the check of
+// an instance cannot be passed, the instance is registered again.
+func RegisterInstance(service string, id string, address string, ttl time.Duration) error {
+	if catalog, ok := discoveries[discService].(Catalog); ok {
+		return catalog.RegisterInstance(service, id, address, ttl)
+	}
+
+	return nil
+}
+
+func PassInstance(id string) error {
+	if catalog, ok := discoveries[discService].(Catalog); ok {
+		return catalog.PassInstance(id)
+	}
+
+	return nil
+}
+
+func DeregisterInstance(id string) error {
+	if catalog, ok := discoveries[discService].(Catalog); ok {
+		return catalog.DeregisterInstance(id)
+	}
+
+	return nil
+}
@@ -10,6 +10,9 @@ import (
 	"github.com/elleFlorio/gru/utils"
 )
 
+// Timeout of the requests, so an unreachable etcd does not block the agent
+const c_ETCD_TIMEOUT = 3 * time.Second
+
 type etcdDiscovery struct {
 	kAPI client.KeysAPI
 }
@@ -33,14 +36,16 @@ func (p *etcdDiscovery) Initialize(uri string) error {
 	p.kAPI = client.NewKeysAPI(etcd)
 
 	//This is needed to probe if the etcd server is reachable
+	ctx, cancel := context.WithTimeout(context.Background(), c_ETCD_TIMEOUT)
+	defer cancel()
 	_, err = p.kAPI.Set(
-		context.Background(),
+		ctx,
 		"/probe",
 		"etcd",
 		&client.SetOptions{TTL: time.Duration(1) * time.Millisecond},
 	)
 	if err != nil {
-		return err
+		return checkError(err)
 	}
 
 	return nil
@@ -48,12 +53,15 @@ func (p *etcdDiscovery) Initialize(uri string) error {
 
 func (p *etcdDiscovery) Register(nodePath string, nodeAddress string) error {
 
+	ctx, cancel := context.WithTimeout(context.Background(), c_ETCD_TIMEOUT)
+	defer cancel()
 	_, err := p.kAPI.Set(
-		context.Background(),
+		ctx,
 		nodePath,
 		nodeAddress,
 		nil,
 	)
+	err = checkError(err)
 	if err != nil {
 		log.WithField("err", err).Errorln("Registering to discovery service")
 		return err
@@ -72,7 +80,10 @@ func (p *etcdDiscovery) Get(key string, opt Options) (map[string]string, error)
 		return nil, err
 	}
 
-	resp, err := p.kAPI.Get(context.Background(), key, cli_opt)
+	ctx, cancel := context.WithTimeout(context.Background(), c_ETCD_TIMEOUT)
+	defer cancel()
+	resp, err := p.kAPI.Get(ctx, key, cli_opt)
+	err = checkError(err)
 	if err != nil {
 		log.WithField("err", err).Errorln("Querying discovery service")
 		return nil, err
@@ -105,8 +116,12 @@ func (p *etcdDiscovery) Set(key string, value string, opt Options) error {
 	var err error
 
 	cli_opt := &client.SetOptions{}
-	if _, ok := opt["PrevExist"]; ok {
-		opt["PrevExist"] = client.PrevExist
+	if prevExist, ok := opt["PrevExist"]; ok {
+		if exist, isBool := prevExist.(bool); isBool && !exist {
+			opt["PrevExist"] = client.PrevNoExist
+		} else {
+			opt["PrevExist"] = client.PrevExist
+		}
 	}
 	err = utils.FillStruct(cli_opt, opt)
 	if err != nil {
@@ -114,11 +129,14 @@ func (p *etcdDiscovery) Set(key string, value string, opt Options) error {
 		return err
 	}
 
+	ctx, cancel := context.WithTimeout(context.Background(), c_ETCD_TIMEOUT)
+	defer cancel()
 	_, err = p.kAPI.Set(
-		context.Background(),
+		ctx,
 		key,
 		value,
 		cli_opt)
+	err = checkError(err)
 	if err != nil {
 		log.WithField("err", err).Errorln("Error setting value to discovery service")
 		return err
@@ -129,7 +147,40 @@ func (p *etcdDiscovery) Set(key string, value string, opt Options) error {
 
 func (p *etcdDiscovery) Delete(key string) error {
 	var err error
-	_, err = p.kAPI.Delete(context.Background(), key, nil)
+	ctx, cancel := context.WithTimeout(context.Background(), c_ETCD_TIMEOUT)
+	defer cancel()
+	_, err = p.kAPI.Delete(ctx, key, nil)
 
-	return err
+	return checkError(err)
+}
+
+// The compare-and-delete of etcd checks the value atomically
+func (p *etcdDiscovery) DeleteIf(key string, value string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), c_ETCD_TIMEOUT)
+	defer cancel()
+	_, err := p.kAPI.Delete(ctx, key, &client.DeleteOptions{PrevValue: value})
+	if etcdErr, ok := err.(client.Error); ok {
+		switch etcdErr.Code {
+		case client.ErrorCodeKeyNotFound:
+			return ErrKeyNotFound
+		case client.ErrorCodeTestFailed:
+			return ErrCompareFailed
+		}
+	}
+
+	return checkError(err)
+}
+
+// The errors returned by etcd (e.g. key not found) are kept, while the
+// failures to contact the cluster are returned as ErrUnreachable.
+func checkError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := err.(client.Error); ok {
+		return err
+	}
+
+	log.WithField("err", err).Debugln("Cannot contact etcd")
+	return ErrUnreachable
 }
@@ -0,0 +1,322 @@
+package discovery
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	log "github.com/elleFlorio/gru/Godeps/_workspace/src/github.com/Sirupsen/logrus"
+)
+
+var (
+	ErrNotFile error = errors.New("Key is a directory")
+	ErrNotDir  error = errors.New("Key is not a directory")
+
+	// The clock can be replaced to test the expiry deterministically
+	fileNow = time.Now
+)
+
+// The file discovery keeps the tree of the keys in memory, with the same
+// semantics of etcd for directories and TTL, so a single node can run
+// without etcd. If a path is given the tree is read from that file at every
+// operation and saved to it at every write. The processes sharing the file
+// (e.g. gru manage) take a lock on it, so their writes do not overwrite
+// each other.
+type fileDiscovery struct {
+	path    string
+	entries map[string]fileEntry
+	mutex   sync.Mutex
+}
+
+type fileEntry struct {
+	Value      string    `json:"value,omitempty"`
+	Dir        bool      `json:"dir,omitempty"`
+	Expiration time.Time `json:"expiration"`
+}
+
+func (p *fileDiscovery) Name() string {
+	return "file"
+}
+
+func (p *fileDiscovery) Initialize(uri string) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	log.WithField("path", uri).Debugln("Initializing file discovery")
+	p.path = uri
+	p.entries = map[string]fileEntry{"/": {Dir: true}}
+
+	unlock, err := p.lock(syscall.LOCK_SH)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	return p.reload()
+}
+
+func (p *fileDiscovery) Register(nodePath string, nodeAddress string) error {
+	return p.Set(nodePath, nodeAddress, Options{})
+}
+
+func (p *fileDiscovery) Get(key string, opt Options) (map[string]string, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	unlock, err := p.lock(syscall.LOCK_SH)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	if err = p.reload(); err != nil {
+		return nil, err
+	}
+	p.expire()
+
+	key = cleanKey(key)
+	entry, ok := p.entries[key]
+	if !ok {
+		return nil, ErrKeyNotFound
+	}
+	if !entry.Dir {
+		return map[string]string{key: entry.Value}, nil
+	}
+
+	recursive, _ := opt["Recursive"].(bool)
+	result := make(map[string]string)
+	for k, child := range p.entries {
+		if k == key || !isUnder(k, key) {
+			continue
+		}
+		if recursive {
+			if !child.Dir {
+				result[k] = child.Value
+			}
+		} else if path.Dir(k) == key {
+			result[k] = child.Value
+		}
+	}
+
+	return result, nil
+}
+
+// The options follow the ones of etcd: Dir creates a directory, PrevExist
+// writes the key only if it does (not) exist and TTL deletes the key, with
+// the keys under it, when it expires. The parent directories are created
+// if needed.
+func (p *fileDiscovery) Set(key string, value string, opt Options) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	unlock, err := p.lock(syscall.LOCK_EX)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	if err = p.reload(); err != nil {
+		return err
+	}
+	p.expire()
+
+	key = cleanKey(key)
+	dir, _ := opt["Dir"].(bool)
+	stored, exists := p.entries[key]
+	if prevExist, ok := opt["PrevExist"].(bool); ok {
+		if prevExist && !exists {
+			return ErrKeyNotFound
+		}
+		if !prevExist && exists {
+			return ErrKeyExists
+		}
+	}
+	if exists && stored.Dir && (!dir || opt["PrevExist"] == nil) {
+		return ErrNotFile
+	}
+	if exists && !stored.Dir && dir {
+		return ErrNotDir
+	}
+
+	for parent := path.Dir(key); parent != "/"; parent = path.Dir(parent) {
+		if entry, ok := p.entries[parent]; ok {
+			if !entry.Dir {
+				return ErrNotDir
+			}
+			continue
+		}
+		p.entries[parent] = fileEntry{Dir: true}
+	}
+
+	entry := fileEntry{Value: value, Dir: dir}
+	if dir {
+		entry.Value = ""
+	}
+	if ttl, ok := opt["TTL"].(time.Duration); ok && ttl > 0 {
+		entry.Expiration = fileNow().Add(ttl)
+	}
+	p.entries[key] = entry
+
+	return p.save()
+}
+
+// The key is deleted together with the keys under it.
+func (p *fileDiscovery) Delete(key string) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	unlock, err := p.lock(syscall.LOCK_EX)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	if err = p.reload(); err != nil {
+		return err
+	}
+	p.expire()
+
+	key = cleanKey(key)
+	if _, ok := p.entries[key]; !ok || key == "/" {
+		return ErrKeyNotFound
+	}
+	p.remove(key)
+
+	return p.save()
+}
+
+func (p *fileDiscovery) DeleteIf(key string, value string) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	unlock, err := p.lock(syscall.LOCK_EX)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	if err = p.reload(); err != nil {
+		return err
+	}
+	p.expire()
+
+	key = cleanKey(key)
+	entry, ok := p.entries[key]
+	if !ok || key == "/" {
+		return ErrKeyNotFound
+	}
+	if entry.Dir || entry.Value != value {
+		return ErrCompareFailed
+	}
+	p.remove(key)
+
+	return p.save()
+}
+
+func (p *fileDiscovery) expire() {
+	now := fileNow()
+	expired := []string{}
+	for key, entry := range p.entries {
+		if !entry.Expiration.IsZero() && !now.Before(entry.Expiration) {
+			expired = append(expired, key)
+		}
+	}
+	// The parents are removed before the children, that are removed with them
+	sort.Strings(expired)
+	for _, key := range expired {
+		if _, ok := p.entries[key]; ok {
+			log.WithField("key", key).Debugln("Key expired")
+			p.remove(key)
+		}
+	}
+}
+
+func (p *fileDiscovery) remove(key string) {
+	for k := range p.entries {
+		if k == key || isUnder(k, key) {
+			delete(p.entries, k)
+		}
+	}
+}
+
+// The lock is taken on a separate file, since the file of the tree is
+// replaced at every write. The writers take it exclusively, so the tree
+// they read is not changed by another process until they save it.
+func (p *fileDiscovery) lock(how int) (func(), error) {
+	if p.path == "" {
+		return func() {}, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(p.path), 0700); err != nil {
+		return nil, err
+	}
+	lockFile, err := os.OpenFile(p.path+".lock", os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, err
+	}
+	if err = syscall.Flock(int(lockFile.Fd()), how); err != nil {
+		lockFile.Close()
+		return nil, err
+	}
+
+	return func() {
+		syscall.Flock(int(lockFile.Fd()), syscall.LOCK_UN)
+		lockFile.Close()
+	}, nil
+}
+
+// The file is read at every operation, holding the lock, so the changes
+// of the other processes are never missed.
+func (p *fileDiscovery) reload() error {
+	if p.path == "" {
+		return nil
+	}
+
+	content, err := ioutil.ReadFile(p.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	entries := make(map[string]fileEntry)
+	if err = json.Unmarshal(content, &entries); err != nil {
+		return err
+	}
+	entries["/"] = fileEntry{Dir: true}
+	p.entries = entries
+
+	return nil
+}
+
+// The tree is written to a temporary file and then renamed, so a crash
+// does not leave a corrupted file.
+func (p *fileDiscovery) save() error {
+	if p.path == "" {
+		return nil
+	}
+
+	content, err := json.MarshalIndent(p.entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(p.path), 0700); err != nil {
+		return err
+	}
+	tmp := p.path + ".tmp"
+	if err = ioutil.WriteFile(tmp, content, 0600); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, p.path)
+}
+
+func cleanKey(key string) string {
+	return path.Clean("/" + key)
+}
+
+func isUnder(key string, dir string) bool {
+	if dir == "/" {
+		return key != "/"
+	}
+	return strings.HasPrefix(key, dir+"/")
+}
@@ -0,0 +1,145 @@
+package discovery
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/elleFlorio/gru/Godeps/_workspace/src/github.com/stretchr/testify/assert"
+)
+
+func TestFileDiscovery(t *testing.T) {
+	defer func() { fileNow = time.Now }()
+	current := time.Now()
+	fileNow = func() time.Time { return current }
+
+	file := &fileDiscovery{}
+	assert.NoError(t, file.Initialize(""))
+
+	assert.NoError(t, file.Register("/gru/c1/uuid", "id"))
+	assert.NoError(t, file.Set("/gru/c1/nodes/", "", Options{"Dir": true}))
+	assert.NoError(t, file.Set("/gru/c1/config/", "empty", Options{}))
+	assert.NoError(t, file.Set("/gru/c1/services/srv1", "{}", Options{}))
+
+	resp, err := file.Get("/gru/c1/config", Options{})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"/gru/c1/config": "empty"}, resp)
+	resp, _ = file.Get("/gru/c1", Options{})
+	assert.Equal(t, map[string]string{
+		"/gru/c1/uuid":     "id",
+		"/gru/c1/nodes":    "",
+		"/gru/c1/config":   "empty",
+		"/gru/c1/services": "",
+	}, resp)
+	resp, _ = file.Get("/gru/", Options{"Recursive": true})
+	assert.Len(t, resp, 3)
+	resp, _ = file.Get("/gru/c1/nodes", Options{})
+	assert.Empty(t, resp)
+	_, err = file.Get("/gru/c2", Options{})
+	assert.Equal(t, ErrKeyNotFound, err)
+
+	assert.Equal(t, ErrNotFile, file.Set("/gru/c1/nodes", "value", Options{}))
+	assert.Equal(t, ErrNotFile, file.Set("/gru/c1/nodes", "", Options{"Dir": true}))
+	assert.Equal(t, ErrNotDir, file.Set("/gru/c1/uuid/key", "value", Options{}))
+	assert.Equal(t, ErrKeyExists, file.Set("/gru/c1/uuid", "new", Options{"PrevExist": false}))
+
+	// The keys under a directory expire with it, unless it is refreshed
+	ttl := Options{"TTL": 6 * time.Second, "Dir": true}
+	refresh := Options{"TTL": 6 * time.Second, "Dir": true, "PrevExist": true}
+	assert.NoError(t, file.Set("/gru/c1/nodes/n1", "", ttl))
+	assert.NoError(t, file.Set("/gru/c1/nodes/n1/config", "cfg", Options{}))
+	current = current.Add(5 * time.Second)
+	assert.NoError(t, file.Set("/gru/c1/nodes/n1", "", refresh))
+	current = current.Add(5 * time.Second)
+	resp, _ = file.Get("/gru/c1/nodes", Options{})
+	assert.Equal(t, map[string]string{"/gru/c1/nodes/n1": ""}, resp)
+
+	current = current.Add(time.Second)
+	resp, _ = file.Get("/gru/c1/nodes", Options{})
+	assert.Empty(t, resp)
+	_, err = file.Get("/gru/c1/nodes/n1/config", Options{})
+	assert.Equal(t, ErrKeyNotFound, err)
+	assert.Equal(t, ErrKeyNotFound, file.Set("/gru/c1/nodes/n1", "", refresh))
+
+	assert.NoError(t, file.Set("/gru/c1/leases/srv1", "node1", Options{}))
+	assert.Equal(t, ErrCompareFailed, file.DeleteIf("/gru/c1/leases/srv1", "node2"))
+	assert.NoError(t, file.DeleteIf("/gru/c1/leases/srv1", "node1"))
+	assert.Equal(t, ErrKeyNotFound, file.DeleteIf("/gru/c1/leases/srv1", "node1"))
+
+	assert.NoError(t, file.Delete("/gru/c1/services"))
+	_, err = file.Get("/gru/c1/services/srv1", Options{})
+	assert.Equal(t, ErrKeyNotFound, err)
+	assert.Equal(t, ErrKeyNotFound, file.Delete("/gru/c1/services"))
+}
+
+func TestFilePersistence(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gru-file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "discovery.json")
+
+	name, address, err := Parse("file://" + path)
+	assert.NoError(t, err)
+	assert.Equal(t, "file", name)
+	assert.Equal(t, path, address)
+	name, address, _ = Parse("memory://")
+	assert.Equal(t, "file", name)
+	assert.Equal(t, "", address)
+
+	_, err = New("file", path)
+	assert.NoError(t, err)
+	defer New("noservice", "")
+	assert.NoError(t, Set("/gru/c1/uuid", "id", Options{}))
+	assert.NoError(t, WriteData("/gru/c1/config", map[string]int{"maxfriends": 5}))
+
+	// Another process reads the data written to the file
+	other := &fileDiscovery{}
+	assert.NoError(t, other.Initialize(path))
+	resp, err := other.Get("/gru/c1/uuid", Options{})
+	assert.NoError(t, err)
+	assert.Equal(t, "id", resp["/gru/c1/uuid"])
+
+	// and its writes are read by the first one
+	assert.NoError(t, other.Set("/gru/c1/uuid", "new", Options{}))
+	resp, _ = Get("/gru/c1/uuid", Options{})
+	assert.Equal(t, "new", resp["/gru/c1/uuid"])
+	config := map[string]int{}
+	assert.NoError(t, ReadData("/gru/c1/config", &config))
+	assert.Equal(t, 5, config["maxfriends"])
+}
+
+func TestFileConcurrentWrites(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gru-file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "discovery.json")
+
+	// Each process writes its keys, none of them is lost
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		process := &fileDiscovery{}
+		assert.NoError(t, process.Initialize(path))
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				assert.NoError(t, process.Set(fmt.Sprintf("/gru/p%d/k%d", id, j), "v", Options{}))
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	reader := &fileDiscovery{}
+	assert.NoError(t, reader.Initialize(path))
+	resp, err := reader.Get("/gru", Options{"Recursive": true})
+	assert.NoError(t, err)
+	assert.Len(t, resp, 40)
+}
@@ -31,3 +31,7 @@ func (p *noService) Set(key string, value string, opt Options) error {
 func (p *noService) Delete(key string) error {
 	return ErrNoService
 }
+
+func (p *noService) DeleteIf(key string, value string) error {
+	return ErrNoService
+}
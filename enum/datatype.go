@@ -7,6 +7,8 @@ const (
 	ANALYTICS Datatype = iota
 	POLICIES  Datatype = iota
 	SHARED    Datatype = iota
+	LEARNING  Datatype = iota
+	DECISIONS Datatype = iota
 )
 
 func (d Datatype) Value() float64 {
@@ -20,6 +22,10 @@ func (d Datatype) Value() float64 {
 		v = 2.0
 	case d == SHARED:
 		v = 3.0
+	case d == LEARNING:
+		v = 4.0
+	case d == DECISIONS:
+		v = 5.0
 	}
 
 	return v
@@ -36,6 +42,10 @@ func (d Datatype) ToString() string {
 		s = "POLICIES"
 	case d == SHARED:
 		s = "SHARED"
+	case d == LEARNING:
+		s = "LEARNING"
+	case d == DECISIONS:
+		s = "DECISIONS"
 	}
 
 	return s
@@ -11,6 +11,8 @@ var (
 	data_a Enum = ANALYTICS
 	data_p Enum = POLICIES
 	data_i Enum = SHARED
+	data_l Enum = LEARNING
+	data_d Enum = DECISIONS
 
 	action_no   Enum    = NOACTION
 	action_st   Enum    = START
@@ -28,6 +30,8 @@ func TestValue(t *testing.T) {
 	assert.Equal(t, 1.0, data_a.Value())
 	assert.Equal(t, 2.0, data_p.Value())
 	assert.Equal(t, 3.0, data_i.Value())
+	assert.Equal(t, 4.0, data_l.Value())
+	assert.Equal(t, 5.0, data_d.Value())
 
 	assert.Equal(t, 0.0, action_no.Value())
 	assert.Equal(t, 1.0, action_st.Value())
@@ -45,6 +49,8 @@ func TestToString(t *testing.T) {
 	assert.Equal(t, "ANALYTICS", data_a.ToString())
 	assert.Equal(t, "POLICIES", data_p.ToString())
 	assert.Equal(t, "SHARED", data_i.ToString())
+	assert.Equal(t, "LEARNING", data_l.ToString())
+	assert.Equal(t, "DECISIONS", data_d.ToString())
 
 	assert.Equal(t, "NOACTION", action_no.ToString())
 	assert.Equal(t, "START", action_st.ToString())
@@ -9,20 +9,28 @@ import (
 	"os/signal"
 	"os/user"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 	"syscall"
 	"text/tabwriter"
+	"time"
 
 	"github.com/elleFlorio/gru/Godeps/_workspace/src/github.com/peterh/liner"
 
 	"github.com/elleFlorio/gru/cluster"
+	cfg "github.com/elleFlorio/gru/configuration"
+	"github.com/elleFlorio/gru/data"
 	"github.com/elleFlorio/gru/discovery"
 	"github.com/elleFlorio/gru/network"
+	"github.com/elleFlorio/gru/service"
 )
 
 const c_GRU_PATH = "/gru/"
 const c_NODES_PATH = "nodes/"
+const c_CONFIG_PATH = "config"
+const c_DEPENDENCY_TIMEOUT = 60
+const c_ROLLOUT_TIMEOUT = 600
 
 type Manager struct {
 	Remote      discovery.Discovery
@@ -33,8 +41,8 @@ type Manager struct {
 	historyFile *os.File
 }
 
-func New(etcdAddr string) (*Manager, error) {
-	remote, err := discovery.New("etcd", etcdAddr)
+func New(discoveryName string, discoveryAddr string) (*Manager, error) {
+	remote, err := discovery.New(discoveryName, discoveryAddr)
 	if err != nil {
 		return nil, err
 	}
@@ -128,6 +136,8 @@ func (m *Manager) ParseCommand(cmd string) bool {
 			m.stop(cmd)
 		case "update":
 			m.update(cmd)
+		case "rolling-update":
+			m.rollingUpdate(cmd)
 		case "deploy":
 			m.deploy()
 		case "undeploy":
@@ -277,6 +287,42 @@ func setNode(clusterName string, who string, what string, to_what []string) {
 		} else {
 			fmt.Println("CPU value not valid: it should be a float between 0.0 and 1.0")
 		}
+	case "memmin":
+		memmin := to_what[0]
+		if ok, value := checkValidCpuValue(memmin); ok {
+			for _, address := range dest {
+				err := network.SendUpdateCommand(address, "node-memmin", value)
+				if err != nil {
+					fmt.Println("Error sending update command to ", address)
+				}
+			}
+		} else {
+			fmt.Println("Memory value not valid: it should be a float between 0.0 and 1.0")
+		}
+	case "memmax":
+		memmax := to_what[0]
+		if ok, value := checkValidCpuValue(memmax); ok {
+			for _, address := range dest {
+				err := network.SendUpdateCommand(address, "node-memmax", value)
+				if err != nil {
+					fmt.Println("Error sending update command to ", address)
+				}
+			}
+		} else {
+			fmt.Println("Memory value not valid: it should be a float between 0.0 and 1.0")
+		}
+	case "mode":
+		mode := to_what[0]
+		if mode != cfg.ModeActive && mode != cfg.ModeAdvisory {
+			fmt.Println(cfg.ErrInvalidMode)
+			return
+		}
+		for _, address := range dest {
+			err := network.SendUpdateCommand(address, "node-mode", mode)
+			if err != nil {
+				fmt.Println("Error sending update command to ", address)
+			}
+		}
 	default:
 		fmt.Println("Unrecognized parameter ", what)
 	}
@@ -309,6 +355,10 @@ func setService(clusterName string, who string, what string, to_what []string) {
 	service := cluster.GetService(clusterName, who)
 	switch what {
 	case "TODO":
+		if err := checkServiceUpdate(clusterName, service); err != nil {
+			fmt.Println("Invalid service ", who, ": ", err)
+			return
+		}
 		cluster.UpdateService(clusterName, who, service)
 		for _, address := range nodes {
 			network.SendUpdateCommand(address, "TODO", who)
@@ -318,6 +368,36 @@ func setService(clusterName string, who string, what string, to_what []string) {
 	}
 }
 
+// The service is checked as the nodes do when they read it, so an invalid
+// service is not uploaded to the cluster.
+func checkServiceUpdate(clusterName string, srv cfg.Service) error {
+	if err := service.ValidateService(srv); err != nil {
+		return err
+	}
+
+	services := []cfg.Service{srv}
+	for _, other := range cluster.GetServices(clusterName) {
+		if other.Name != srv.Name {
+			services = append(services, other)
+		}
+	}
+
+	return service.CheckDependencies(services)
+}
+
+// The services of the cluster are checked before the nodes are asked to
+// read them.
+func checkClusterServices(clusterName string) error {
+	services := cluster.GetServices(clusterName)
+	for _, srv := range services {
+		if err := service.ValidateService(srv); err != nil {
+			return fmt.Errorf("service %s: %s", srv.Name, err)
+		}
+	}
+
+	return service.CheckDependencies(services)
+}
+
 func checkValidServices(services []string, list []string) (bool, []string) {
 	check := true
 	notValid := []string{}
@@ -488,6 +568,13 @@ func (m *Manager) update(cmd string) {
 		return
 	}
 
+	if args[1] == "services" || args[1] == "all" {
+		if err := checkClusterServices(m.Cluster); err != nil {
+			fmt.Println("Cannot update services: ", err)
+			return
+		}
+	}
+
 	var err error
 	w := new(tabwriter.Writer)
 	w.Init(os.Stdout, 0, 8, 1, '\t', 0)
@@ -511,6 +598,147 @@ func (m *Manager) update(cmd string) {
 	w.Flush()
 }
 
+// rolling-update <service> <image|rollback|resume> [maxsurge <n>] [maxunavailable <n>] [readytimeout <seconds>]
+func (m *Manager) rollingUpdate(cmd string) {
+	args := strings.Split(strings.TrimSuffix(strings.TrimSpace(cmd), ";"), " ")
+	if len(args) < 3 {
+		fmt.Println("not enough arguments to 'rolling-update' command")
+		return
+	}
+
+	if !m.isClusterSet() {
+		return
+	}
+
+	name := args[1]
+	srv := cluster.GetService(m.Cluster, name)
+	if srv.Name == "" {
+		fmt.Println("Unknown service ", name)
+		return
+	}
+
+	update, ok := parseRollingUpdate(args[3:])
+	if !ok {
+		return
+	}
+
+	switch args[2] {
+	case "rollback":
+		if srv.PreviousImage == "" {
+			fmt.Println("No previous image to rollback to for service ", name)
+			return
+		}
+		srv.Image, srv.PreviousImage = srv.PreviousImage, srv.Image
+	case "resume":
+	default:
+		if args[2] != srv.Image {
+			srv.PreviousImage = srv.Image
+			srv.Image = args[2]
+		}
+	}
+	if err := checkServiceUpdate(m.Cluster, srv); err != nil {
+		fmt.Println("Invalid service ", name, ": ", err)
+		return
+	}
+	cluster.UpdateService(m.Cluster, name, srv)
+
+	update.Service = name
+	update.Image = srv.Image
+	update.PreviousImage = srv.PreviousImage
+
+	w := new(tabwriter.Writer)
+	w.Init(os.Stdout, 0, 8, 1, '\t', 0)
+	fmt.Fprintf(w, "NODE\tSTATUS\tREPLACED\n")
+	defer w.Flush()
+
+	nodes := cluster.ListNodes(m.Cluster, false)
+	nodesNames := make([]string, 0, len(nodes))
+	for node, _ := range nodes {
+		nodesNames = append(nodesNames, node)
+	}
+	sort.Strings(nodesNames)
+
+	for _, node := range nodesNames {
+		rollout, err := rollingUpdateNode(nodes[node], update)
+		if err != nil {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", node, "error", "-")
+			fmt.Println("Error updating node ", node, ": ", err)
+			break
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%d/%d\n", node, rollout.Status, rollout.Replaced, rollout.Total)
+		if rollout.Status != data.RolloutCompleted {
+			fmt.Printf("Rolling update paused on node %s: %s\n", node, rollout.Error)
+			fmt.Printf("Use 'rolling-update %s resume' or 'rolling-update %s rollback'\n", name, name)
+			break
+		}
+	}
+}
+
+func parseRollingUpdate(options []string) (data.RollingUpdate, bool) {
+	update := data.RollingUpdate{MaxSurge: 1}
+	if len(options)%2 != 0 {
+		fmt.Println("Options of 'rolling-update' must be pairs <option> <value>")
+		return update, false
+	}
+
+	for i := 0; i < len(options); i += 2 {
+		value, err := strconv.Atoi(options[i+1])
+		if err != nil || value < 0 {
+			fmt.Println("Invalid value for option ", options[i])
+			return update, false
+		}
+
+		switch options[i] {
+		case "maxsurge":
+			update.MaxSurge = value
+		case "maxunavailable":
+			update.MaxUnavailable = value
+		case "readytimeout":
+			update.ReadyTimeout = value
+		default:
+			fmt.Println("Unrecognized option ", options[i])
+			return update, false
+		}
+	}
+
+	if update.MaxSurge == 0 && update.MaxUnavailable == 0 {
+		fmt.Println("maxsurge and maxunavailable cannot be both 0")
+		return update, false
+	}
+
+	return update, true
+}
+
+func rollingUpdateNode(address string, update data.RollingUpdate) (data.Rollout, error) {
+	err := network.SendRollingUpdateCommand(address, update.Service, update)
+	if err != nil {
+		return data.Rollout{}, err
+	}
+
+	timeout := time.After(time.Second * c_ROLLOUT_TIMEOUT)
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	rollout := data.Rollout{}
+	for {
+		select {
+		case <-ticker.C:
+			err := network.GetRollout(address, update.Service, &rollout)
+			if err != nil {
+				return rollout, err
+			}
+			if rollout.Status != data.RolloutRunning {
+				return rollout, nil
+			}
+		case <-timeout:
+			// The last status read is kept to show the progress
+			rollout.Status = "timeout"
+			rollout.Error = fmt.Sprintf("not completed within %d seconds", c_ROLLOUT_TIMEOUT)
+			return rollout, nil
+		}
+	}
+}
+
 func (m *Manager) show(cmd string) {
 	args := strings.Split(strings.TrimSuffix(strings.TrimSpace(cmd), ";"), " ")
 	if len(args) < 4 {
@@ -573,24 +801,28 @@ func showNode(clusterName string, nodeName string, what string) {
 			}
 		}
 	case "constraints":
-		fmt.Fprintf(w, "NAME\tBASE-SERVICES\tCPU-MIN\tCPU-MAX\n")
+		fmt.Fprintf(w, "NAME\tBASE-SERVICES\tCPU-MIN\tCPU-MAX\tMEM-MIN\tMEM-MAX\n")
 		for _, node := range nodes {
 			constraints := node.Constraints
 			if nodeName != "all" {
 				if node.Configuration.Name == nodeName {
-					fmt.Fprintf(w, "%s\t%v\t%f\t%f\n",
+					fmt.Fprintf(w, "%s\t%v\t%f\t%f\t%f\t%f\n",
 						node.Configuration.Name,
 						constraints.BaseServices,
 						constraints.CpuMin,
 						constraints.CpuMax,
+						constraints.MemMin,
+						constraints.MemMax,
 					)
 				}
 			} else {
-				fmt.Fprintf(w, "%s\t%v\t%f\t%f\n",
+				fmt.Fprintf(w, "%s\t%v\t%f\t%f\t%f\t%f\n",
 					node.Configuration.Name,
 					constraints.BaseServices,
 					constraints.CpuMin,
 					constraints.CpuMax,
+					constraints.MemMin,
+					constraints.MemMax,
 				)
 			}
 		}
@@ -631,12 +863,21 @@ func (m *Manager) deploy() {
 	w.Init(os.Stdout, 0, 8, 1, '\t', 0)
 	fmt.Fprintf(w, "NODE\tSERVICE\tSTATUS\n")
 
-	services := cluster.ListServices(m.Cluster)
-	servicesNames := make([]string, 0, len(services))
-	for name, _ := range services {
-		servicesNames = append(servicesNames, name)
+	services := cluster.GetServices(m.Cluster)
+	servicesNames, err := service.SortByDependencies(services)
+	if err != nil {
+		fmt.Println("Cannot deploy: ", err)
+		return
+	}
+	dependencies := make(map[string][]string, len(services))
+	for _, srv := range services {
+		dependencies[srv.Name] = srv.DependsOn
 	}
 
+	agentConfig := cfg.Agent{}
+	cfg.ReadAgentConfig(c_GRU_PATH+m.Cluster+"/"+c_CONFIG_PATH, &agentConfig)
+	appRoot := agentConfig.Discovery.AppRoot
+
 	nodes := cluster.ListNodes(m.Cluster, false)
 	nodesNames := make([]string, 0, len(nodes))
 	for name, _ := range nodes {
@@ -654,6 +895,13 @@ func (m *Manager) deploy() {
 		address := nodes[node]
 		status := "done"
 
+		if !waitForDependencies(appRoot, dependencies[service]) {
+			fmt.Println("Dependencies not running for service ", service)
+			status = "error"
+			fmt.Fprintf(w, "%s\t%s\t%s\n", node, service, status)
+			continue
+		}
+
 		err = network.SendUpdateCommand(address, "node-base-services", []string{service})
 		if err != nil {
 			fmt.Println("Error sending update command to ", address)
@@ -678,6 +926,30 @@ func (m *Manager) deploy() {
 	w.Flush()
 }
 
+func waitForDependencies(appRoot string, dependencies []string) bool {
+	timeout := time.After(time.Second * c_DEPENDENCY_TIMEOUT)
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		running := true
+		for _, dep := range dependencies {
+			if !service.IsRunningInCluster(appRoot, dep) {
+				running = false
+				break
+			}
+		}
+		if running {
+			return true
+		}
+
+		select {
+		case <-ticker.C:
+		case <-timeout:
+			return false
+		}
+	}
+}
+
 func (m *Manager) undeploy() {
 	if !m.isClusterSet() {
 		return
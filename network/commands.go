@@ -7,6 +7,8 @@ import (
 )
 
 const c_COMMAND_ROUTE = "/gru/v1/commands"
+const c_ROLLOUT_ROUTE = "/gru/v1/rollouts/"
+const c_ACTION_ROUTE = "/gru/v1/actions/"
 
 type Command struct {
 	Name   string
@@ -69,6 +71,35 @@ func SendUpdateCommand(dest string, target string, obj interface{}) error {
 	return nil
 }
 
+func SendRollingUpdateCommand(dest string, name string, update interface{}) error {
+	cmd := Command{"rolling-update", name, update}
+	err := sendCommand(dest, cmd)
+	if err != nil {
+		log.WithField("err", err).Errorln("Error sending command to destination ", dest)
+		return err
+	}
+
+	return nil
+}
+
+func GetRollout(dest string, name string, rollout interface{}) error {
+	body, err := DoRequest("GET", dest+c_ROLLOUT_ROUTE+name, nil)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(body, rollout)
+}
+
+func GetAction(dest string, id string, record interface{}) error {
+	body, err := DoRequest("GET", dest+c_ACTION_ROUTE+id, nil)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(body, record)
+}
+
 func sendCommand(address string, cmd Command) error {
 	var err error
 	body, err := json.Marshal(cmd)
@@ -3,14 +3,18 @@ package network
 import (
 	"bytes"
 	"errors"
+	"fmt"
 	"io/ioutil"
 	"net"
 	"net/http"
 	"strconv"
 )
 
+const c_CONTENT_JSON = "application/json"
+
 var (
 	config         NetworkConfig
+	token          string
 	ErrNoIpAddress error = errors.New("Cannot retrieve node ip address.")
 )
 
@@ -75,28 +79,50 @@ func getPort() (string, error) {
 	return port, err
 }
 
+// The token is attached to all the requests to the other nodes
+func SetToken(value string) {
+	token = value
+}
+
 func Config() NetworkConfig {
 	return config
 }
 
 func DoRequest(method string, path string, body []byte) ([]byte, error) {
+	data, _, err := DoRequestContent(method, path, body, c_CONTENT_JSON, "")
+	return data, err
+}
+
+// The body is sent with the given content type, while accept asks the
+// server for a specific encoding of the response. The content type of the
+// response is returned to decode it. The responses without a 2xx status
+// (e.g. a refused token) are returned as errors.
+func DoRequestContent(method string, path string, body []byte, contentType string, accept string) ([]byte, string, error) {
 	b := bytes.NewBuffer(body)
 
 	req, err := http.NewRequest(method, path, b)
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
 
-	req.Header.Add("Content-type", "application/json")
+	req.Header.Add("Content-type", contentType)
+	if accept != "" {
+		req.Header.Add("Accept", accept)
+	}
+	if token != "" {
+		req.Header.Add("Authorization", "Bearer "+token)
+	}
 
-	client := &http.Client{}
 	resp, err := client.Do(req)
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
 
 	defer resp.Body.Close()
 	data, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		return nil, "", fmt.Errorf("%s %s: %s", method, path, resp.Status)
+	}
 
-	return data, nil
+	return data, resp.Header.Get("Content-Type"), nil
 }
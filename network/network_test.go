@@ -1,7 +1,22 @@
 package network
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/elleFlorio/gru/Godeps/_workspace/src/github.com/stretchr/testify/assert"
 )
@@ -15,3 +30,104 @@ func TestGetHostIp(t *testing.T) {
 	_, err := getHostIp()
 	assert.NoError(t, err, "IP retrieval should generate no error")
 }
+
+func TestDoRequestStatus(t *testing.T) {
+	defer SetToken("")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	_, err := DoRequest("POST", server.URL, nil)
+	assert.Error(t, err)
+
+	SetToken("secret")
+	body, err := DoRequest("POST", server.URL, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "ok", string(body))
+}
+
+func TestInitializeTLS(t *testing.T) {
+	defer InitializeTLS(TLSConfig{})
+	dir, err := ioutil.TempDir("", "gru-tls")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	assert.NoError(t, InitializeTLS(TLSConfig{}))
+	assert.False(t, TLSEnabled())
+	assert.Equal(t, "http", Scheme())
+	assert.Equal(t, ErrIncompleteTLS, InitializeTLS(TLSConfig{CertFile: "cert.pem"}))
+
+	tlsConfig := createMockCertificates(t, dir)
+	assert.NoError(t, InitializeTLS(tlsConfig))
+	assert.True(t, TLSEnabled())
+	assert.Equal(t, "https", Scheme())
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	server.TLS = ServerTLSConfig()
+	server.StartTLS()
+	defer server.Close()
+
+	body, err := DoRequest("GET", server.URL, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "ok", string(body))
+
+	// A client without certificate is refused
+	noCert := &http.Client{Transport: &http.Transport{
+		TLSClientConfig: &tls.Config{RootCAs: ServerTLSConfig().ClientCAs},
+	}}
+	_, err = noCert.Get(server.URL)
+	assert.Error(t, err)
+}
+
+func createMockCertificates(t *testing.T, dir string) TLSConfig {
+	caKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "gru-ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	caDer, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	assert.NoError(t, err)
+	caCert, _ := x509.ParseCertificate(caDer)
+
+	nodeKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	nodeTemplate := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "node"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	nodeDer, err := x509.CreateCertificate(rand.Reader, nodeTemplate, caCert, &nodeKey.PublicKey, caKey)
+	assert.NoError(t, err)
+	keyDer, _ := x509.MarshalECPrivateKey(nodeKey)
+
+	tlsConfig := TLSConfig{
+		CertFile: filepath.Join(dir, "cert.pem"),
+		KeyFile:  filepath.Join(dir, "key.pem"),
+		CAFile:   filepath.Join(dir, "ca.pem"),
+	}
+	writePem(t, tlsConfig.CAFile, "CERTIFICATE", caDer)
+	writePem(t, tlsConfig.CertFile, "CERTIFICATE", nodeDer)
+	writePem(t, tlsConfig.KeyFile, "EC PRIVATE KEY", keyDer)
+
+	return tlsConfig
+}
+
+func writePem(t *testing.T, path string, blockType string, der []byte) {
+	encoded := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+	assert.NoError(t, ioutil.WriteFile(path, encoded, 0600))
+}
@@ -0,0 +1,86 @@
+package network
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io/ioutil"
+	"net/http"
+)
+
+var (
+	ErrIncompleteTLS error = errors.New("TLS needs certificate, key and CA files")
+	ErrInvalidCA     error = errors.New("Cannot parse CA certificates")
+
+	serverTLS *tls.Config
+	client    = &http.Client{}
+)
+
+type TLSConfig struct {
+	CertFile string
+	KeyFile  string
+	CAFile   string
+}
+
+// The same certificate is used by the node both as server and as client,
+// and the peers are verified against the CA of the cluster. If no file is
+// configured the communication is in plain HTTP.
+func InitializeTLS(tlsConfig TLSConfig) error {
+	if tlsConfig.CertFile == "" && tlsConfig.KeyFile == "" && tlsConfig.CAFile == "" {
+		serverTLS = nil
+		client = &http.Client{}
+		return nil
+	}
+	if tlsConfig.CertFile == "" || tlsConfig.KeyFile == "" || tlsConfig.CAFile == "" {
+		return ErrIncompleteTLS
+	}
+
+	cert, err := tls.LoadX509KeyPair(tlsConfig.CertFile, tlsConfig.KeyFile)
+	if err != nil {
+		return err
+	}
+
+	caData, err := ioutil.ReadFile(tlsConfig.CAFile)
+	if err != nil {
+		return err
+	}
+	ca := x509.NewCertPool()
+	if !ca.AppendCertsFromPEM(caData) {
+		return ErrInvalidCA
+	}
+
+	serverTLS = &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientCAs:    ca,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	client = &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{
+				Certificates: []tls.Certificate{cert},
+				RootCAs:      ca,
+				MinVersion:   tls.VersionTLS12,
+			},
+		},
+	}
+
+	return nil
+}
+
+func TLSEnabled() bool {
+	return serverTLS != nil
+}
+
+func ServerTLSConfig() *tls.Config {
+	return serverTLS
+}
+
+func Scheme() string {
+	if TLSEnabled() {
+		return "https"
+	}
+
+	return "http"
+}
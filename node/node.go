@@ -9,13 +9,19 @@ import (
 	"github.com/elleFlorio/gru/utils"
 )
 
-func CreateNode(name string, resources *res.Resource) {
+func CreateNode(name string, zone string, rack string, resources *res.Resource) {
 	node_UUID, err := utils.GenerateUUID()
 	if err != nil {
 		log.WithField("err", err).Errorln("Error generating node UUID")
 	}
-	node_address := "http://" + network.Config().IpAddress + ":" + network.Config().Port
-	config := cfg.NodeConfig{node_UUID, name, node_address, "", ""}
+	node_address := network.Scheme() + "://" + network.Config().IpAddress + ":" + network.Config().Port
+	config := cfg.NodeConfig{
+		UUID:    node_UUID,
+		Name:    name,
+		Address: node_address,
+		Zone:    zone,
+		Rack:    rack,
+	}
 	nodeRes := cfg.NodeResources{
 		TotalCpus:   resources.CPU.Total,
 		TotalMemory: resources.Memory.Total,
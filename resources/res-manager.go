@@ -115,7 +115,7 @@ func ComputeUsedCpus() (int64, error) {
 	}
 
 	for _, c := range containers {
-		if _, err := service.GetServiceByImage(c.Image); err == nil {
+		if _, err := service.GetServiceByContainer(c.Labels, c.Image); err == nil {
 			cData, err := container.Docker().Client.InspectContainer(c.Id)
 			if err != nil {
 				return 0, err
@@ -139,7 +139,7 @@ func ComputeUsedMemory() (int64, error) {
 	}
 
 	for _, c := range containers {
-		if _, err := service.GetServiceByImage(c.Image); err == nil {
+		if _, err := service.GetServiceByContainer(c.Labels, c.Image); err == nil {
 			cData, err := container.Docker().Client.InspectContainer(c.Id)
 			if err != nil {
 				return 0, err
@@ -167,14 +167,35 @@ func AvailableResources() float64 {
 }
 
 func AvailableResourcesService(name string) float64 {
-	var err error
-
 	nodeCpu := resources.CPU.Total
 	nodeUsedCpu := resources.CPU.Used
 	nodeMem := resources.Memory.Total
 	nodeUsedMem := resources.Memory.Used
 
-	srv, _ := service.GetServiceByName(name)
+	srvCpu, srvMem, err := GetServiceRequirements(name)
+	if err != nil {
+		return 0.0
+	}
+
+	if nodeCpu < srvCpu || nodeMem < srvMem {
+		return 0.0
+	}
+
+	if (nodeCpu-nodeUsedCpu) < srvCpu || (nodeMem-nodeUsedMem) < srvMem {
+		return 0.0
+	}
+
+	return 1.0
+}
+
+func GetServiceRequirements(name string) (int64, int64, error) {
+	var err error
+
+	srv, err := service.GetServiceByName(name)
+	if err != nil {
+		return 0, 0, err
+	}
+
 	srvCpu := srv.Docker.CPUnumber
 	log.WithFields(log.Fields{
 		"service": name,
@@ -186,21 +207,20 @@ func AvailableResourcesService(name string) float64 {
 		srvMem, err = utils.RAMInBytes(srv.Docker.Memory)
 		if err != nil {
 			log.WithField("err", err).Warnln("Cannot convert service RAM in Bytes.")
-			return 0.0
+			return 0, 0, err
 		}
 	} else {
 		srvMem = 0
 	}
 
-	if nodeCpu < int64(srvCpu) || nodeMem < int64(srvMem) {
-		return 0.0
-	}
+	return int64(srvCpu), srvMem, nil
+}
 
-	if (nodeCpu-nodeUsedCpu) < int64(srvCpu) || (nodeMem-nodeUsedMem) < int64(srvMem) {
-		return 0.0
-	}
+func CheckResourcesAvailable(cpu int64, memory int64) bool {
+	freeCpu := resources.CPU.Total - resources.CPU.Used
+	freeMem := resources.Memory.Total - resources.Memory.Used
 
-	return 1.0
+	return freeCpu >= cpu && freeMem >= memory
 }
 
 func SetServiceInstanceResources(name string, id string) {
@@ -365,6 +385,38 @@ func CheckSpecificCoresAvailable(cpusetcpus string) bool {
 	return available
 }
 
+// The cores are checked as if the released instances were already removed,
+// so the cores assigned to them are free.
+func CheckSpecificCoresAvailableReleasing(cpusetcpus string, released []string) bool {
+	request, err := getCoresNumber(cpusetcpus)
+	if err != nil {
+		log.WithField("err", err).Errorln("Error Checking available cores")
+		return false
+	}
+
+	freed := make(map[int]bool)
+	mutex_instance.RLock()
+	for _, id := range released {
+		if cores, ok := instanceCores[id]; ok {
+			numbers, _ := getCoresNumber(cores)
+			for _, core := range numbers {
+				freed[core] = true
+			}
+		}
+	}
+	mutex_instance.RUnlock()
+
+	mutex_cpu.RLock()
+	defer mutex_cpu.RUnlock()
+	for _, req := range request {
+		if !resources.CPU.Cores[req] && !freed[req] {
+			return false
+		}
+	}
+
+	return true
+}
+
 func CheckAndSetSpecificCores(cpusetcpus string, id string) error {
 	defer runtime.Gosched()
 
@@ -519,6 +571,90 @@ func RequestPortsForService(name string) (map[string]string, error) {
 	return requestedPorts, nil
 }
 
+func CheckPortsAvailable(name string) bool {
+	mutex_port.RLock()
+	defer mutex_port.RUnlock()
+
+	for _, host := range resources.Network.ServicePorts[name].Status {
+		if len(host.Available) < 1 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// The host ports that RequestPortsForService would choose for a new instance
+// of the service must not be claimed by the new instances of other services
+// (e.g. started by other policies in the same loop). If they are free they
+// are added to the claimed ones.
+func ClaimPortsForService(name string, claimed map[string]bool) bool {
+	mutex_port.RLock()
+	defer mutex_port.RUnlock()
+
+	requested := []string{}
+	for _, host := range resources.Network.ServicePorts[name].Status {
+		if len(host.Available) < 1 {
+			return false
+		}
+		port := host.Available[len(host.Available)-1]
+		if claimed[port] {
+			return false
+		}
+		requested = append(requested, port)
+	}
+
+	for _, port := range requested {
+		claimed[port] = true
+	}
+
+	return true
+}
+
+// The ports of the service are checked as if the released instances were
+// already removed: the host ports bound to them are free, while the ones
+// bound to the other instances on the node, of any service, are not.
+func CheckPortsAvailableReleasing(name string, released []string) bool {
+	mutex_port.RLock()
+	defer mutex_port.RUnlock()
+
+	bound := make(map[string]bool)
+	freed := make(map[string]bool)
+	for id, ports := range instanceBindings {
+		isReleased := utils.ContainsString(released, id)
+		for _, bindings := range ports {
+			for _, binding := range bindings {
+				if isReleased {
+					freed[binding] = true
+				} else {
+					bound[binding] = true
+				}
+			}
+		}
+	}
+
+	for _, host := range resources.Network.ServicePorts[name].Status {
+		free := false
+		for _, port := range host.Available {
+			if !bound[port] {
+				free = true
+				break
+			}
+		}
+		for _, port := range host.Occupied {
+			if freed[port] && !bound[port] {
+				free = true
+				break
+			}
+		}
+		if !free {
+			return false
+		}
+	}
+
+	return true
+}
+
 func AssignSpecifiPortsToService(name string, id string, ports map[string][]string) error {
 	defer runtime.Gosched()
 	mutex_port.Lock()
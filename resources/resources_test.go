@@ -76,6 +76,18 @@ func TestCheckSpecificCoresAvailable(t *testing.T) {
 	assert.False(t, CheckSpecificCoresAvailable(req))
 }
 
+func TestCheckSpecificCoresAvailableReleasing(t *testing.T) {
+	defer freeCores()
+
+	req := "0,3"
+	assignSpecificCores([]int{0}, "pippo")
+	assignSpecificCores([]int{3}, "topolino")
+	assert.False(t, CheckSpecificCoresAvailableReleasing(req, []string{}))
+	assert.False(t, CheckSpecificCoresAvailableReleasing(req, []string{"pippo"}))
+	assert.True(t, CheckSpecificCoresAvailableReleasing(req, []string{"pippo", "topolino"}))
+	assert.False(t, CheckSpecificCoresAvailableReleasing("0,1,85", []string{"pippo", "topolino"}))
+}
+
 func TestGetCoresAvailable(t *testing.T) {
 	defer freeCores()
 
@@ -275,6 +287,33 @@ func TestAvailableResources(t *testing.T) {
 	assert.InEpsilon(t, 1.0, AvailableResources(), c_EPSILON)
 }
 
+func TestGetServiceRequirements(t *testing.T) {
+	defer cfg.CleanServices()
+
+	name := "test"
+	cfg.SetServices([]cfg.Service{createService(name, 2, "1G")})
+	cpu, mem, err := GetServiceRequirements(name)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), cpu)
+	assert.Equal(t, int64(1024*1024*1024), mem)
+
+	cfg.SetServices([]cfg.Service{createService(name, 1, "error")})
+	_, _, err = GetServiceRequirements(name)
+	assert.Error(t, err)
+
+	_, _, err = GetServiceRequirements("pippo")
+	assert.Error(t, err)
+}
+
+func TestCheckResourcesAvailable(t *testing.T) {
+	defer CleanResources()
+
+	setResources(6, "8G", 2, "2G")
+	assert.True(t, CheckResourcesAvailable(4, 6*1024*1024*1024))
+	assert.False(t, CheckResourcesAvailable(5, 0))
+	assert.False(t, CheckResourcesAvailable(0, 7*1024*1024*1024))
+}
+
 func createService(name string, cpu int, mem string) cfg.Service {
 	srvConfig := cfg.ServiceDocker{
 		CPUnumber: cpu,
@@ -480,6 +519,20 @@ func TestFreePortsFromService(t *testing.T) {
 
 }
 
+func TestCheckPortsAvailableReleasing(t *testing.T) {
+	defer clearServicePorts()
+	defer func() { instanceBindings = make(map[string]portBindings) }()
+	createServicePorts()
+	// The other service binds the only free host port of pippo on 50200
+	instanceBindings["other_1"] = portBindings{"8080": []string{"50201"}}
+	assignPort("pippo", "pippo_1", "50200", []string{"50200"})
+
+	assert.True(t, CheckPortsAvailable("pippo"))
+	assert.False(t, CheckPortsAvailableReleasing("pippo", []string{}))
+	assert.True(t, CheckPortsAvailableReleasing("pippo", []string{"pippo_1"}))
+	assert.True(t, CheckPortsAvailableReleasing("pippo", []string{"other_1"}))
+}
+
 func clearServicePorts() {
 	resources.Network.ServicePorts = make(map[string]Ports)
 }
@@ -0,0 +1,107 @@
+package service
+
+import (
+	"errors"
+	"sort"
+
+	log "github.com/elleFlorio/gru/Godeps/_workspace/src/github.com/Sirupsen/logrus"
+
+	cfg "github.com/elleFlorio/gru/configuration"
+	"github.com/elleFlorio/gru/discovery"
+)
+
+var (
+	ErrUnknownDependency error = errors.New("Service depends on an unknown service")
+	ErrDependencyCycle   error = errors.New("Service dependencies contain a cycle")
+
+	runningInCluster = IsRunningInCluster
+)
+
+func CheckDependencies(services []cfg.Service) error {
+	_, err := SortByDependencies(services)
+	return err
+}
+
+// The services are sorted so that each service comes after the services
+// it depends on. Services at the same level are sorted by name.
+func SortByDependencies(services []cfg.Service) ([]string, error) {
+	inDegree := make(map[string]int, len(services))
+	dependents := make(map[string][]string, len(services))
+	for _, service := range services {
+		inDegree[service.Name] = 0
+	}
+
+	for _, service := range services {
+		for _, dep := range service.DependsOn {
+			if _, ok := inDegree[dep]; !ok || dep == service.Name {
+				log.WithFields(log.Fields{
+					"service":    service.Name,
+					"dependency": dep,
+				}).Errorln("Invalid service dependency")
+				return []string{}, ErrUnknownDependency
+			}
+			inDegree[service.Name] += 1
+			dependents[dep] = append(dependents[dep], service.Name)
+		}
+	}
+
+	ready := []string{}
+	for name, degree := range inDegree {
+		if degree == 0 {
+			ready = append(ready, name)
+		}
+	}
+
+	sorted := make([]string, 0, len(services))
+	for len(ready) > 0 {
+		sort.Strings(ready)
+		current := ready[0]
+		ready = ready[1:]
+		sorted = append(sorted, current)
+		for _, dependent := range dependents[current] {
+			inDegree[dependent] -= 1
+			if inDegree[dependent] == 0 {
+				ready = append(ready, dependent)
+			}
+		}
+	}
+
+	if len(sorted) < len(services) {
+		return []string{}, ErrDependencyCycle
+	}
+
+	return sorted, nil
+}
+
+// A dependency is running if it has a running instance in this node or an
+// instance registered in the discovery service by any node of the cluster.
+func MissingDependencies(name string) []string {
+	missing := []string{}
+	service, err := GetServiceByName(name)
+	if err != nil {
+		return missing
+	}
+
+	appRoot := cfg.GetAgentDiscovery().AppRoot
+	for _, dep := range service.DependsOn {
+		depService, err := GetServiceByName(dep)
+		if err == nil && len(depService.Instances.Running) > 0 {
+			continue
+		}
+
+		if !runningInCluster(appRoot, dep) {
+			missing = append(missing, dep)
+		}
+	}
+
+	return missing
+}
+
+func IsRunningInCluster(appRoot string, name string) bool {
+	instances, err := discovery.Get(appRoot+"/"+name, discovery.Options{})
+	if err != nil {
+		return false
+	}
+
+	return len(instances) > 0
+}
@@ -38,6 +38,10 @@ func SaveInstanceAddress(id string, port string) {
 	addressMap[id] = address
 }
 
+func GetInstanceAddress(id string) string {
+	return addressMap[id]
+}
+
 func RemoveInstanceAddress(id string) {
 	delete(addressMap, id)
 }
@@ -45,14 +49,18 @@ func RemoveInstanceAddress(id string) {
 func RegisterServiceInstanceId(name string, id string) {
 	var err error
 	discoveryConf := cfg.GetAgentDiscovery()
+	ttl := time.Duration(discoveryConf.TTL) * time.Second
 	opt := discovery.Options{
-		"TTL": time.Duration(discoveryConf.TTL) * time.Second,
+		"TTL": ttl,
 	}
 
 	isntanceKey := discoveryConf.AppRoot + "/" + name + "/" + id
 	instanceValue := addressMap[id]
 
 	err = discovery.Set(isntanceKey, instanceValue, opt)
+	if err == nil {
+		err = discovery.RegisterInstance(name, id, instanceValue, ttl)
+	}
 	if err != nil {
 		log.WithFields(log.Fields{
 			"service":  name,
@@ -71,8 +79,9 @@ func keepAlive(name string, id string) {
 	var err error
 	discoveryConf := cfg.GetAgentDiscovery()
 	ticker := time.NewTicker(time.Duration(discoveryConf.TTL-1) * time.Second)
+	ttl := time.Duration(discoveryConf.TTL) * time.Second
 	opt := discovery.Options{
-		"TTL": time.Duration(discoveryConf.TTL) * time.Second,
+		"TTL": ttl,
 	}
 
 	ch_stop := ch.CreateInstanceChannel(id)
@@ -92,6 +101,9 @@ func keepAlive(name string, id string) {
 					"err":      err,
 				}).Errorln("Error keeping instance alive")
 			}
+			if discovery.PassInstance(id) != nil {
+				discovery.RegisterInstance(name, id, instanceValue, ttl)
+			}
 		case <-ch_stop:
 			log.Debugln("Stopping keep alive routine")
 			return
@@ -103,13 +115,15 @@ func UnregisterServiceInstance(name string, id string) {
 	discoveryConf := cfg.GetAgentDiscovery()
 	isntanceKey := discoveryConf.AppRoot + "/" + name + "/" + id
 	discovery.Delete(isntanceKey)
+	discovery.DeregisterInstance(id)
 	ch_stop, err := ch.GetInstanceChannel(id)
 	if err != nil {
+		// The instance is unregistered before being stopped, so the
+		// channel has already been removed when the die event arrives
 		log.WithFields(log.Fields{
 			"service":  name,
 			"instance": id,
-			"err":      err,
-		}).Errorln("Error getting instance stop channel")
+		}).Debugln("Instance already unregistered")
 		return
 	}
 	ch_stop <- struct{}{}
@@ -0,0 +1,52 @@
+package service
+
+import (
+	"errors"
+
+	cfg "github.com/elleFlorio/gru/configuration"
+)
+
+const (
+	LabelCluster = "gru.cluster"
+	LabelService = "gru.service"
+	LabelNode    = "gru.node"
+	LabelVersion = "gru.version"
+
+	AgentVersion = "0.1.0"
+)
+
+var ErrNotManaged error = errors.New("Container not managed by Gru")
+
+// Every container created by Gru is labelled, so it can be identified even
+// if other containers are created from the same image.
+func CreateLabels(name string) map[string]string {
+	return map[string]string{
+		LabelCluster: cfg.GetNodeConfig().Cluster,
+		LabelService: name,
+		LabelNode:    cfg.GetNodeConfig().Name,
+		LabelVersion: AgentVersion,
+	}
+}
+
+// The unlabelled containers are matched by image only if the adoption of
+// legacy containers is enabled.
+func GetServiceByContainer(labels map[string]string, image string) (*cfg.Service, error) {
+	name, labelled := labels[LabelService]
+	if !labelled {
+		if cfg.GetAgentDocker().AdoptLegacy {
+			return GetServiceByImage(image)
+		}
+		return nil, ErrNotManaged
+	}
+
+	if labels[LabelCluster] != cfg.GetNodeConfig().Cluster {
+		return nil, ErrNotManaged
+	}
+
+	return GetServiceByName(name)
+}
+
+func IsLabelled(labels map[string]string) bool {
+	_, labelled := labels[LabelService]
+	return labelled
+}
@@ -95,6 +95,16 @@ func getServiceBy(field string, value string) (*cfg.Service, error) {
 		}
 	}
 
+	// The containers created with the previous image of a service are still
+	// managed during a rolling update.
+	if field == "image" {
+		for i := 0; i < len(services); i++ {
+			if services[i].PreviousImage != "" && services[i].PreviousImage == value {
+				return &services[i], nil
+			}
+		}
+	}
+
 	return nil, ErrNoSuchService
 }
 
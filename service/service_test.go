@@ -49,6 +49,13 @@ func TestGetServiceByImage(t *testing.T) {
 
 	_, err = GetServiceByImage("test/pippo")
 	assert.Error(t, err, "There should be no image 'test/pippo'")
+
+	services := CreateMockServices()
+	services[0].PreviousImage = "test/tomcat:old"
+	cfg.SetServices(services)
+	old, err := GetServiceByImage("test/tomcat:old")
+	assert.NoError(t, err)
+	assert.Equal(t, "service1", old.Name)
 }
 
 func TestGetServiceById(t *testing.T) {
@@ -254,3 +261,142 @@ func TestGetServiceInstanceStatus(t *testing.T) {
 	status = GetServiceInstanceStatus("pippo", "pippo")
 	assert.Equal(t, enum.UNKNOWN, status)
 }
+
+func TestSortByDependencies(t *testing.T) {
+	db := cfg.Service{Name: "db"}
+	api := cfg.Service{Name: "api", DependsOn: []string{"db"}}
+	frontend := cfg.Service{Name: "frontend", DependsOn: []string{"api", "db"}}
+	cache := cfg.Service{Name: "cache"}
+
+	sorted, err := SortByDependencies([]cfg.Service{frontend, api, cache, db})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"cache", "db", "api", "frontend"}, sorted)
+
+	unknown := cfg.Service{Name: "worker", DependsOn: []string{"queue"}}
+	_, err = SortByDependencies([]cfg.Service{db, unknown})
+	assert.Equal(t, ErrUnknownDependency, err)
+
+	self := cfg.Service{Name: "self", DependsOn: []string{"self"}}
+	assert.Equal(t, ErrUnknownDependency, CheckDependencies([]cfg.Service{self}))
+
+	db.DependsOn = []string{"frontend"}
+	_, err = SortByDependencies([]cfg.Service{frontend, api, db})
+	assert.Equal(t, ErrDependencyCycle, err)
+}
+
+func TestMissingDependencies(t *testing.T) {
+	defer cfg.CleanServices()
+	defer func() { runningInCluster = IsRunningInCluster }()
+
+	db := cfg.Service{Name: "db"}
+	api := cfg.Service{Name: "api", DependsOn: []string{"db"}}
+	frontend := cfg.Service{Name: "frontend", DependsOn: []string{"api", "db"}}
+	db.Instances.Running = []string{"db_1"}
+	cfg.SetServices([]cfg.Service{db, api, frontend})
+
+	inCluster := map[string]bool{}
+	runningInCluster = func(appRoot string, name string) bool { return inCluster[name] }
+
+	assert.Empty(t, MissingDependencies("db"))
+	assert.Empty(t, MissingDependencies("api"))
+	assert.Equal(t, []string{"api"}, MissingDependencies("frontend"))
+
+	inCluster["api"] = true
+	assert.Empty(t, MissingDependencies("frontend"))
+}
+
+func TestGetServiceByContainer(t *testing.T) {
+	defer cfg.CleanServices()
+	defer func() { cfg.GetAgentDocker().AdoptLegacy = false }()
+	cfg.SetServices(CreateMockServices())
+	cfg.GetNodeConfig().Cluster = "myCluster"
+	cfg.GetNodeConfig().Name = "node1"
+	defer func() { cfg.SetNode(cfg.Node{}) }()
+
+	labels := CreateLabels("service2")
+	assert.Equal(t, "myCluster", labels[LabelCluster])
+	assert.Equal(t, "node1", labels[LabelNode])
+	assert.Equal(t, AgentVersion, labels[LabelVersion])
+
+	// The label wins over the image
+	labelled, err := GetServiceByContainer(labels, "test/tomcat")
+	assert.NoError(t, err)
+	assert.Equal(t, "service2", labelled.Name)
+
+	labels[LabelCluster] = "otherCluster"
+	_, err = GetServiceByContainer(labels, "test/jetty")
+	assert.Equal(t, ErrNotManaged, err)
+
+	_, err = GetServiceByContainer(map[string]string{}, "test/jetty")
+	assert.Equal(t, ErrNotManaged, err)
+
+	cfg.GetAgentDocker().AdoptLegacy = true
+	legacy, err := GetServiceByContainer(map[string]string{}, "test/jetty")
+	assert.NoError(t, err)
+	assert.Equal(t, "service2", legacy.Name)
+}
+
+func TestValidateService(t *testing.T) {
+	srv := cfg.Service{Name: "service1"}
+	srv.Docker.Ports = map[string]string{"53": "53"}
+	srv.Docker.PortsConfig = map[string]cfg.PortConfig{"53": cfg.PortConfig{Protocol: "udp", HostIp: "127.0.0.1"}}
+	srv.Docker.Binds = []string{"/data:/var/lib/data:ro"}
+	srv.Docker.RestartPolicy = cfg.RestartPolicy{Name: "on-failure", MaximumRetryCount: 3}
+	srv.Docker.Labels = map[string]string{"team": "gru"}
+	srv.Docker.Ulimits = []cfg.Ulimit{cfg.Ulimit{Name: "nofile", Soft: 1024, Hard: 2048}}
+	srv.Docker.WorkingDir = "/app"
+	srv.Docker.Healthcheck = cfg.Healthcheck{Test: []string{"CMD", "true"}, Interval: "10s"}
+	assert.NoError(t, ValidateService(srv))
+
+	invalid := srv
+	invalid.Docker.PortsConfig = map[string]cfg.PortConfig{"53": cfg.PortConfig{Protocol: "icmp"}}
+	assert.Equal(t, ErrInvalidPort, ValidateService(invalid))
+	invalid.Docker.PortsConfig = map[string]cfg.PortConfig{"80": cfg.PortConfig{}}
+	assert.Equal(t, ErrInvalidPort, ValidateService(invalid))
+	invalid.Docker.PortsConfig = map[string]cfg.PortConfig{"53": cfg.PortConfig{HostIp: "a:b"}}
+	assert.Equal(t, ErrInvalidPort, ValidateService(invalid))
+	invalid.Docker.PortsConfig = map[string]cfg.PortConfig{"53": cfg.PortConfig{HostIp: "::1"}}
+	assert.NoError(t, ValidateService(invalid))
+
+	invalid = srv
+	invalid.Docker.Binds = []string{"/data:relative"}
+	assert.Equal(t, ErrInvalidBind, ValidateService(invalid))
+
+	invalid = srv
+	invalid.Docker.RestartPolicy = cfg.RestartPolicy{Name: "always", MaximumRetryCount: 3}
+	assert.Equal(t, ErrInvalidRestartPolicy, ValidateService(invalid))
+
+	invalid = srv
+	invalid.Docker.Labels = map[string]string{LabelService: "other"}
+	assert.Equal(t, ErrReservedLabel, ValidateService(invalid))
+
+	invalid = srv
+	invalid.Docker.NetworkMode = "host"
+	assert.Equal(t, ErrNetworkModeConflict, ValidateService(invalid))
+
+	invalid = srv
+	invalid.Docker.Ulimits = []cfg.Ulimit{cfg.Ulimit{Name: "nofile", Soft: 4096, Hard: 2048}}
+	assert.Equal(t, ErrInvalidUlimit, ValidateService(invalid))
+
+	invalid = srv
+	invalid.Docker.CapAdd = []string{"NET_ADMIN"}
+	invalid.Docker.CapDrop = []string{"NET_ADMIN"}
+	assert.Equal(t, ErrCapabilityConflict, ValidateService(invalid))
+
+	invalid = srv
+	invalid.Docker.WorkingDir = "app"
+	assert.Equal(t, ErrInvalidWorkingDir, ValidateService(invalid))
+
+	invalid = srv
+	invalid.Docker.LogConfig = cfg.LogConfig{Config: map[string]string{"max-size": "10m"}}
+	assert.Equal(t, ErrInvalidLogConfig, ValidateService(invalid))
+
+	invalid = srv
+	invalid.Docker.Healthcheck = cfg.Healthcheck{Test: []string{"CMD", "true"}, Interval: "ten"}
+	assert.Equal(t, ErrInvalidHealthcheck, ValidateService(invalid))
+
+	valid := ValidateServices([]cfg.Service{srv, invalid})
+	if assert.Len(t, valid, 1) {
+		assert.Equal(t, "service1", valid[0].Name)
+	}
+}
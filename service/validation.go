@@ -0,0 +1,220 @@
+package service
+
+import (
+	"errors"
+	"net"
+	"path"
+	"strings"
+	"time"
+
+	log "github.com/elleFlorio/gru/Godeps/_workspace/src/github.com/Sirupsen/logrus"
+
+	cfg "github.com/elleFlorio/gru/configuration"
+	"github.com/elleFlorio/gru/utils"
+)
+
+var (
+	ErrInvalidPort          error = errors.New("Invalid port configuration")
+	ErrInvalidBind          error = errors.New("Invalid bind mount")
+	ErrInvalidRestartPolicy error = errors.New("Invalid restart policy")
+	ErrReservedLabel        error = errors.New("Labels with prefix 'gru.' are reserved")
+	ErrNetworkModeConflict  error = errors.New("Network mode conflicts with ports, links or dns")
+	ErrInvalidUlimit        error = errors.New("Invalid ulimit")
+	ErrCapabilityConflict   error = errors.New("Capability both added and dropped")
+	ErrInvalidWorkingDir    error = errors.New("Working dir must be an absolute path")
+	ErrInvalidLogConfig     error = errors.New("Log options without log driver")
+	ErrInvalidHealthcheck   error = errors.New("Invalid healthcheck")
+
+	protocols       = []string{"tcp", "udp", "sctp"}
+	restartPolicies = []string{"", "no", "always", "unless-stopped", "on-failure"}
+	healthchecks    = []string{"NONE", "CMD", "CMD-SHELL"}
+)
+
+// The services with an invalid configuration are discarded, because the
+// Docker daemon would refuse to create their containers.
+func ValidateServices(services []cfg.Service) []cfg.Service {
+	valid := make([]cfg.Service, 0, len(services))
+	for _, service := range services {
+		if err := ValidateService(service); err != nil {
+			log.WithFields(log.Fields{
+				"service": service.Name,
+				"err":     err,
+			}).Errorln("Invalid service configuration")
+			continue
+		}
+		valid = append(valid, service)
+	}
+
+	return valid
+}
+
+func ValidateService(service cfg.Service) error {
+	conf := service.Docker
+	validators := []func(cfg.ServiceDocker) error{
+		validatePorts,
+		validateBinds,
+		validateRestartPolicy,
+		validateLabels,
+		validateNetworkMode,
+		validateUlimits,
+		validateCapabilities,
+		validateWorkingDir,
+		validateLogConfig,
+		validateHealthcheck,
+	}
+
+	for _, validate := range validators {
+		if err := validate(conf); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func validatePorts(conf cfg.ServiceDocker) error {
+	for guest, portConfig := range conf.PortsConfig {
+		if _, ok := conf.Ports[guest]; !ok {
+			return ErrInvalidPort
+		}
+		if portConfig.Protocol != "" && !utils.ContainsString(protocols, portConfig.Protocol) {
+			return ErrInvalidPort
+		}
+		if portConfig.HostIp != "" && !isIp(portConfig.HostIp) {
+			return ErrInvalidPort
+		}
+	}
+
+	return nil
+}
+
+func isIp(address string) bool {
+	return net.ParseIP(address) != nil
+}
+
+// host-path:container-path[:ro|rw]
+func validateBinds(conf cfg.ServiceDocker) error {
+	for _, bind := range conf.Binds {
+		parts := strings.Split(bind, ":")
+		if len(parts) < 2 || len(parts) > 3 || parts[0] == "" || !path.IsAbs(parts[1]) {
+			return ErrInvalidBind
+		}
+		if len(parts) == 3 && parts[2] != "ro" && parts[2] != "rw" {
+			return ErrInvalidBind
+		}
+	}
+
+	return nil
+}
+
+func validateRestartPolicy(conf cfg.ServiceDocker) error {
+	policy := conf.RestartPolicy
+	if !utils.ContainsString(restartPolicies, policy.Name) {
+		return ErrInvalidRestartPolicy
+	}
+	if policy.MaximumRetryCount != 0 && policy.Name != "on-failure" {
+		return ErrInvalidRestartPolicy
+	}
+
+	return nil
+}
+
+func validateLabels(conf cfg.ServiceDocker) error {
+	for key, _ := range conf.Labels {
+		if strings.HasPrefix(key, "gru.") {
+			return ErrReservedLabel
+		}
+	}
+
+	return nil
+}
+
+// With host network the ports are not bound and the links are not allowed,
+// while a container network shares also the dns of the other container.
+func validateNetworkMode(conf cfg.ServiceDocker) error {
+	mode := conf.NetworkMode
+	switch {
+	case mode == "host":
+		if len(conf.Ports) > 0 || len(conf.Links) > 0 {
+			return ErrNetworkModeConflict
+		}
+	case mode == "none":
+		if len(conf.Ports) > 0 || len(conf.Links) > 0 || len(conf.Dns) > 0 {
+			return ErrNetworkModeConflict
+		}
+	case strings.HasPrefix(mode, "container:"):
+		if len(conf.Ports) > 0 || len(conf.Links) > 0 || len(conf.Dns) > 0 ||
+			len(conf.DnsSearch) > 0 || len(conf.DnsOptions) > 0 {
+			return ErrNetworkModeConflict
+		}
+	}
+
+	return nil
+}
+
+func validateUlimits(conf cfg.ServiceDocker) error {
+	for _, ulimit := range conf.Ulimits {
+		if ulimit.Name == "" || ulimit.Soft > ulimit.Hard {
+			return ErrInvalidUlimit
+		}
+	}
+
+	return nil
+}
+
+func validateCapabilities(conf cfg.ServiceDocker) error {
+	for _, capability := range conf.CapAdd {
+		if utils.ContainsString(conf.CapDrop, capability) {
+			return ErrCapabilityConflict
+		}
+	}
+
+	return nil
+}
+
+func validateWorkingDir(conf cfg.ServiceDocker) error {
+	if conf.WorkingDir != "" && !path.IsAbs(conf.WorkingDir) {
+		return ErrInvalidWorkingDir
+	}
+
+	return nil
+}
+
+func validateLogConfig(conf cfg.ServiceDocker) error {
+	if conf.LogConfig.Type == "" && len(conf.LogConfig.Config) > 0 {
+		return ErrInvalidLogConfig
+	}
+
+	return nil
+}
+
+func validateHealthcheck(conf cfg.ServiceDocker) error {
+	healthcheck := conf.Healthcheck
+	if len(healthcheck.Test) == 0 {
+		if healthcheck.Interval != "" || healthcheck.Timeout != "" || healthcheck.Retries != 0 {
+			return ErrInvalidHealthcheck
+		}
+		return nil
+	}
+
+	if !utils.ContainsString(healthchecks, healthcheck.Test[0]) {
+		return ErrInvalidHealthcheck
+	}
+	if healthcheck.Test[0] != "NONE" && len(healthcheck.Test) < 2 {
+		return ErrInvalidHealthcheck
+	}
+	if healthcheck.Retries < 0 {
+		return ErrInvalidHealthcheck
+	}
+
+	for _, duration := range []string{healthcheck.Interval, healthcheck.Timeout} {
+		if duration == "" {
+			continue
+		}
+		if value, err := time.ParseDuration(duration); err != nil || value < time.Millisecond {
+			return ErrInvalidHealthcheck
+		}
+	}
+
+	return nil
+}
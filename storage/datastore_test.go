@@ -44,6 +44,10 @@ func TestStoreData(t *testing.T) {
 	assert.NoError(t, err)
 	err = StoreData(key, data, enum.SHARED)
 	assert.NoError(t, err)
+	err = StoreData(key, data, enum.LEARNING)
+	assert.NoError(t, err)
+	err = StoreData(key, data, enum.DECISIONS)
+	assert.NoError(t, err)
 }
 
 func TestGetData(t *testing.T) {
@@ -59,6 +63,8 @@ func TestGetData(t *testing.T) {
 	StoreData(key, data, enum.ANALYTICS)
 	StoreData(key, data, enum.POLICIES)
 	StoreData(key, data, enum.SHARED)
+	StoreData(key, data, enum.LEARNING)
+	StoreData(key, data, enum.DECISIONS)
 	value, _ = GetData(key, enum.STATS)
 	assert.Equal(t, data, value)
 	value, _ = GetData(key, enum.ANALYTICS)
@@ -67,6 +73,10 @@ func TestGetData(t *testing.T) {
 	assert.Equal(t, data, value)
 	value, _ = GetData(key, enum.SHARED)
 	assert.Equal(t, data, value)
+	value, _ = GetData(key, enum.LEARNING)
+	assert.Equal(t, data, value)
+	value, _ = GetData(key, enum.DECISIONS)
+	assert.Equal(t, data, value)
 }
 
 func TestGetAllData(t *testing.T) {
@@ -13,6 +13,8 @@ var (
 	mutex_a                  = sync.RWMutex{}
 	mutex_p                  = sync.RWMutex{}
 	mutex_i                  = sync.RWMutex{}
+	mutex_l                  = sync.RWMutex{}
+	mutex_d                  = sync.RWMutex{}
 	ErrInvalidDataType error = errors.New("Invalid data type")
 	ErrNoData          error = errors.New("No such data")
 )
@@ -22,6 +24,8 @@ type internal struct {
 	analyticsData map[string][]byte
 	policiesData  map[string][]byte
 	sharedData    map[string][]byte
+	learningData  map[string][]byte
+	decisionsData map[string][]byte
 }
 
 func (p *internal) Name() string {
@@ -33,6 +37,8 @@ func (p *internal) Initialize() error {
 	p.analyticsData = make(map[string][]byte)
 	p.policiesData = make(map[string][]byte)
 	p.sharedData = make(map[string][]byte)
+	p.learningData = make(map[string][]byte)
+	p.decisionsData = make(map[string][]byte)
 	return nil
 }
 
@@ -54,6 +60,14 @@ func (p *internal) StoreData(key string, data []byte, dataType enum.Datatype) er
 		mutex_i.Lock()
 		p.sharedData[key] = data
 		mutex_i.Unlock()
+	case enum.LEARNING:
+		mutex_l.Lock()
+		p.learningData[key] = data
+		mutex_l.Unlock()
+	case enum.DECISIONS:
+		mutex_d.Lock()
+		p.decisionsData[key] = data
+		mutex_d.Unlock()
 	}
 	runtime.Gosched()
 
@@ -80,6 +94,14 @@ func (p *internal) GetData(key string, dataType enum.Datatype) ([]byte, error) {
 		mutex_i.RLock()
 		data, ok = p.sharedData[key]
 		mutex_i.RUnlock()
+	case enum.LEARNING:
+		mutex_l.RLock()
+		data, ok = p.learningData[key]
+		mutex_l.RUnlock()
+	case enum.DECISIONS:
+		mutex_d.RLock()
+		data, ok = p.decisionsData[key]
+		mutex_d.RUnlock()
 	}
 	runtime.Gosched()
 
@@ -109,6 +131,14 @@ func (p *internal) GetAllData(dataType enum.Datatype) (map[string][]byte, error)
 		mutex_i.RLock()
 		data = p.sharedData
 		mutex_i.RUnlock()
+	case enum.LEARNING:
+		mutex_l.RLock()
+		data = p.learningData
+		mutex_l.RUnlock()
+	case enum.DECISIONS:
+		mutex_d.RLock()
+		data = p.decisionsData
+		mutex_d.RUnlock()
 	}
 	runtime.Gosched()
 
@@ -133,6 +163,14 @@ func (p *internal) DeleteData(key string, dataType enum.Datatype) error {
 		mutex_i.Lock()
 		delete(p.sharedData, key)
 		mutex_i.Unlock()
+	case enum.LEARNING:
+		mutex_l.Lock()
+		delete(p.learningData, key)
+		mutex_l.Unlock()
+	case enum.DECISIONS:
+		mutex_d.Lock()
+		delete(p.decisionsData, key)
+		mutex_d.Unlock()
 	}
 
 	return nil
@@ -156,6 +194,14 @@ func (p *internal) DeleteAllData(dataType enum.Datatype) error {
 		mutex_i.Lock()
 		p.sharedData = make(map[string][]byte)
 		mutex_i.Unlock()
+	case enum.LEARNING:
+		mutex_l.Lock()
+		p.learningData = make(map[string][]byte)
+		mutex_l.Unlock()
+	case enum.DECISIONS:
+		mutex_d.Lock()
+		p.decisionsData = make(map[string][]byte)
+		mutex_d.Unlock()
 	}
 	runtime.Gosched()
 
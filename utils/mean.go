@@ -12,3 +12,22 @@ func Mean(values []float64) float64 {
 
 	return sum / float64(len(values))
 }
+
+// The values with a weight not greater than 0 are ignored
+func WeightedMean(values []float64, weights []float64) float64 {
+	sum := 0.0
+	total := 0.0
+	for i, value := range values {
+		if i >= len(weights) || weights[i] <= 0 {
+			continue
+		}
+		sum += value * weights[i]
+		total += weights[i]
+	}
+
+	if total == 0 {
+		return 0.0
+	}
+
+	return sum / total
+}
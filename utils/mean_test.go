@@ -13,3 +13,12 @@ func TestMean(t *testing.T) {
 	assert.Equal(t, 4.0, Mean(values))
 	assert.Equal(t, 0.0, Mean(valuesEmpty))
 }
+
+func TestWeightedMean(t *testing.T) {
+	values := []float64{2, 4, 6}
+
+	assert.Equal(t, 4.0, WeightedMean(values, []float64{1, 1, 1}))
+	assert.Equal(t, 5.0, WeightedMean(values, []float64{0, 1, 1}))
+	assert.Equal(t, 3.0, WeightedMean(values, []float64{3, 0, 1}))
+	assert.Equal(t, 0.0, WeightedMean(values, []float64{0, 0, 0}))
+}